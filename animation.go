@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+)
+
+// writeAnimation reads back the frames and writes them to fileName as one
+// animation
+func writeAnimation(fileName string, frameNames []string, fps int, r renderer.AnimationRenderer) error {
+	frames := make([]image.Image, len(frameNames))
+	for i, name := range frameNames {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		frames[i], err = png.Decode(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return renderer.WriteAnimation(fileName, r, frames, fps)
+}
+
+// assembleAnimation writes the frames to fileName once they're all rendered.
+// Of the processes sharing a lock directory, the one that gets the lock of the
+// animation writes it. The lock is released before any error is returned.
+func assembleAnimation(fileName string, frameNames []string, fps int, r renderer.AnimationRenderer) error {
+	done := 0
+	for _, name := range frameNames {
+		if frameDone(name) {
+			done++
+		}
+	}
+	if done < len(frameNames) {
+		fmt.Fprintf(os.Stderr, "%d of %d frames are rendered, %s is written once they all are\n", done, len(frameNames), fileName)
+		return nil
+	}
+	lock := &frameLock{}
+	if *lockDir != "" {
+		var err error
+		if lock, _, err = lockFrame(*lockDir, fileName); err == errLocked {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("locking %s: %w", fileName, err)
+		}
+	}
+	defer lock.release()
+	if err := writeAnimation(fileName, frameNames, fps, r); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d frames to %s\n", len(frameNames), fileName)
+	return nil
+}
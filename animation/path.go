@@ -0,0 +1,138 @@
+package animation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathElem is a step down a JSON document, a key of an object or an index of an
+// array
+type pathElem struct {
+	key   string
+	index int // index -1 for keys
+}
+
+// parsePath splits a path like "static[2].mat.albedo" into its steps
+func parsePath(path string) ([]pathElem, error) {
+	var elems []pathElem
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indices []int
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("bad index in path %q", path)
+				}
+				n, err := strconv.Atoi(rest[1:end])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("bad index in path %q", path)
+				}
+				indices = append(indices, n)
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" && (len(elems) > 0 || len(indices) == 0) {
+			return nil, fmt.Errorf("empty key in path %q", path)
+		}
+		if key != "" {
+			elems = append(elems, pathElem{key: key, index: -1})
+		}
+		for _, n := range indices {
+			elems = append(elems, pathElem{index: n})
+		}
+	}
+	return elems, nil
+}
+
+// set puts value at path in doc, a document decoded into interface{}. Keys
+// match whatever their case, like encoding/json does, and objects missing on
+// the way are made.
+func set(doc interface{}, path string, value interface{}) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	node := doc
+	for i, e := range elems {
+		last := i == len(elems)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if e.index >= 0 {
+				return fmt.Errorf("%s: %s isn't an array", path, pathString(elems[:i]))
+			}
+			key := e.key
+			for k := range n {
+				if strings.EqualFold(k, e.key) {
+					key = k
+					break
+				}
+			}
+			if last {
+				n[key] = value
+				return nil
+			}
+			if _, ok := n[key]; !ok {
+				n[key] = map[string]interface{}{}
+			}
+			node = n[key]
+		case []interface{}:
+			if e.index < 0 {
+				return fmt.Errorf("%s: %s is an array", path, pathString(elems[:i]))
+			}
+			if e.index >= len(n) {
+				return fmt.Errorf("%s: %s has %d elements", path, pathString(elems[:i]), len(n))
+			}
+			if last {
+				n[e.index] = value
+				return nil
+			}
+			node = n[e.index]
+		default:
+			return fmt.Errorf("%s: %s isn't an object or an array", path, pathString(elems[:i]))
+		}
+	}
+	return nil
+}
+
+// pathString writes steps back as a path
+func pathString(elems []pathElem) string {
+	var b strings.Builder
+	for _, e := range elems {
+		if e.index >= 0 {
+			fmt.Fprintf(&b, "[%d]", e.index)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(e.key)
+	}
+	if b.Len() == 0 {
+		return "the document"
+	}
+	return b.String()
+}
+
+// Apply decodes the JSON document data into v with every track set to its
+// value at time
+func Apply(data []byte, tracks []Track, time float64, v interface{}) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		if err := set(doc, t.Target, t.At(time).json()); err != nil {
+			return err
+		}
+	}
+	animated, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(animated, v)
+}
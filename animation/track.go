@@ -0,0 +1,227 @@
+// Package animation animates renders with keyframes. A track sets a value of a
+// JSON document, a camera parameter or a property of an object of the world,
+// to what its keyframes say it is at the time of every frame.
+package animation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Value is a number or a vector, JSON numbers, arrays and {"x", "y", "z"}
+// objects can all be values
+type Value []float64
+
+// UnmarshalJSON implements `json.Unmarshaler` for Value
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var number float64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*v = Value{number}
+		return nil
+	}
+	var vector map[string]float64
+	if err := json.Unmarshal(data, &vector); err == nil {
+		*v = Value{0, 0, 0}
+		for k, c := range vector {
+			switch strings.ToLower(k) {
+			case "x":
+				(*v)[0] = c
+			case "y":
+				(*v)[1] = c
+			case "z":
+				(*v)[2] = c
+			default:
+				return fmt.Errorf("vectors only have x, y and z, not %q", k)
+			}
+		}
+		return nil
+	}
+	var array []float64
+	if err := json.Unmarshal(data, &array); err != nil {
+		return errors.New("values are numbers, arrays or {\"x\", \"y\", \"z\"} vectors")
+	}
+	*v = array
+	return nil
+}
+
+// json returns the value as it's written in JSON, vectors of three as
+// {"x", "y", "z"}
+func (v Value) json() interface{} {
+	switch len(v) {
+	case 1:
+		return v[0]
+	case 3:
+		return map[string]interface{}{"x": v[0], "y": v[1], "z": v[2]}
+	}
+	array := make([]interface{}, len(v))
+	for i, c := range v {
+		array[i] = c
+	}
+	return array
+}
+
+// lerp returns a + (b-a)*t for every component
+func lerp(a, b Value, t float64) Value {
+	v := make(Value, len(a))
+	for i := range v {
+		v[i] = a[i] + (b[i]-a[i])*t
+	}
+	return v
+}
+
+// Keyframe is the value of a track at a time. How the track goes on to the next
+// keyframe is up to this one.
+type Keyframe struct {
+	Time          float64 // Time in seconds from the first frame
+	Value         Value
+	Interpolation string // Interpolation to the next keyframe, one of "linear" (default), "catmull-rom", "bezier" or "step"
+	Ease          string // Ease how time flows to the next keyframe, one of "linear" (default), "ease-in", "ease-out" or "ease-in-out"
+	// Out and In are the Bezier handles leaving this keyframe and entering it,
+	// as offsets from its value. Missing handles follow the Catmull-Rom tangent.
+	Out Value
+	In  Value
+}
+
+// Track animates a target with keyframes. Before the first keyframe and after
+// the last the value holds.
+type Track struct {
+	Target    string // Target path of the value in the document, like "static[2].mat.fuzz"
+	Keyframes []Keyframe
+}
+
+// Validate checks the keyframes can be interpolated, and sorts them by time
+func (t *Track) Validate() error {
+	if len(t.Keyframes) == 0 {
+		return fmt.Errorf("track %s has no keyframes", t.Target)
+	}
+	if _, err := parsePath(t.Target); err != nil {
+		return err
+	}
+	sort.SliceStable(t.Keyframes, func(i, j int) bool { return t.Keyframes[i].Time < t.Keyframes[j].Time })
+	n := len(t.Keyframes[0].Value)
+	for i, k := range t.Keyframes {
+		if len(k.Value) != n || k.Value == nil {
+			return fmt.Errorf("track %s: keyframe %d has %d components, the first %d", t.Target, i, len(k.Value), n)
+		}
+		if (k.Out != nil && len(k.Out) != n) || (k.In != nil && len(k.In) != n) {
+			return fmt.Errorf("track %s: handles of keyframe %d don't match its value", t.Target, i)
+		}
+		if i > 0 && k.Time == t.Keyframes[i-1].Time {
+			return fmt.Errorf("track %s: two keyframes at %gs", t.Target, k.Time)
+		}
+		if _, ok := easings[strings.ToLower(k.Ease)]; !ok {
+			return fmt.Errorf("track %s: unknown easing %q", t.Target, k.Ease)
+		}
+		switch strings.ToLower(k.Interpolation) {
+		case "", "linear", "catmull-rom", "bezier", "step":
+		default:
+			return fmt.Errorf("track %s: unknown interpolation %q", t.Target, k.Interpolation)
+		}
+	}
+	return nil
+}
+
+// easings remap the time between two keyframes, from 0 to 1
+var easings = map[string]func(u float64) float64{
+	"":       func(u float64) float64 { return u },
+	"linear": func(u float64) float64 { return u },
+	"ease-in": func(u float64) float64 {
+		return u * u * u
+	},
+	"ease-out": func(u float64) float64 {
+		return 1 - (1-u)*(1-u)*(1-u)
+	},
+	"ease-in-out": func(u float64) float64 {
+		if u < 0.5 {
+			return 4 * u * u * u
+		}
+		return 1 - 4*(1-u)*(1-u)*(1-u)
+	},
+}
+
+// At returns the value of the track at time. The track must be valid.
+func (t Track) At(time float64) Value {
+	ks := t.Keyframes
+	if time <= ks[0].Time {
+		return ks[0].Value
+	}
+	if time >= ks[len(ks)-1].Time {
+		return ks[len(ks)-1].Value
+	}
+	i := sort.Search(len(ks), func(i int) bool { return ks[i].Time > time }) - 1
+	k0, k1 := ks[i], ks[i+1]
+	u := easings[strings.ToLower(k0.Ease)]((time - k0.Time) / (k1.Time - k0.Time))
+
+	switch strings.ToLower(k0.Interpolation) {
+	case "step":
+		return k0.Value
+	case "catmull-rom":
+		return hermite(k0.Value, k1.Value, t.tangent(i), t.tangent(i+1), k1.Time-k0.Time, u)
+	case "bezier":
+		// Handles default to a third of the tangents, which makes the same
+		// curve as Catmull-Rom
+		out, in := k0.Out, k1.In
+		if out == nil {
+			out = scale(t.tangent(i), (k1.Time-k0.Time)/3)
+		}
+		if in == nil {
+			in = scale(t.tangent(i+1), -(k1.Time-k0.Time)/3)
+		}
+		return bezier(k0.Value, add(k0.Value, out), add(k1.Value, in), k1.Value, u)
+	}
+	return lerp(k0.Value, k1.Value, u)
+}
+
+// tangent returns the rate of change of the track at keyframe i, per second,
+// from the keyframes on either side. The ends are flat.
+func (t Track) tangent(i int) Value {
+	ks := t.Keyframes
+	if i == 0 || i == len(ks)-1 {
+		return make(Value, len(ks[i].Value))
+	}
+	return scale(add(ks[i+1].Value, scale(ks[i-1].Value, -1)), 1/(ks[i+1].Time-ks[i-1].Time))
+}
+
+// hermite interpolates from p0 to p1 leaving and arriving with tangents m0 and
+// m1 per second, dt seconds apart
+func hermite(p0, p1, m0, m1 Value, dt, u float64) Value {
+	u2, u3 := u*u, u*u*u
+	h00 := 2*u3 - 3*u2 + 1
+	h10 := u3 - 2*u2 + u
+	h01 := -2*u3 + 3*u2
+	h11 := u3 - u2
+	v := make(Value, len(p0))
+	for i := range v {
+		v[i] = h00*p0[i] + h10*dt*m0[i] + h01*p1[i] + h11*dt*m1[i]
+	}
+	return v
+}
+
+// bezier evaluates the cubic Bezier curve with control points p0 to p3
+func bezier(p0, p1, p2, p3 Value, u float64) Value {
+	w := 1 - u
+	v := make(Value, len(p0))
+	for i := range v {
+		v[i] = w*w*w*p0[i] + 3*w*w*u*p1[i] + 3*w*u*u*p2[i] + u*u*u*p3[i]
+	}
+	return v
+}
+
+func add(a, b Value) Value {
+	v := make(Value, len(a))
+	for i := range v {
+		v[i] = a[i] + b[i]
+	}
+	return v
+}
+
+func scale(a Value, s float64) Value {
+	v := make(Value, len(a))
+	for i := range v {
+		v[i] = a[i] * s
+	}
+	return v
+}
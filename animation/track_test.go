@@ -0,0 +1,116 @@
+package animation
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func near(a, b Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTrackAt(t *testing.T) {
+	var track Track
+	err := json.Unmarshal([]byte(`{"target": "lookFrom", "keyframes": [
+		{"time": 2, "value": {"x": 2, "y": 0, "z": 4}},
+		{"time": 0, "value": [0, 0, 0], "interpolation": "catmull-rom"},
+		{"time": 3, "value": {"x": 3, "y": 1}, "interpolation": "step"},
+		{"time": 4, "value": {"x": 0, "y": 0, "z": 0}}
+	]}`), &track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := track.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		time float64
+		want Value
+	}{
+		{-1, Value{0, 0, 0}},
+		{0, Value{0, 0, 0}},
+		{2, Value{2, 0, 4}},
+		{2.5, Value{2.5, 0.5, 2}},
+		{3.5, Value{3, 1, 0}},
+		{9, Value{0, 0, 0}},
+	} {
+		if got := track.At(tc.time); !near(got, tc.want) {
+			t.Errorf("At(%g) = %v, want %v", tc.time, got, tc.want)
+		}
+	}
+
+	// Bezier handles left out make the Catmull-Rom curve
+	bezier := Track{Target: "x", Keyframes: append([]Keyframe(nil), track.Keyframes...)}
+	bezier.Keyframes[0].Interpolation = "bezier"
+	for _, time := range []float64{0.3, 1, 1.7} {
+		if got, want := bezier.At(time), track.At(time); !near(got, want) {
+			t.Errorf("Bezier at %g is %v, Catmull-Rom %v", time, got, want)
+		}
+	}
+	bezier.Keyframes[0].Out = Value{0, 3, 0}
+	if got := bezier.At(1); !(got[1] > 0.5) {
+		t.Errorf("Bezier handle didn't pull the curve up: %v", got)
+	}
+
+	eased := Track{Target: "vfov", Keyframes: []Keyframe{
+		{Time: 0, Value: Value{0}, Ease: "ease-in"},
+		{Time: 1, Value: Value{1}, Ease: "ease-out"},
+		{Time: 2, Value: Value{2}},
+	}}
+	if err := eased.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := eased.At(0.5)[0]; got != 0.125 {
+		t.Errorf("ease-in at half way is %g, want 0.125", got)
+	}
+	if got := eased.At(1.5)[0]; got != 1.875 {
+		t.Errorf("ease-out at half way is %g, want 1.875", got)
+	}
+
+	for _, bad := range []Track{
+		{Target: "vfov"},
+		{Target: "static[x]", Keyframes: eased.Keyframes},
+		{Target: "vfov", Keyframes: []Keyframe{{Value: Value{1}}, {Time: 1, Value: Value{1, 2, 3}}}},
+		{Target: "vfov", Keyframes: []Keyframe{{Value: Value{1}, Ease: "bounce"}}},
+		{Target: "vfov", Keyframes: []Keyframe{{Value: Value{1}, Interpolation: "cubic"}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%+v is valid", bad)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"Random": false, "static": [
+		{"type": "sphere", "radius": 1, "mat": {"type": "metal", "fuzz": 0}},
+		{"type": "sphere", "radius": 2}
+	]}`)
+	tracks := []Track{
+		{Target: "random", Keyframes: []Keyframe{{Value: Value{1}}}},
+		{Target: "static[1].transform.translate", Keyframes: []Keyframe{{Value: Value{1, 2, 3}}}},
+		{Target: "static[0].mat.fuzz", Keyframes: []Keyframe{{Time: 0, Value: Value{0}}, {Time: 2, Value: Value{1}}}},
+	}
+	var got map[string]interface{}
+	if err := Apply(doc, tracks, 1, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Random":1,"static":[{"mat":{"fuzz":0.5,"type":"metal"},"radius":1,"type":"sphere"},{"radius":2,"transform":{"translate":{"x":1,"y":2,"z":3}},"type":"sphere"}]}`
+	if data, _ := json.Marshal(got); string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	for _, target := range []string{"static[2].radius", "static.radius", "static[0].radius[1]"} {
+		if err := Apply(doc, []Track{{Target: target, Keyframes: []Keyframe{{Value: Value{1}}}}}, 0, &got); err == nil {
+			t.Errorf("setting %s didn't fail", target)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+)
+
+func TestAssembleAnimationReleasesLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	locks := filepath.Join(dir, "locks")
+	if err := os.Mkdir(locks, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { *lockDir = old }(*lockDir)
+	*lockDir = locks
+
+	// Frames that are done but can't be read back
+	name := filepath.Join(dir, "out00000.png")
+	if err := ioutil.WriteFile(name, []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(donePath(name), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, "out.apng")
+	if err := assembleAnimation(fileName, []string{name}, 24, renderer.APNGRenderer{}); err == nil {
+		t.Fatal("animation of frames that can't be read was written")
+	}
+	if files, _ := ioutil.ReadDir(locks); len(files) != 0 {
+		t.Errorf("failing to write the animation left %d locks behind", len(files))
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// aovChannels names the channels of an AOV in EXR layers
+func aovChannels(a tracer.AOV) []string {
+	switch a {
+	case tracer.Depth:
+		return []string{"Z"}
+	case tracer.Normal, tracer.Position:
+		return []string{"X", "Y", "Z"}
+	case tracer.ObjectID, tracer.MaterialID:
+		return []string{"id"}
+	case tracer.SampleCount:
+		return []string{"count"}
+	}
+	return []string{"R", "G", "B"}
+}
+
+// aovLayers returns the given AOVs of the film as EXR layers. Distances keep 32
+// bit floats and IDs are unsigned integers, the rest follows the colors.
+func aovLayers(film *tracer.Film, aovs []tracer.AOV) []renderer.EXRLayer {
+	var layers []renderer.EXRLayer
+	for _, a := range aovs {
+		layers = append(layers, renderer.EXRLayer{
+			Name:     string(a),
+			Channels: aovChannels(a),
+			Film:     film.AOV(a),
+			Float:    a == tracer.Depth || a == tracer.Position,
+			Uint:     a.IsID(),
+		})
+	}
+	return layers
+}
+
+// writeAOVs writes the given AOVs of the film next to fileName as
+// <name>_<aov><ext>. The light goes through r like the image, the rest through
+// data, which shouldn't tone map. EXR and HDR images keep the values as they
+// are, other formats get something that can be looked at.
+func writeAOVs(fileName string, film *tracer.Film, aovs []tracer.AOV, r, data renderer.Renderer) error {
+	fileExt := filepath.Ext(fileName)
+	baseFileName := fileName[:len(fileName)-len(fileExt)]
+	_, exr := data.(renderer.EXRRenderer)
+	_, hdr := data.(renderer.HDRRenderer)
+	for _, a := range aovs {
+		name := fmt.Sprintf("%s_%s%s", baseFileName, a, fileExt)
+		img := film.AOV(a)
+		var err error
+		switch {
+		case a == tracer.Direct || a == tracer.Indirect:
+			err = renderer.WriteFile(name, r, img)
+		case exr:
+			// Halves only count exactly up to 2048
+			e := data.(renderer.EXRRenderer)
+			e.Float = e.Float || a.IsID() || a == tracer.Depth || a == tracer.Position
+			err = renderer.WriteFile(name, e, img)
+		case hdr:
+			err = renderer.WriteFile(name, data, img)
+		default:
+			err = renderer.WriteFile(name, data, visualizeAOV(a, img))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visualizeAOV turns an AOV into colors in [0, 1]. Normals go from -1 and 1 to
+// 0 and 1, distances are scaled by the largest, every ID gets a color of its own
+// and sample counts are shown like the heatmap's scale. The colors are decoded
+// so encoding the image gives them back, albedos are colors already.
+func visualizeAOV(a tracer.AOV, img *renderer.Film) *renderer.Film {
+	lo := vec3.Vec3{X: math.Inf(1), Y: math.Inf(1), Z: math.Inf(1)}
+	hi := vec3.Vec3{X: math.Inf(-1), Y: math.Inf(-1), Z: math.Inf(-1)}
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			v := img.At(x, y)
+			lo = vec3.Vec3{X: math.Min(lo.X, v.X), Y: math.Min(lo.Y, v.Y), Z: math.Min(lo.Z, v.Z)}
+			hi = vec3.Vec3{X: math.Max(hi.X, v.X), Y: math.Max(hi.Y, v.Y), Z: math.Max(hi.Z, v.Z)}
+		}
+	}
+	scale := func(v, lo, hi float64) float64 {
+		if hi <= lo {
+			return 0
+		}
+		return (v - lo) / (hi - lo)
+	}
+	out := renderer.NewFilm(img.Width, img.Height, nil)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			v := img.At(x, y)
+			var c vec3.Color
+			switch a {
+			case tracer.Albedo:
+				out.Set(x, y, v)
+				continue
+			case tracer.Normal:
+				c = vec3.Color{X: v.X/2 + 0.5, Y: v.Y/2 + 0.5, Z: v.Z/2 + 0.5}
+			case tracer.Position:
+				c = vec3.Color{X: scale(v.X, lo.X, hi.X), Y: scale(v.Y, lo.Y, hi.Y), Z: scale(v.Z, lo.Z, hi.Z)}
+			case tracer.Depth, tracer.SampleCount:
+				t := scale(v.X, 0, hi.X)
+				c = vec3.Color{X: t, Y: t, Z: t}
+			case tracer.ObjectID, tracer.MaterialID:
+				c = idColor(int(v.X))
+			}
+			out.Set(x, y, vec3.Color{X: renderer.DecodeSRGB(c.X), Y: renderer.DecodeSRGB(c.Y), Z: renderer.DecodeSRGB(c.Z)})
+		}
+	}
+	return out
+}
+
+// idColor picks a bright color for an ID by hashing it, 0 is black
+func idColor(id int) vec3.Color {
+	if id == 0 {
+		return vec3.Color{}
+	}
+	h := uint32(id) * 2654435761
+	h ^= h >> 15
+	h *= 2246822519
+	h ^= h >> 13
+	return vec3.Color{
+		X: 0.25 + 0.75*float64(h&0xff)/255,
+		Y: 0.25 + 0.75*float64(h>>8&0xff)/255,
+		Z: 0.25 + 0.75*float64(h>>16&0xff)/255,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"math"
 
 	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
 	"github.com/vfrazao-ns1/raytracing1weekend/utils"
 	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
 )
@@ -65,12 +66,42 @@ func InitCamera(lookfrom vec3.Point, lookat vec3.Point, vup vec3.Vec3, vfov, asp
 	return c
 }
 
-// GetRay returns the ray from our camera
-func (c Camera) GetRay(s, t float64) ray.Ray {
-	rd := utils.RandomInUnitDisk().ScalarMul(c.LensRadius)
+// GetRay returns the ray from our camera, smp picks the point on the lens
+func (c Camera) GetRay(s, t float64, smp sampler.Sampler) ray.Ray {
+	rd := sampler.InUnitDisk(smp).ScalarMul(c.LensRadius)
 	offset := c.U.ScalarMul(rd.X).Add(c.V.ScalarMul(rd.Y))
 	return ray.Ray{
 		Origin:    c.Origin.Add(offset),
 		Direction: c.LowerLeft.Add((c.Horizontal.ScalarMul(s))).Add(c.Vertical.ScalarMul(t)).Sub(c.Origin).Sub(offset),
 	}
 }
+
+// SampleLens picks a point on the lens the same way GetRay does
+func (c Camera) SampleLens(smp sampler.Sampler) vec3.Point {
+	rd := sampler.InUnitDisk(smp).ScalarMul(c.LensRadius)
+	return c.Origin.Add(c.U.ScalarMul(rd.X)).Add(c.V.ScalarMul(rd.Y))
+}
+
+// LensArea is the area of the lens, a pinhole camera uses 1 so densities on it stay finite
+func (c Camera) LensArea() float64 {
+	if c.LensRadius == 0 {
+		return 1
+	}
+	return math.Pi * c.LensRadius * c.LensRadius
+}
+
+// Project is the inverse of GetRay: it returns the (s, t) film coordinates of
+// the ray leaving lensPoint towards p, ok is false if p is behind the camera
+func (c Camera) Project(p, lensPoint vec3.Point) (s, t float64, ok bool) {
+	d := p.Sub(lensPoint)
+	forward := c.W.Negate()
+	if d.Dot(forward) <= 0 {
+		return 0, 0, false
+	}
+	// Every ray passes through the plane in focus, which contains LowerLeft
+	k := c.LowerLeft.Sub(lensPoint).Dot(forward) / d.Dot(forward)
+	onPlane := lensPoint.Add(d.ScalarMul(k)).Sub(c.LowerLeft)
+	s = onPlane.Dot(c.Horizontal) / c.Horizontal.LengthSquared()
+	t = onPlane.Dot(c.Vertical) / c.Vertical.LengthSquared()
+	return s, t, true
+}
@@ -0,0 +1,178 @@
+package camera
+
+import (
+	"math"
+	"sort"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// A Rig moves the camera over an animation, t going from 0 at the first frame
+// to 1 at the last. Rigs move at a constant speed.
+type Rig interface {
+	At(t float64) (lookFrom, lookAt vec3.Point)
+}
+
+// Orbit circles Center, looking at it
+type Orbit struct {
+	Center      vec3.Point
+	Axis        vec3.Vec3  // Axis the camera turns about
+	Start       vec3.Vec3  // Start direction from Center the camera starts in, across Axis
+	Radius      float64    // Radius distance from the camera to Center
+	Elevation   float64    // Elevation degrees above the plane across Axis
+	Revolutions float64    // Revolutions over the animation, negative ones go clockwise
+	Target      vec3.Point // Target the camera looks at
+}
+
+// NewOrbit returns an orbit around center about axis, starting from where
+// from is and looking at center
+func NewOrbit(center vec3.Point, axis vec3.Vec3, from vec3.Point, radius, elevation, revolutions float64) Orbit {
+	axis = axis.Unit()
+	start := from.Sub(center)
+	start = start.Sub(axis.ScalarMul(start.Dot(axis)))
+	if start.Length() < 1e-9 {
+		// Looking down the axis, any direction across it will do
+		start = axis.Cross(vec3.Vec3{X: 1, Y: 0, Z: 0})
+		if start.Length() < 1e-9 {
+			start = axis.Cross(vec3.Vec3{X: 0, Y: 0, Z: 1})
+		}
+	}
+	return Orbit{Center: center, Axis: axis, Start: start.Unit(), Radius: radius, Elevation: elevation, Revolutions: revolutions, Target: center}
+}
+
+// At implements `Rig` for Orbit
+func (o Orbit) At(t float64) (lookFrom, lookAt vec3.Point) {
+	angle := 2 * math.Pi * o.Revolutions * t
+	elevation := o.Elevation * math.Pi / 180
+	side := o.Axis.Cross(o.Start)
+	dir := o.Start.ScalarMul(math.Cos(angle)).Add(side.ScalarMul(math.Sin(angle)))
+	offset := dir.ScalarMul(o.Radius * math.Cos(elevation)).Add(o.Axis.ScalarMul(o.Radius * math.Sin(elevation)))
+	return o.Center.Add(offset), o.Target
+}
+
+// Dolly moves the camera in a straight line from From to To, looking the same
+// way all along. Moving sideways it's a truck.
+type Dolly struct {
+	From      vec3.Point
+	To        vec3.Point
+	Direction vec3.Vec3 // Direction the camera looks in
+}
+
+// At implements `Rig` for Dolly
+func (d Dolly) At(t float64) (lookFrom, lookAt vec3.Point) {
+	lookFrom = d.From.Add(d.To.Sub(d.From).ScalarMul(t))
+	return lookFrom, lookFrom.Add(d.Direction)
+}
+
+// FlyThrough flies the camera along a centripetal Catmull-Rom spline through
+// control points, looking at the point of the path LookAhead further along.
+// The spline is measured so the camera covers the same length every frame.
+type FlyThrough struct {
+	points    []vec3.Point
+	lookAhead float64
+	// lengths from the start of the path to the samples at params
+	params  []float64
+	lengths []float64
+}
+
+// flyThroughSamples is how many samples measure every span of the spline
+const flyThroughSamples = 64
+
+// NewFlyThrough returns a fly-through of points, at least two. A lookAhead of
+// 0 looks a tenth of the path ahead.
+func NewFlyThrough(points []vec3.Point, lookAhead float64) *FlyThrough {
+	f := &FlyThrough{points: points}
+	spans := len(points) - 1
+	prev := f.point(0)
+	f.params = append(f.params, 0)
+	f.lengths = append(f.lengths, 0)
+	for i := 1; i <= spans*flyThroughSamples; i++ {
+		u := float64(i) / flyThroughSamples
+		p := f.point(u)
+		f.params = append(f.params, u)
+		f.lengths = append(f.lengths, f.lengths[i-1]+p.Sub(prev).Length())
+		prev = p
+	}
+	f.lookAhead = lookAhead
+	if f.lookAhead <= 0 {
+		f.lookAhead = f.Length() / 10
+	}
+	return f
+}
+
+// Length returns the length of the path
+func (f *FlyThrough) Length() float64 {
+	return f.lengths[len(f.lengths)-1]
+}
+
+// point returns the point of the spline at u, span i going from u = i to i+1
+func (f *FlyThrough) point(u float64) vec3.Point {
+	n := len(f.points)
+	i := int(u)
+	if i >= n-1 {
+		i = n - 2
+	}
+	// The ends are mirrored so the spline reaches them
+	at := func(k int) vec3.Point {
+		switch {
+		case k < 0:
+			return f.points[0].ScalarMul(2).Sub(f.points[1])
+		case k >= n:
+			return f.points[n-1].ScalarMul(2).Sub(f.points[n-2])
+		}
+		return f.points[k]
+	}
+	return centripetal(at(i-1), at(i), at(i+1), at(i+2), u-float64(i))
+}
+
+// centripetal evaluates the centripetal Catmull-Rom span from p1 to p2 at u in
+// [0, 1] (Barry and Goldman's pyramidal formulation), which doesn't overshoot
+// or loop where the points bunch up
+func centripetal(p0, p1, p2, p3 vec3.Point, u float64) vec3.Point {
+	knot := func(t float64, a, b vec3.Point) float64 {
+		return t + math.Max(math.Sqrt(b.Sub(a).Length()), 1e-9)
+	}
+	t0 := 0.0
+	t1 := knot(t0, p0, p1)
+	t2 := knot(t1, p1, p2)
+	t3 := knot(t2, p2, p3)
+	t := t1 + (t2-t1)*u
+	mix := func(a, b vec3.Point, ta, tb float64) vec3.Point {
+		return a.ScalarMul((tb - t) / (tb - ta)).Add(b.ScalarMul((t - ta) / (tb - ta)))
+	}
+	a1 := mix(p0, p1, t0, t1)
+	a2 := mix(p1, p2, t1, t2)
+	a3 := mix(p2, p3, t2, t3)
+	b1 := mix(a1, a2, t0, t2)
+	b2 := mix(a2, a3, t1, t3)
+	return mix(b1, b2, t1, t2)
+}
+
+// pointAtLength returns the point of the path s along it. Points past the end
+// carry on in the direction it ends in.
+func (f *FlyThrough) pointAtLength(s float64) vec3.Point {
+	length := f.Length()
+	if s > length {
+		end := f.point(f.params[len(f.params)-1])
+		dir := end.Sub(f.point(f.params[len(f.params)-2])).Unit()
+		return end.Add(dir.ScalarMul(s - length))
+	}
+	i := sort.SearchFloat64s(f.lengths, s)
+	if i == 0 {
+		return f.point(0)
+	}
+	// Between two samples the spline is close enough to straight that its
+	// parameter goes with the length
+	l0, l1 := f.lengths[i-1], f.lengths[i]
+	u := f.params[i-1]
+	if l1 > l0 {
+		u += (f.params[i] - f.params[i-1]) * (s - l0) / (l1 - l0)
+	}
+	return f.point(u)
+}
+
+// At implements `Rig` for FlyThrough
+func (f *FlyThrough) At(t float64) (lookFrom, lookAt vec3.Point) {
+	s := t * f.Length()
+	return f.pointAtLength(s), f.pointAtLength(s + f.lookAhead)
+}
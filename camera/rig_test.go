@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestOrbit(t *testing.T) {
+	center := vec3.Point{X: 1, Y: 0, Z: 0}
+	o := NewOrbit(center, vec3.Vec3{X: 0, Y: 1, Z: 0}, vec3.Point{X: 1, Y: 5, Z: 3}, 2, 30, 1)
+	for _, at := range []float64{0, 0.25, 0.6, 1} {
+		from, lookAt := o.At(at)
+		if lookAt != center {
+			t.Errorf("at %g the camera looks at %v, want %v", at, lookAt, center)
+		}
+		offset := from.Sub(center)
+		if math.Abs(offset.Length()-2) > 1e-9 {
+			t.Errorf("at %g the camera is %g from the center, want 2", at, offset.Length())
+		}
+		if math.Abs(offset.Y-1) > 1e-9 {
+			t.Errorf("at %g the camera is %g above the center, want 1", at, offset.Y)
+		}
+	}
+	start, _ := o.At(0)
+	end, _ := o.At(1)
+	if start.Sub(end).Length() > 1e-9 || start.Z <= center.Z || math.Abs(start.X-center.X) > 1e-9 {
+		t.Errorf("orbit goes from %v to %v, want it to start and end toward +Z", start, end)
+	}
+}
+
+func TestFlyThrough(t *testing.T) {
+	points := []vec3.Point{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 5, Y: 2, Z: 0}, {X: 6, Y: 2, Z: 3}}
+	f := NewFlyThrough(points, 0)
+	if from, _ := f.At(0); from.Sub(points[0]).Length() > 1e-6 {
+		t.Errorf("fly-through starts at %v, want %v", from, points[0])
+	}
+	if from, _ := f.At(1); from.Sub(points[3]).Length() > 1e-6 {
+		t.Errorf("fly-through ends at %v, want %v", from, points[3])
+	}
+
+	// Moving at a constant speed, every frame covers the same distance
+	const frames = 50
+	step := f.Length() / frames
+	prev, _ := f.At(0)
+	for i := 1; i <= frames; i++ {
+		from, lookAt := f.At(float64(i) / frames)
+		if d := from.Sub(prev).Length(); math.Abs(d-step) > 0.02*step {
+			t.Errorf("frame %d moves %g, want %g", i, d, step)
+		}
+		if d := lookAt.Sub(from).Length(); d < 0.9*f.Length()/10 {
+			t.Errorf("frame %d looks %g ahead, want about %g", i, d, f.Length()/10)
+		}
+		prev = from
+	}
+}
+
+func TestDolly(t *testing.T) {
+	d := Dolly{From: vec3.Point{X: 0, Y: 1, Z: 0}, To: vec3.Point{X: 4, Y: 1, Z: 0}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}}
+	from, lookAt := d.At(0.25)
+	if from != (vec3.Point{X: 1, Y: 1, Z: 0}) || lookAt.Sub(from) != d.Direction {
+		t.Errorf("dolly is at %v looking at %v", from, lookAt)
+	}
+}
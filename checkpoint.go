@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
+)
+
+// checkpoint is a frame that was cut short, with what's needed to tell whether
+// it can be carried on with the current config
+type checkpoint struct {
+	Hash string // Hash of the config and world the frame was being rendered with
+	Seed uint64
+	Film *tracer.Film
+}
+
+// checkpointPath is where the checkpoint of the frame written to fileName goes
+func checkpointPath(fileName string) string {
+	return fileName + ".checkpoint"
+}
+
+// configHash identifies the render settings a checkpoint can be resumed with.
+// The file name is left out since every frame of an animation has its own, and
+// how and how often the images and checkpoints are written since it doesn't
+// change what's rendered.
+func configHash(c config, world []byte) string {
+	c.FileName = ""
+	c.Output = outputConfig{}
+	c.Display = displayConfig{}
+	c.CheckpointEvery = 0
+	c.Progressive = progressiveConfig{Enabled: c.Progressive.Enabled}
+	// Only the AOVs the film holds matter, not how they're written or what the
+	// denoiser makes of them
+	c.AOVs.Layers = false
+	c.Denoise = denoiseConfig{Enabled: c.Denoise.Enabled}
+	c.Animation.Quantizer = ""
+	c.Animation.Dither = false
+	conf, _ := json.Marshal(c)
+	h := sha256.New()
+	h.Write(conf)
+	h.Write(world)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readCheckpoint reads the checkpoint at path
+func readCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cp := new(checkpoint)
+	if err := gob.NewDecoder(f).Decode(cp); err != nil {
+		return nil, fmt.Errorf("decoding checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint writes cp to path. It goes to a temporary file first so a
+// crash while writing leaves the previous checkpoint intact.
+func writeCheckpoint(path string, cp checkpoint) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(cp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigHash(t *testing.T) {
+	base := `{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 16, "fileName": "out.png", "checkpointEvery": 10,
+		"progressive": {"enabled": true, "writeEvery": 4}}`
+	world := []byte(`{"random": true}`)
+	cases := []struct {
+		json string
+		same bool // same whether a checkpoint made with base can be resumed
+	}{
+		{base, true},
+		{`{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 16, "fileName": "out00001.png", "checkpointEvery": 10,
+			"progressive": {"enabled": true, "writeEvery": 4}}`, true},
+		{`{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 16, "fileName": "out.png", "checkpointEvery": 60,
+			"progressive": {"enabled": true, "writeEvery": 4}}`, true},
+		{`{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 16, "fileName": "out.png",
+			"progressive": {"enabled": true, "writeSeconds": 30}}`, true},
+		{`{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 32, "fileName": "out.png", "checkpointEvery": 10,
+			"progressive": {"enabled": true, "writeEvery": 4}}`, false},
+		{`{"imgWidth": 64, "aspect": 2, "samplesPerPixel": 16, "fileName": "out.png", "checkpointEvery": 10}`, false},
+	}
+	var conf config
+	if err := json.Unmarshal([]byte(base), &conf); err != nil {
+		t.Fatal(err)
+	}
+	hash := configHash(conf, world)
+	for _, c := range cases {
+		var other config
+		if err := json.Unmarshal([]byte(c.json), &other); err != nil {
+			t.Fatal(err)
+		}
+		if same := configHash(other, world) == hash; same != c.same {
+			t.Errorf("%s: same hash %v, expected %v", c.json, same, c.same)
+		}
+	}
+	if configHash(conf, []byte(`{"random": false}`)) == hash {
+		t.Error("another world has the same hash")
+	}
+}
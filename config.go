@@ -1,18 +1,66 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/animation"
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
 	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/physics"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
 	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+	"lukechampine.com/frand"
 )
 
 type config struct {
-	FileName        string          // Name of file to save to render
-	ImgWidth        int             // Resolution width
-	Aspect          float64         // Aspect ratio float e.g., 16:9 equals 1.7777777
-	SamplesPerPixel int             // How many rays to simulate hitting a given pixel (higher is better quality)
-	MaxDepth        int             // Max distance a ray will fly
-	Camera          cameraConfig    // Camera config
-	Animation       animationConfig // Whether to make an animation
+	FileName        string            // Name of file to save to render
+	ImgWidth        int               // Resolution width
+	Aspect          float64           // Aspect ratio float e.g., 16:9 equals 1.7777777
+	SamplesPerPixel int               // How many rays to simulate hitting a given pixel (higher is better quality)
+	MaxDepth        int               // Max distance a ray will fly
+	Sampler         string            // One of "independent" (default), "stratified", "halton" or "sobol"
+	Seed            uint64            // Seed for the random world and every sample, 0 picks a new one every run
+	Integrator      integratorConfig  // Which algorithm computes the color of each sample
+	Camera          cameraConfig      // Camera config
+	Animation       animationConfig   // Whether to make an animation
+	Adaptive        adaptiveConfig    // Whether to spend more samples on noisy pixels
+	Progressive     progressiveConfig // Whether to write the image while it's being rendered
+	Tiles           tracer.Tiles      // How the image is split between the workers
+	Filter          filterConfig      // How samples are spread over the pixels around them
+	CheckpointEvery float64           // Seconds between checkpoints of the frame being rendered, 0 disables them
+	Output          outputConfig      // How images are written, the format follows the extension of FileName unless -format is given
+	Display         displayConfig     // How colors are turned into the 8 or 16 bits per component of anything but EXR and HDR images
+	AOVs            aovConfig         // Extra images of what the camera sees, for compositing and debugging
+	Denoise         denoiseConfig     // Whether to smooth the noise out of the image before it's written
+}
+
+type integratorConfig struct {
+	Type          string   // One of "path" (default), "nee", "bdpt", "sppm", "mlt", "ao", "direct" or "whitted"
+	RouletteDepth int      // Bounces after which paths may be terminated early by Russian roulette, 0 disables it
+	Reference     bool     // Use the original recursive RayColor for "path", mostly useful to compare against
+	Samples       int      // Occlusion rays for "ao", sky shadow rays for "direct"
+	Distance      float64  // Max occlusion distance for "ao", 0 means infinite
+	Iterations    int      // Camera + photon passes for "sppm", defaults to 64
+	Photons       int      // Photons shot per iteration for "sppm", defaults to 100000
+	Radius        float64  // Initial photon gather radius for "sppm", defaults to 0.1
+	WriteEvery    int      // Iterations between intermediate images for "sppm" and "mlt", 0 disables them
+	Bootstrap     int      // Paths traced to normalise the image and seed the chains for "mlt"
+	Chains        int      // Markov chains for "mlt", defaults to the number of CPUs
+	Mutations     int      // Mutations per pixel for "mlt", defaults to samplesPerPixel
+	LargeStep     *float64 // Probability of a large step mutation for "mlt", from 0 to 1, defaults to 0.3
+	Sigma         float64  // Standard deviation of small step mutations for "mlt"
 }
 
 type cameraConfig struct {
@@ -27,10 +75,467 @@ type cameraConfig struct {
 type worldConfig struct {
 	Random bool              // Whether to generate a random scene, overides the Static attribute
 	Static objects.Hittables // List of "Hittable" shapes
+	Lights lights.Lights     // List of punctual lights, these are sampled explicitly since rays can't hit them
+	Tracks []animation.Track // Keyframes of properties of the world when animating, like "static[2].mat.fuzz" or "lights[0].position"
+	// Rigid-body simulation of the objects when animating. Objects with a
+	// "velocity" or "mass", or "static": false, move.
+	Physics physicsConfig
+}
+
+type physicsConfig struct {
+	Enabled     bool      // Whether objects fall and bounce when animating
+	Gravity     vec3.Vec3 // Gravity acceleration, 0 is 9.81 down the Y axis
+	Restitution *float64  // Restitution share of the speed objects bounce back with, from 0 to 1, defaults to 0.5
+	TimeStep    float64   // TimeStep seconds simulated at a time, 0 is 1/240
+}
+
+// bodyConfig is what the simulation reads of an object of the world
+type bodyConfig struct {
+	Velocity vec3.Vec3 // Velocity at the start in units per second
+	Mass     float64   // Mass 0 goes by the size of the object
+	Static   *bool     // Static whether the object stays put, by default unless it has a velocity or mass
 }
 
 type animationConfig struct {
-	Enabled  bool // Whether to run in animation mode
-	Fps      int  // Frames per second
-	Duration int  // How long to animate for in seconds
+	Enabled   bool      // Whether to run in animation mode
+	Fps       int       // Frames per second
+	Duration  int       // How long to animate for in seconds
+	Quantizer string    // How the palette of .gif animations is picked, "median-cut" (default) or "octree"
+	Dither    bool      // Whether to dither .gif animations
+	Rig       rigConfig // How the camera moves, keyframes can still change its other parameters
+	// Keyframes of the camera's parameters, like "lookFrom" or "vfov". Without
+	// any, or a rig, the camera orbits the origin.
+	Tracks []animation.Track
+}
+
+type rigConfig struct {
+	Type        string       // One of "orbit", "dolly", "truck", "turntable" or "flythrough", none leaves the camera to the keyframes
+	Center      vec3.Point   // Center "orbit" circles
+	Axis        vec3.Vec3    // Axis "orbit" and "turntable" turn about, defaults to Y
+	Radius      float64      // Radius of "orbit", defaults to the camera's distance from Center
+	Elevation   float64      // Elevation of "orbit" in degrees above the plane across Axis
+	Revolutions float64      // Revolutions of "orbit" and "turntable", defaults to 1
+	From        *vec3.Point  // From where "dolly" and "truck" start, defaults to the camera's LookFrom
+	To          *vec3.Point  // To where "dolly" and "truck" end, they look the way the camera does
+	Object      int          // Object index in the world "turntable" circles at the camera's distance and height
+	Points      []vec3.Point // Points "flythrough" goes through, at least two
+	LookAhead   float64      // LookAhead how far along its path "flythrough" looks, defaults to a tenth of the path
+}
+
+type adaptiveConfig struct {
+	tracer.Adaptive
+	Heatmap bool // Write an image of the samples spent on each pixel next to the render
+}
+
+type progressiveConfig struct {
+	Enabled      bool    // Whether to render one sample per pixel at a time, overwriting the image as it goes
+	WriteEvery   int     // Passes between writes of the image, 0 disables them
+	WriteSeconds float64 // Seconds between writes of the image, 0 disables them
+}
+
+type filterConfig struct {
+	Type   string  // One of "box" (default), "tent", "gaussian", "mitchell" or "lanczos"
+	Radius float64 // Radius in pixels, defaults to 0.5 for "box", 1 for "tent", 1.5 for "gaussian", 2 for "mitchell" and 3 for "lanczos"
+	Sigma  float64 // Standard deviation of "gaussian" in pixels, defaults to 0.5
+	B      float64 // B of "mitchell", B and C both default to 1/3 when neither is set
+	C      float64 // C of "mitchell"
+	Tau    float64 // Lobes of the sinc the window of "lanczos" spans, defaults to 3
+}
+
+type outputConfig struct {
+	BitDepth    int    // Bits per component of PNG and TIFF images, 8 (default) or 16
+	Quality     int    // Quality of JPEG images from 1 to 100, defaults to 90
+	ASCII       bool   // Write PPM images as plain text rather than binary
+	Compression string // Compression of EXR images, one of "zip" (default) or "none"
+	Float       bool   // Write EXR images with 32 bit floats rather than 16 bit halves
+}
+
+type displayConfig struct {
+	Exposure float64 // Exposure in stops, applied before tone mapping
+	ToneMap  string  // One of "none" (default), "reinhard", "extended-reinhard", "hable" or "aces"
+	White    float64 // Luminance that becomes white for "extended-reinhard", defaults to 4, linear value for "hable", defaults to 11.2
+	LUT      string  // Path of a .cube 3D LUT applied to the sRGB encoded colors
+}
+
+type aovConfig struct {
+	Names  []string // Any of "depth", "normal", "albedo", "position", "objectid", "materialid", "direct", "indirect" and "samples"
+	Layers bool     // Write them as layers of the EXR image rather than next to it as <name>_<aov><ext>
+}
+
+type denoiseConfig struct {
+	renderer.Denoiser
+	Enabled   bool // Whether to denoise the image, guided by the albedo, normal and depth AOVs
+	KeepNoisy bool // Also write the image as it was rendered as <name>_noisy<ext>
+}
+
+// due tells whether the image should be written after the given number of
+// passes, the last write having happened at lastWrite
+func (p progressiveConfig) due(passes int, lastWrite time.Time) bool {
+	if !p.Enabled {
+		return false
+	}
+	if p.WriteEvery > 0 && passes%p.WriteEvery == 0 {
+		return true
+	}
+	return p.WriteSeconds > 0 && time.Since(lastWrite).Seconds() >= p.WriteSeconds
+}
+
+// newSampler builds the sampler selected in the config
+func newSampler(c config) (sampler.PixelSampler, error) {
+	return sampler.New(c.Sampler, c.SamplesPerPixel, c.Seed)
+}
+
+// newFilter builds the reconstruction filter selected in the config
+func newFilter(fc filterConfig) (renderer.Filter, error) {
+	radius := func(def float64) float64 {
+		if fc.Radius > 0 {
+			return fc.Radius
+		}
+		return def
+	}
+	switch strings.ToLower(fc.Type) {
+	case "", "box":
+		return renderer.Box{R: radius(0.5)}, nil
+	case "tent":
+		return renderer.Tent{R: radius(1)}, nil
+	case "gaussian":
+		sigma := fc.Sigma
+		if sigma <= 0 {
+			sigma = 0.5
+		}
+		return renderer.Gaussian{R: radius(1.5), Sigma: sigma}, nil
+	case "mitchell":
+		b, c := fc.B, fc.C
+		if b == 0 && c == 0 {
+			b, c = 1.0/3, 1.0/3
+		}
+		return renderer.Mitchell{R: radius(2), B: b, C: c}, nil
+	case "lanczos":
+		tau := fc.Tau
+		if tau <= 0 {
+			tau = 3
+		}
+		return renderer.Lanczos{R: radius(3), Tau: tau}, nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", fc.Type)
+}
+
+// newRig builds the rig moving the camera, nil when there isn't any. Turntables
+// go around an object of world.
+func newRig(rc rigConfig, cam cameraConfig, world objects.HittableList) (camera.Rig, error) {
+	axis := rc.Axis
+	if axis.Length() == 0 {
+		axis = vec3.Vec3{X: 0, Y: 1, Z: 0}
+	}
+	revolutions := rc.Revolutions
+	if revolutions == 0 {
+		revolutions = 1
+	}
+	switch strings.ToLower(rc.Type) {
+	case "":
+		return nil, nil
+	case "orbit":
+		radius := rc.Radius
+		if radius <= 0 {
+			radius = cam.LookFrom.Sub(rc.Center).Length()
+		}
+		if radius == 0 {
+			return nil, errors.New("orbit has no radius, the camera is at its center")
+		}
+		return camera.NewOrbit(rc.Center, axis, cam.LookFrom, radius, rc.Elevation, revolutions), nil
+	case "turntable":
+		if rc.Object < 0 || rc.Object >= len(world.Data) {
+			return nil, fmt.Errorf("turntable object %d isn't in the world of %d", rc.Object, len(world.Data))
+		}
+		center, ok := objects.Center(world.Data[rc.Object])
+		if !ok {
+			return nil, fmt.Errorf("turntable object %d has no center", rc.Object)
+		}
+		// The camera keeps its distance and height
+		offset := cam.LookFrom.Sub(center)
+		radius := offset.Length()
+		if radius == 0 {
+			return nil, errors.New("turntable camera is at the object's center")
+		}
+		elevation := math.Asin(utils.Clamp(offset.Dot(axis.Unit())/radius, -1, 1)) * 180 / math.Pi
+		return camera.NewOrbit(center, axis, cam.LookFrom, radius, elevation, revolutions), nil
+	case "dolly", "truck":
+		if rc.To == nil {
+			return nil, fmt.Errorf("%s has nowhere to go, it needs a \"to\"", rc.Type)
+		}
+		from := cam.LookFrom
+		if rc.From != nil {
+			from = *rc.From
+		}
+		dir := cam.LookAt.Sub(cam.LookFrom)
+		if dir.Length() == 0 {
+			return nil, errors.New("the camera looks nowhere, it's at what it looks at")
+		}
+		return camera.Dolly{From: from, To: *rc.To, Direction: dir}, nil
+	case "flythrough":
+		if len(rc.Points) < 2 {
+			return nil, errors.New("fly-throughs go through at least two points")
+		}
+		f := camera.NewFlyThrough(rc.Points, rc.LookAhead)
+		if f.Length() == 0 {
+			return nil, errors.New("fly-through points are all the same")
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown camera rig %q", rc.Type)
+}
+
+// rigFollowsObject tells whether the rig has to be built again for every frame,
+// which turntables are when keyframes or the simulation move their object
+func rigFollowsObject(rc rigConfig, conf worldConfig, sim *physics.World) bool {
+	if !strings.EqualFold(rc.Type, "turntable") {
+		return false
+	}
+	i := rc.Object
+	prefix := fmt.Sprintf("static[%d]", i)
+	for _, t := range conf.Tracks {
+		if target := strings.ToLower(t.Target); target == prefix || strings.HasPrefix(target, prefix+".") {
+			return true
+		}
+	}
+	return sim != nil && i < len(sim.Bodies) && !sim.Bodies[i].Static
+}
+
+// pickSeed returns the configured seed, or a new random one when there isn't any
+func pickSeed(c config) uint64 {
+	if c.Seed != 0 {
+		return c.Seed
+	}
+	return frand.Uint64n(math.MaxUint64) + 1
+}
+
+// newIntegrator builds the integrator selected in the config
+func newIntegrator(c config) (integrator.Integrator, error) {
+	ic := c.Integrator
+	switch strings.ToLower(ic.Type) {
+	case "", "path":
+		return integrator.Path{MaxDepth: c.MaxDepth, RouletteDepth: ic.RouletteDepth, Reference: ic.Reference}, nil
+	case "nee":
+		return integrator.NEE{MaxDepth: c.MaxDepth, RouletteDepth: ic.RouletteDepth}, nil
+	case "bdpt":
+		return integrator.BDPT{MaxDepth: c.MaxDepth}, nil
+	case "sppm":
+		return integrator.SPPM{
+			MaxDepth:   c.MaxDepth,
+			Iterations: ic.Iterations,
+			Photons:    ic.Photons,
+			Radius:     ic.Radius,
+			WriteEvery: ic.WriteEvery,
+			Seed:       c.Seed,
+		}, nil
+	case "mlt":
+		mutations := ic.Mutations
+		if mutations <= 0 {
+			mutations = c.SamplesPerPixel
+		}
+		if ic.LargeStep != nil && (*ic.LargeStep < 0 || *ic.LargeStep > 1) {
+			return nil, fmt.Errorf("large step probability %g isn't between 0 and 1", *ic.LargeStep)
+		}
+		return integrator.MLT{
+			MaxDepth:   c.MaxDepth,
+			Bootstrap:  ic.Bootstrap,
+			Chains:     ic.Chains,
+			Mutations:  mutations,
+			LargeStep:  ic.LargeStep,
+			Sigma:      ic.Sigma,
+			WriteEvery: ic.WriteEvery,
+			Seed:       c.Seed,
+		}, nil
+	case "ao":
+		return integrator.AmbientOcclusion{Samples: ic.Samples, Distance: ic.Distance}, nil
+	case "direct":
+		return integrator.DirectLighting{MaxDepth: c.MaxDepth, SkySamples: ic.Samples}, nil
+	case "whitted":
+		return integrator.Whitted{MaxDepth: c.MaxDepth}, nil
+	}
+	return nil, fmt.Errorf("unknown integrator type %q", ic.Type)
+}
+
+// parseAOVs returns the AOVs named in the config
+func parseAOVs(ac aovConfig) ([]tracer.AOV, error) {
+	aovs := make([]tracer.AOV, 0, len(ac.Names))
+	seen := make(map[tracer.AOV]bool)
+	for _, name := range ac.Names {
+		a, err := tracer.ParseAOV(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[a] {
+			return nil, fmt.Errorf("AOV %q is listed twice", name)
+		}
+		seen[a] = true
+		aovs = append(aovs, a)
+	}
+	return aovs, nil
+}
+
+// denoiseFeatures are the AOVs the denoiser is guided by
+var denoiseFeatures = []tracer.AOV{tracer.Albedo, tracer.Normal, tracer.Depth}
+
+// renderedAOVs returns the AOVs the film needs, the ones asked for and the
+// features of the denoiser when it's enabled
+func renderedAOVs(aovs []tracer.AOV, dc denoiseConfig) []tracer.AOV {
+	if !dc.Enabled {
+		return aovs
+	}
+	rendered := append([]tracer.AOV(nil), aovs...)
+	for _, f := range denoiseFeatures {
+		missing := true
+		for _, a := range aovs {
+			missing = missing && a != f
+		}
+		if missing {
+			rendered = append(rendered, f)
+		}
+	}
+	return rendered
+}
+
+// newDisplay builds how colors are displayed from the config, reading the LUT
+func newDisplay(dc displayConfig) (renderer.Display, error) {
+	white := func(def float64) float64 {
+		if dc.White > 0 {
+			return dc.White
+		}
+		return def
+	}
+	d := renderer.Display{Exposure: dc.Exposure}
+	switch strings.ToLower(dc.ToneMap) {
+	case "", "none":
+	case "reinhard":
+		d.ToneMapper = renderer.Reinhard{}
+	case "extended-reinhard":
+		d.ToneMapper = renderer.ExtendedReinhard{White: white(4)}
+	case "hable":
+		d.ToneMapper = renderer.Hable{White: white(11.2)}
+	case "aces":
+		d.ToneMapper = renderer.ACES{}
+	default:
+		return d, fmt.Errorf("unknown tone mapper %q", dc.ToneMap)
+	}
+	if dc.LUT != "" {
+		f, err := os.Open(dc.LUT)
+		if err != nil {
+			return d, err
+		}
+		defer f.Close()
+		if d.LUT, err = renderer.ReadCubeLUT(f); err != nil {
+			return d, fmt.Errorf("reading %s: %w", dc.LUT, err)
+		}
+	}
+	return d, nil
+}
+
+// newPhysics builds the simulation of the world read from data, nil when it's
+// disabled
+func newPhysics(conf worldConfig, data []byte) (*physics.World, error) {
+	pc := conf.Physics
+	if !pc.Enabled {
+		return nil, nil
+	}
+	if conf.Random {
+		return nil, errors.New("random worlds don't have physics")
+	}
+	var bodies struct{ Static []bodyConfig }
+	if err := json.Unmarshal(data, &bodies); err != nil {
+		return nil, err
+	}
+	bs := make([]physics.Body, len(conf.Static))
+	for i, obj := range conf.Static {
+		bc := bodies.Static[i]
+		static := bc.Mass == 0 && bc.Velocity == (vec3.Vec3{})
+		if bc.Static != nil {
+			static = *bc.Static
+		}
+		bs[i] = physics.Body{Object: obj, Velocity: bc.Velocity, Mass: bc.Mass, Static: static}
+	}
+	if pc.Gravity == (vec3.Vec3{}) {
+		pc.Gravity = vec3.Vec3{Y: -9.81}
+	}
+	if pc.TimeStep == 0 {
+		pc.TimeStep = 1.0 / 240
+	}
+	restitution := 0.5
+	if pc.Restitution != nil {
+		restitution = *pc.Restitution
+	}
+	if restitution < 0 || restitution > 1 {
+		return nil, fmt.Errorf("restitution %g isn't between 0 and 1", restitution)
+	}
+	return physics.NewWorld(bs, pc.Gravity, restitution, pc.TimeStep)
+}
+
+// placeBodies returns the scene with the objects the simulation moves put where
+// it got them to, keeping what tracks did to them. The scene is left as it is.
+func placeBodies(sim *physics.World, scene *tracer.Scene) *tracer.Scene {
+	placed := append([]objects.Hittable(nil), scene.World.Data...)
+	sim.Place(placed)
+	return &tracer.Scene{World: objects.HittableList{Data: placed}, Lights: scene.Lights}
+}
+
+// newAnimationRenderer builds the renderer of the animation written to
+// fileName, nil when its extension isn't one of an animation and the frames are
+// all there is
+func newAnimationRenderer(ac animationConfig, fileName string) (renderer.AnimationRenderer, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".gif":
+		q, err := renderer.NewQuantizer(ac.Quantizer)
+		if err != nil {
+			return nil, err
+		}
+		return renderer.GIFRenderer{Quantizer: q, Dither: ac.Dither}, nil
+	case ".apng":
+		return renderer.APNGRenderer{}, nil
+	}
+	return nil, nil
+}
+
+// checkFrameFormat rejects formats other than PNG for the frames of animations
+// written by r, which are read back as PNG to be put together. r is nil when
+// the frames are the output, they can be written in any format.
+func checkFrameFormat(format string, r renderer.AnimationRenderer) error {
+	if r == nil || format == "" || strings.ToLower(format) == "png" {
+		return nil
+	}
+	return fmt.Errorf("frames of GIF and APNG animations are written as PNG, not %s", format)
+}
+
+// newRenderer builds the renderer writing images in format, or the format the
+// extension of fileName stands for when it's empty. Files with extensions that
+// don't stand for any are written as PNG.
+func newRenderer(format, fileName string, out outputConfig, display renderer.Display) (renderer.Renderer, error) {
+	fromExt := format == ""
+	if fromExt {
+		format = strings.TrimPrefix(filepath.Ext(fileName), ".")
+	}
+	var r renderer.Renderer
+	switch strings.ToLower(format) {
+	case "ppm":
+		r = renderer.PPMRenderer{Display: display, ASCII: out.ASCII}
+	case "jpg", "jpeg":
+		r = renderer.JPEGRenderer{Display: display, Quality: out.Quality}
+	case "tif", "tiff":
+		r = renderer.TIFFRenderer{Display: display, BitDepth: out.BitDepth}
+	case "exr":
+		r = renderer.EXRRenderer{Compression: out.Compression, Float: out.Float}
+	case "hdr":
+		r = renderer.HDRRenderer{}
+	case "png":
+		r = renderer.PNGRenderer{Display: display, BitDepth: out.BitDepth}
+	default:
+		if !fromExt {
+			return nil, fmt.Errorf("unknown image format %q", format)
+		}
+		r = renderer.PNGRenderer{Display: display, BitDepth: out.BitDepth}
+	}
+	// Settings the renderer doesn't take are caught before anything is rendered
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
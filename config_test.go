@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/animation"
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/physics"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestNewIntegratorLargeStep(t *testing.T) {
+	cases := []struct {
+		json      string
+		largeStep float64 // largeStep given to MLT, -1 when it's left for MLT to default
+		ok        bool
+	}{
+		{`{"type": "mlt"}`, -1, true},
+		{`{"type": "mlt", "largeStep": 0}`, 0, true},
+		{`{"type": "mlt", "largeStep": 1}`, 1, true},
+		{`{"type": "mlt", "largeStep": 0.5}`, 0.5, true},
+		{`{"type": "mlt", "largeStep": -0.1}`, 0, false},
+		{`{"type": "mlt", "largeStep": 1.5}`, 0, false},
+	}
+	for _, c := range cases {
+		var conf config
+		if err := json.Unmarshal([]byte(c.json), &conf.Integrator); err != nil {
+			t.Fatal(err)
+		}
+		integ, err := newIntegrator(conf)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v", c.json, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		largeStep := integ.(integrator.MLT).LargeStep
+		if c.largeStep < 0 {
+			if largeStep != nil {
+				t.Errorf("%s: large step %g, expected the default", c.json, *largeStep)
+			}
+		} else if largeStep == nil || *largeStep != c.largeStep {
+			t.Errorf("%s: large step %v, expected %g", c.json, largeStep, c.largeStep)
+		}
+	}
+}
+
+func TestProgressiveDue(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name      string
+		p         progressiveConfig
+		passes    int
+		lastWrite time.Time
+		expected  bool
+	}{
+		{"disabled", progressiveConfig{WriteEvery: 1, WriteSeconds: 1}, 4, now.Add(-time.Hour), false},
+		{"no triggers", progressiveConfig{Enabled: true}, 4, now.Add(-time.Hour), false},
+		{"every pass", progressiveConfig{Enabled: true, WriteEvery: 1}, 3, now, true},
+		{"on the pass", progressiveConfig{Enabled: true, WriteEvery: 4}, 8, now, true},
+		{"between passes", progressiveConfig{Enabled: true, WriteEvery: 4}, 6, now, false},
+		{"time's up", progressiveConfig{Enabled: true, WriteSeconds: 10}, 1, now.Add(-11 * time.Second), true},
+		{"too soon", progressiveConfig{Enabled: true, WriteSeconds: 10}, 1, now.Add(-5 * time.Second), false},
+		{"pass before time", progressiveConfig{Enabled: true, WriteEvery: 2, WriteSeconds: 10}, 2, now, true},
+		{"time before pass", progressiveConfig{Enabled: true, WriteEvery: 2, WriteSeconds: 10}, 3, now.Add(-11 * time.Second), true},
+		{"neither", progressiveConfig{Enabled: true, WriteEvery: 2, WriteSeconds: 10}, 3, now, false},
+	}
+	for _, c := range cases {
+		if due := c.p.due(c.passes, c.lastWrite); due != c.expected {
+			t.Errorf("%s: due %v, expected %v", c.name, due, c.expected)
+		}
+	}
+}
+
+func TestNewRig(t *testing.T) {
+	cam := cameraConfig{LookFrom: vec3.Point{X: 0, Y: 1, Z: 4}, LookAt: vec3.Point{X: 0, Y: 1, Z: 0}}
+	world := objects.HittableList{Data: []objects.Hittable{
+		objects.Sphere{Center: vec3.Point{X: 0, Y: 1, Z: 0}, Radius: 1},
+		objects.HittableList{},
+	}}
+	cases := []struct {
+		json     string
+		ok       bool
+		from, to vec3.Point // from, to where the camera is at the first and last frames
+	}{
+		{`{}`, true, vec3.Point{}, vec3.Point{}},
+		{`{"type": "orbit", "center": {"x": 0, "y": 1, "z": 0}}`, true, cam.LookFrom, cam.LookFrom},
+		{`{"type": "orbit", "center": {"x": 0, "y": 1, "z": 4}}`, false, vec3.Point{}, vec3.Point{}},
+		{`{"type": "turntable", "object": 0, "revolutions": 0.5}`, true, cam.LookFrom, vec3.Point{X: 0, Y: 1, Z: -4}},
+		{`{"type": "turntable", "object": 2}`, false, vec3.Point{}, vec3.Point{}},
+		{`{"type": "turntable", "object": 1}`, false, vec3.Point{}, vec3.Point{}},
+		{`{"type": "dolly", "to": {"x": 0, "y": 1, "z": 2}}`, true, cam.LookFrom, vec3.Point{X: 0, Y: 1, Z: 2}},
+		// The origin is somewhere to go too
+		{`{"type": "truck", "from": {"x": 0, "y": 0, "z": 0}, "to": {"x": 2, "y": 0, "z": 0}}`, true, vec3.Point{}, vec3.Point{X: 2}},
+		{`{"type": "dolly", "from": {"x": 0, "y": 1, "z": 2}}`, false, vec3.Point{}, vec3.Point{}},
+		{`{"type": "flythrough", "points": [{"x": 0, "y": 0, "z": 0}]}`, false, vec3.Point{}, vec3.Point{}},
+		{`{"type": "crane"}`, false, vec3.Point{}, vec3.Point{}},
+	}
+	for _, c := range cases {
+		var rc rigConfig
+		if err := json.Unmarshal([]byte(c.json), &rc); err != nil {
+			t.Fatal(err)
+		}
+		rig, err := newRig(rc, cam, world)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v", c.json, err)
+			continue
+		}
+		if rig == nil {
+			continue
+		}
+		for i, expected := range []vec3.Point{c.from, c.to} {
+			if from, _ := rig.At(float64(i)); from.Sub(expected).Length() > 1e-9 {
+				t.Errorf("%s: camera at %v at t=%d, want %v", c.json, from, i, expected)
+			}
+		}
+	}
+}
+
+func TestRigFollowsObject(t *testing.T) {
+	turntable := rigConfig{Type: "turntable", Object: 1}
+	sim, err := physics.NewWorld([]physics.Body{
+		{Object: &objects.Sphere{Radius: 1}, Static: true},
+		{Object: &objects.Sphere{Center: vec3.Point{Y: 3}, Radius: 1}},
+	}, vec3.Vec3{Y: -9.81}, 0.5, 1.0/240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks := func(target string) worldConfig {
+		return worldConfig{Tracks: []animation.Track{{Target: target}}}
+	}
+	cases := []struct {
+		name     string
+		rc       rigConfig
+		conf     worldConfig
+		sim      *physics.World
+		expected bool
+	}{
+		{"still", turntable, worldConfig{}, nil, false},
+		{"not a turntable", rigConfig{Type: "orbit", Object: 1}, tracks("static[1].center"), nil, false},
+		{"moved by keyframes", turntable, tracks("static[1].center.x"), nil, true},
+		{"keyframes of its material", turntable, tracks("Static[1].mat.fuzz"), nil, true},
+		{"keyframes of another object", turntable, tracks("static[10].center"), nil, false},
+		{"falling", turntable, worldConfig{}, sim, true},
+		{"on the ground", rigConfig{Type: "turntable", Object: 0}, worldConfig{}, sim, false},
+	}
+	for _, c := range cases {
+		if follows := rigFollowsObject(c.rc, c.conf, c.sim); follows != c.expected {
+			t.Errorf("%s: follows %v, expected %v", c.name, follows, c.expected)
+		}
+	}
+}
+
+func TestNewPhysics(t *testing.T) {
+	world := func(physics string) (worldConfig, []byte) {
+		data := []byte(`{
+			"static": [
+				{"type": "rectangle", "a": {"x": -10, "y": 0, "z": 10}, "w": {"x": 10, "y": 0, "z": 10}, "h": {"x": 0, "y": 0, "z": -20}},
+				{"type": "sphere", "center": {"x": 0, "y": 2, "z": 0}, "radius": 0.5, "velocity": {"x": 1, "y": 0, "z": 0}},
+				{"type": "sphere", "center": {"x": 2, "y": 2, "z": 0}, "radius": 0.5, "mass": 2},
+				{"type": "sphere", "center": {"x": 4, "y": 2, "z": 0}, "radius": 0.5, "static": false},
+				{"type": "sphere", "center": {"x": 6, "y": 2, "z": 0}, "radius": 0.5}
+			],
+			"physics": ` + physics + `
+		}`)
+		var conf worldConfig
+		if err := json.Unmarshal(data, &conf); err != nil {
+			t.Fatal(err)
+		}
+		return conf, data
+	}
+	cases := []struct {
+		physics     string
+		ok          bool
+		restitution float64
+	}{
+		{`{"enabled": true}`, true, 0.5},
+		{`{"enabled": true, "restitution": 0}`, true, 0},
+		{`{"enabled": true, "restitution": 1}`, true, 1},
+		{`{"enabled": true, "restitution": 1.5}`, false, 0},
+		{`{"enabled": true, "timeStep": -1}`, false, 0},
+	}
+	for _, c := range cases {
+		conf, data := world(c.physics)
+		sim, err := newPhysics(conf, data)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v", c.physics, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if sim.Restitution != c.restitution {
+			t.Errorf("%s: restitution %g, expected %g", c.physics, sim.Restitution, c.restitution)
+		}
+		if sim.Gravity != (vec3.Vec3{Y: -9.81}) || sim.TimeStep != 1.0/240 {
+			t.Errorf("%s: gravity %v and time step %g aren't the defaults", c.physics, sim.Gravity, sim.TimeStep)
+		}
+		for i, static := range []bool{true, false, false, false, true} {
+			if sim.Bodies[i].Static != static {
+				t.Errorf("%s: object %d static %v, expected %v", c.physics, i, sim.Bodies[i].Static, static)
+			}
+		}
+	}
+
+	if sim, err := newPhysics(world(`{}`)); sim != nil || err != nil {
+		t.Errorf("physics that aren't enabled: %v, %v", sim, err)
+	}
+	conf, data := world(`{"enabled": true}`)
+	conf.Random = true
+	if _, err := newPhysics(conf, data); err == nil {
+		t.Error("random world has physics")
+	}
+}
+
+func TestPlaceBodies(t *testing.T) {
+	data := []byte(`{"static": [
+		{"type": "sphere", "center": {"x": 0, "y": -100, "z": 0}, "radius": 100},
+		{"type": "sphere", "center": {"x": 0, "y": 2, "z": 0}, "radius": 0.5, "velocity": {"x": 1, "y": 0, "z": 0}}
+	], "physics": {"enabled": true}}`)
+	var conf worldConfig
+	if err := json.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+	sim, err := newPhysics(conf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene := sceneFromConfig(conf, 1)
+	sim.Advance(0.5)
+	placed := placeBodies(sim, scene)
+
+	ground, ball := placed.World.Data[0].(*objects.Sphere), placed.World.Data[1].(*objects.Sphere)
+	if ground.Center != (vec3.Point{X: 0, Y: -100, Z: 0}) {
+		t.Errorf("the ground was moved to %v", ground.Center)
+	}
+	if expected := (vec3.Point{Y: 2}).Add(sim.Bodies[1].Moved()); ball.Center != expected {
+		t.Errorf("ball is at %v, expected %v", ball.Center, expected)
+	}
+	if math.Abs(ball.Center.X-0.5) > 1e-9 || ball.Center.Y >= 2 {
+		t.Errorf("ball didn't fly and fall, it's at %v", ball.Center)
+	}
+	if original := scene.World.Data[1].(*objects.Sphere); original.Center != (vec3.Point{Y: 2}) {
+		t.Errorf("placing moved the scene's ball to %v", original.Center)
+	}
+}
+
+func TestCheckFrameFormat(t *testing.T) {
+	cases := []struct {
+		format string
+		r      renderer.AnimationRenderer
+		ok     bool
+	}{
+		{"", renderer.APNGRenderer{}, true},
+		{"png", renderer.GIFRenderer{}, true},
+		{"PNG", renderer.APNGRenderer{}, true},
+		{"exr", renderer.APNGRenderer{}, false},
+		{"jpeg", renderer.GIFRenderer{}, false},
+		// Frames that are the output
+		{"exr", nil, true},
+	}
+	for _, c := range cases {
+		if err := checkFrameFormat(c.format, c.r); (err == nil) != c.ok {
+			t.Errorf("%q for %T: error %v", c.format, c.r, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"lukechampine.com/frand"
+)
+
+// frameRange selects frames of an animation, from Start to End included, every
+// Step
+type frameRange struct {
+	Start, End, Step int
+}
+
+// parseFrameRange reads a selection like "10:50", "::2" or "100:" of the
+// frames 0 to last. Missing bounds are the first and last frames.
+func parseFrameRange(s string, last int) (frameRange, error) {
+	r := frameRange{Start: 0, End: last, Step: 1}
+	if s == "" {
+		return r, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return r, fmt.Errorf("frames %q aren't start:end or start:end:step", s)
+	}
+	for i, p := range parts {
+		if p == "" {
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("frames %q: %q isn't a frame number", s, p)
+		}
+		switch i {
+		case 0:
+			r.Start = n
+		case 1:
+			r.End = n
+		case 2:
+			r.Step = n
+		}
+	}
+	if r.Step == 0 {
+		return r, fmt.Errorf("frames %q: the step can't be 0", s)
+	}
+	if r.End > last {
+		r.End = last
+	}
+	if r.Start > last {
+		return r, fmt.Errorf("frames %q: there are only frames 0 to %d", s, last)
+	}
+	if r.Start > r.End {
+		return r, fmt.Errorf("frames %q start after they end", s)
+	}
+	return r, nil
+}
+
+// has tells whether frame i is selected
+func (r frameRange) has(i int) bool {
+	return i >= r.Start && i <= r.End && (i-r.Start)%r.Step == 0
+}
+
+// donePath is the marker telling the frame written to fileName is finished.
+// Images are written while they're rendered too, so them being there doesn't
+// say the frame is done.
+func donePath(fileName string) string {
+	return fileName + ".done"
+}
+
+// frameDone tells whether the frame written to fileName is finished
+func frameDone(fileName string) bool {
+	_, err := os.Stat(donePath(fileName))
+	return err == nil
+}
+
+// claimFrame returns the lock of the frame written to fileName, or nil when the
+// frame is skipped because it's already rendered or another process is on it
+func claimFrame(fileName string) (*frameLock, error) {
+	if *lockDir == "" {
+		if *skipExisting && frameDone(fileName) {
+			fmt.Fprintf(os.Stderr, "Skipping %s, it's already rendered\n", fileName)
+			return nil, nil
+		}
+		return &frameLock{}, nil
+	}
+	l, stale, err := lockFrame(*lockDir, fileName)
+	if err == errLocked {
+		fmt.Fprintf(os.Stderr, "Skipping %s, another process is rendering it\n", fileName)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if frameDone(fileName) {
+		fmt.Fprintf(os.Stderr, "Skipping %s, it's already rendered\n", fileName)
+		l.release()
+		return nil, nil
+	}
+	if stale {
+		fmt.Fprintf(os.Stderr, "Taking over %s from a process that stopped\n", fileName)
+	}
+	return l, nil
+}
+
+const (
+	// lockRefresh is how often a process rendering a frame touches its lock
+	lockRefresh = 15 * time.Second
+	// lockStale is how long a lock goes untouched before its process is taken
+	// for dead and the frame is up for grabs
+	lockStale = time.Minute
+)
+
+// frameLock claims a frame for this process in a lock directory shared by all
+// the processes rendering an animation. Without a lock directory it's empty.
+type frameLock struct {
+	path  string
+	owner string // owner what the lock holds, telling it apart from any other process's
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// errLocked is returned when another process holds the lock
+var errLocked = errors.New("locked by another process")
+
+// lockFrame claims the frame written to fileName. Locks other processes have
+// stopped refreshing are taken over, which is reported by stale.
+func lockFrame(dir, fileName string) (l *frameLock, stale bool, err error) {
+	host, _ := os.Hostname()
+	l = &frameLock{
+		path:  filepath.Join(dir, filepath.Base(fileName)+".lock"),
+		owner: fmt.Sprintf("%s %d %x\n", host, os.Getpid(), frand.Bytes(8)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for !stale {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			// Released in the meantime unless it's taken over
+			if stale, err = l.takeOver(); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		_, err = f.WriteString(l.owner)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(l.path)
+			return nil, false, err
+		}
+		break
+	}
+
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(lockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case now := <-ticker.C:
+				if !l.held() {
+					fmt.Fprintf(os.Stderr, "\nAnother process took over %s\n", l.path)
+					return
+				}
+				os.Chtimes(l.path, now, now)
+			}
+		}
+	}()
+	return l, stale, nil
+}
+
+// takeOver replaces a stale lock with l, false when there's no lock to take
+// over anymore. Locks are only ever replaced whole,
+// by renaming a new one over them, and their owner is read back to find out
+// which of the processes all finding the lock stale got it.
+//
+// A process whose lock went stale without it being dead, or that got it just
+// as another found it stale, can end up rendering the frame along with the one
+// that took it over. They render it the same, and neither removes the lock
+// once it isn't theirs.
+func (l *frameLock) takeOver() (bool, error) {
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) < lockStale {
+		return false, errLocked
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return false, err
+	}
+	_, err = tmp.WriteString(l.owner)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	// Another process may have got there between the stat and now
+	if info, err := os.Stat(l.path); err != nil || time.Since(info.ModTime()) < lockStale {
+		os.Remove(tmp.Name())
+		return false, errLocked
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if !l.held() {
+		return false, errLocked
+	}
+	return true, nil
+}
+
+// held tells whether the lock is still this process's
+func (l *frameLock) held() bool {
+	data, err := ioutil.ReadFile(l.path)
+	return err == nil && string(data) == l.owner
+}
+
+// release gives the frame up
+func (l *frameLock) release() {
+	if l.stop == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	if l.held() {
+		os.Remove(l.path)
+	}
+}
+
+// sharedSeed returns the seed all the processes using the lock directory render
+// with, the one the first of them proposed. A seed of 0 proposes a new one.
+func sharedSeed(dir string, seed uint64) (uint64, error) {
+	path := filepath.Join(dir, "seed")
+	if seed == 0 {
+		seed = frand.Uint64n(math.MaxUint64) + 1
+	}
+	// The seed is written to a file of its own and linked into place, so the
+	// seed file is never there without the seed in it, whenever a process dies
+	tmp, err := ioutil.TempFile(dir, "seed.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%d\n", seed)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Link(tmp.Name(), path); err == nil {
+		return seed, nil
+	} else if !os.IsExist(err) {
+		return 0, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	shared, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || shared == 0 {
+		return 0, fmt.Errorf("%s doesn't hold a seed", path)
+	}
+	return shared, nil
+}
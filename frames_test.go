@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseFrameRange(t *testing.T) {
+	cases := []struct {
+		s        string
+		ok       bool
+		expected frameRange
+	}{
+		{"", true, frameRange{0, 100, 1}},
+		{":", true, frameRange{0, 100, 1}},
+		{"10:50", true, frameRange{10, 50, 1}},
+		{"::2", true, frameRange{0, 100, 2}},
+		{"100:", true, frameRange{100, 100, 1}},
+		{":20:5", true, frameRange{0, 20, 5}},
+		// Past the last frame is up to the last frame
+		{"90:200", true, frameRange{90, 100, 1}},
+		{"10", false, frameRange{}},
+		{"1:2:3:4", false, frameRange{}},
+		{"a:10", false, frameRange{}},
+		{"-1:10", false, frameRange{}},
+		{"::0", false, frameRange{}},
+		{"101:", false, frameRange{}},
+		{"50:10", false, frameRange{}},
+	}
+	for _, c := range cases {
+		r, err := parseFrameRange(c.s, 100)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: error %v", c.s, err)
+			continue
+		}
+		if c.ok && r != c.expected {
+			t.Errorf("%q: %+v, expected %+v", c.s, r, c.expected)
+		}
+	}
+}
+
+func TestFrameRangeHas(t *testing.T) {
+	r := frameRange{Start: 3, End: 11, Step: 4}
+	for i := 0; i <= 12; i++ {
+		if expected := i == 3 || i == 7 || i == 11; r.has(i) != expected {
+			t.Errorf("frame %d selected %v, expected %v", i, r.has(i), expected)
+		}
+	}
+}
+
+func TestLockFrame(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "frame00001.png")
+
+	first, stale, err := lockFrame(dir, name)
+	if err != nil || stale {
+		t.Fatalf("first lock: stale %v, error %v", stale, err)
+	}
+	if _, _, err := lockFrame(dir, name); err != errLocked {
+		t.Fatalf("second lock of a held frame: error %v", err)
+	}
+	// Other frames are free
+	other, _, err := lockFrame(dir, filepath.Join(dir, "frame00002.png"))
+	if err != nil {
+		t.Fatalf("lock of another frame: %v", err)
+	}
+	other.release()
+
+	// The first process stops refreshing its lock and it's taken over
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(first.path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	second, stale, err := lockFrame(dir, name)
+	if err != nil || !stale {
+		t.Fatalf("lock of a stale frame: stale %v, error %v", stale, err)
+	}
+	if _, _, err := lockFrame(dir, name); err != errLocked {
+		t.Fatalf("lock of a frame taken over: error %v", err)
+	}
+	// The first process coming back to life doesn't drop the lock it lost
+	first.release()
+	if !second.held() {
+		t.Fatal("lock was released by the process it was taken from")
+	}
+	second.release()
+	if _, err := os.Stat(second.path); !os.IsNotExist(err) {
+		t.Fatalf("lock is still there after it's released: %v", err)
+	}
+	third, stale, err := lockFrame(dir, name)
+	if err != nil || stale {
+		t.Fatalf("lock of a released frame: stale %v, error %v", stale, err)
+	}
+	third.release()
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("locks left %d files behind", len(files))
+	}
+}
+
+func TestLockFrameContention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "frame00001.png")
+
+	// Processes all finding the same stale lock, one of them takes it over
+	for round := 0; round < 50; round++ {
+		dead, _, err := lockFrame(dir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-2 * lockStale)
+		if err := os.Chtimes(dead.path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		locks := make(chan *frameLock, 8)
+		for i := 0; i < cap(locks); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l, _, err := lockFrame(dir, name)
+				if err == nil {
+					locks <- l
+				} else if err != errLocked {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(locks)
+		if len(locks) != 1 {
+			t.Fatalf("round %d: %d processes got the lock", round, len(locks))
+		}
+		(<-locks).release()
+		dead.release()
+	}
+}
+
+func TestFrameDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "frame00001.png")
+
+	// Images are written while they're rendered
+	if err := ioutil.WriteFile(name, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if frameDone(name) {
+		t.Error("frame is done before it's marked done")
+	}
+	if err := ioutil.WriteFile(donePath(name), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !frameDone(name) {
+		t.Error("frame marked done isn't done")
+	}
+}
+
+func TestSharedSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seed, err := sharedSeed(dir, 0)
+	if err != nil || seed == 0 {
+		t.Fatalf("first seed %d, error %v", seed, err)
+	}
+	// Later processes get the first one's seed, whatever they propose
+	for _, proposed := range []uint64{0, 42} {
+		if got, err := sharedSeed(dir, proposed); err != nil || got != seed {
+			t.Errorf("proposing %d got %d, expected %d: %v", proposed, got, seed, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files in the lock directory, expected the seed alone", len(files))
+	}
+
+	// Processes starting together all get the seed one of them proposed
+	for round := 0; round < 20; round++ {
+		dir, err := ioutil.TempDir("", "frames")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		seeds := make([]uint64, 8)
+		var wg sync.WaitGroup
+		for i := range seeds {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var err error
+				if seeds[i], err = sharedSeed(dir, uint64(i+1)); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, s := range seeds {
+			if s != seeds[0] || s == 0 || s > uint64(len(seeds)) {
+				t.Fatalf("round %d: processes got seeds %v", round, seeds)
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// writeHeatmap writes an image of how many samples each pixel got next to the
+// render, going from black for the fewest through red and yellow to white. It's
+// always a PNG, the colors only mean something once displayed.
+func writeHeatmap(fileName string, film *tracer.Film) error {
+	most := 1
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			if n := film.SamplesAt(x, y); n > most {
+				most = n
+			}
+		}
+	}
+	img := renderer.NewFilm(film.Width, film.Height, nil)
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			t := float64(film.SamplesAt(x, y)) / float64(most)
+			c := vec3.Color{
+				X: utils.Clamp(3*t, 0, 1),
+				Y: utils.Clamp(3*t-1, 0, 1),
+				Z: utils.Clamp(3*t-2, 0, 1),
+			}
+			// Decoded so writing the PNG encodes them back to what they are
+			img.Set(x, y, vec3.Color{X: renderer.DecodeSRGB(c.X), Y: renderer.DecodeSRGB(c.Y), Z: renderer.DecodeSRGB(c.Z)})
+		}
+	}
+	fileExt := filepath.Ext(fileName)
+	return renderer.WriteFile(fmt.Sprintf("%s_samples.png", fileName[:len(fileName)-len(fileExt)]), renderer.PNGRenderer{}, img)
+}
@@ -0,0 +1,45 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// AmbientOcclusion shades the first hit by how much of the hemisphere above it
+// is not blocked by other geometry, ignoring materials and lights entirely
+type AmbientOcclusion struct {
+	Samples  int     // Samples number of occlusion rays per camera ray
+	Distance float64 // Distance max distance at which geometry occludes, 0 means infinite
+}
+
+// Li implements `Integrator` for AmbientOcclusion
+func (ao AmbientOcclusion) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	if !scene.World.Hit(r, tmin, math.Inf(1), hitRec) {
+		return vec3.Color{X: 1, Y: 1, Z: 1}
+	}
+
+	samples := ao.Samples
+	if samples < 1 {
+		samples = 1
+	}
+	distance := ao.Distance
+	if distance <= 0 {
+		distance = math.Inf(1)
+	}
+
+	// Cosine weighted directions, so the fraction of unblocked rays is the estimate
+	unoccluded := 0
+	for i := 0; i < samples; i++ {
+		wi := hitRec.Normal.Add(sampler.UnitVector(smp)).Unit()
+		if lights.Unoccluded(scene.World, hitRec.P, wi, distance) {
+			unoccluded++
+		}
+	}
+	visibility := float64(unoccluded) / float64(samples)
+	return vec3.Color{X: visibility, Y: visibility, Z: visibility}
+}
@@ -0,0 +1,75 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// AOVSample is what a camera ray hit first, and how the light it brought back
+// splits into direct and indirect light
+type AOVSample struct {
+	Hit      bool       // Hit whether the ray hit anything, the rest is left at 0 when it didn't
+	Depth    float64    // Depth distance to the hit
+	Position vec3.Point // Position of the hit in world space
+	Normal   vec3.Vec3  // Normal of the surface hit, facing the ray
+	Albedo   vec3.Color // Albedo color of the material hit, the sky's color when nothing was
+	Object   int        // Object index of the object hit in the world
+	Material objects.Material
+	// Direct light that hit at most one surface on its way to the camera,
+	// Indirect the rest. Only integrators implementing AOVIntegrator fill them.
+	Direct   vec3.Color
+	Indirect vec3.Color
+}
+
+// An AOVIntegrator is an Integrator that fills in an AOVSample as it goes
+type AOVIntegrator interface {
+	Integrator
+	LiAOV(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord, aov *AOVSample) vec3.Color
+}
+
+// FirstHit fills in what r hits first, leaving the light alone. It's how other
+// integrators get their AOVs, at the cost of tracing the camera ray twice.
+func FirstHit(r ray.Ray, scene *Scene, hitRec *objects.HitRecord, aov *AOVSample) {
+	if scene.World.Hit(r, tmin, math.Inf(1), hitRec) {
+		aov.recordHit(r, *hitRec)
+	} else {
+		aov.recordMiss(r)
+	}
+}
+
+func (a *AOVSample) recordHit(r ray.Ray, rec objects.HitRecord) {
+	if a == nil {
+		return
+	}
+	a.Hit = true
+	a.Depth = rec.T * r.Direction.Length()
+	a.Position = rec.P
+	a.Normal = rec.Normal
+	a.Albedo = rec.Material.Color()
+	a.Object = rec.Object
+	a.Material = rec.Material
+}
+
+func (a *AOVSample) recordMiss(r ray.Ray) {
+	if a == nil {
+		return
+	}
+	a.Albedo = Background(r)
+}
+
+// addLight adds light that bounced off the given number of surfaces on its way
+// to the camera, weighted by the path throughput
+func (a *AOVSample) addLight(c vec3.Color, surfaces int) {
+	if a == nil {
+		return
+	}
+	if surfaces <= 1 {
+		a.Direct = a.Direct.Add(c)
+	} else {
+		a.Indirect = a.Indirect.Add(c)
+	}
+}
@@ -0,0 +1,440 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// BDPT is a bidirectional path tracer, it follows pbrt's implementation closely.
+// For every camera sample it traces a subpath from the camera and one from a
+// randomly picked light, then connects every vertex of one to every vertex of
+// the other, weighting each of these strategies with multiple importance sampling.
+// Connections from light subpaths straight to the camera (light tracing) land
+// on other pixels so they are splatted onto the film, they are what resolves
+// caustics seen on diffuse surfaces.
+//
+// Only Emitters take part in the bidirectional strategies. The sky and
+// directional lights can only be found from the camera side, by escaping rays
+// and shadow rays respectively, so those contributions are not weighted.
+type BDPT struct {
+	MaxDepth int // MaxDepth max number of bounces of a full path
+}
+
+// Li implements `Integrator` for BDPT. Without a film there's nowhere to put
+// light tracing contributions, so those strategies are left out of the weights.
+func (b BDPT) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return b.LiSplat(r, scene, nil, nil, smp, hitRec)
+}
+
+// LiSplat implements `Splatter` for BDPT
+func (b BDPT) LiSplat(r ray.Ray, scene *Scene, cam *camera.Camera, film *renderer.SplatFilm, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	st := newBDPTState(scene, cam, film, smp)
+	radiance := vec3.Color{X: 0, Y: 0, Z: 0}
+
+	camPath := st.cameraSubpath(r, b.MaxDepth+2, hitRec, &radiance)
+	lightPath := st.lightSubpath(b.MaxDepth+1, hitRec)
+
+	for t := 1; t <= len(camPath); t++ {
+		for s := 1; s <= len(lightPath); s++ {
+			depth := s + t - 2
+			if depth < 0 || depth > b.MaxDepth || (s == 1 && t == 1) {
+				continue
+			}
+			if t == 1 {
+				st.splatToCamera(lightPath, s)
+				continue
+			}
+			radiance = radiance.Add(st.connect(camPath, lightPath, s, t))
+		}
+	}
+	return radiance
+}
+
+type vertexKind int
+
+const (
+	cameraVertex vertexKind = iota
+	lightVertex
+	surfaceVertex
+)
+
+// vertex is a single point of a camera or light subpath
+type vertex struct {
+	kind   vertexKind
+	p      vec3.Point
+	n      vec3.Vec3         // n surface normal facing the previous vertex, zero for lights and the camera
+	rIn    ray.Ray           // rIn ray that reached this vertex
+	rec    objects.HitRecord // rec hit record of surface vertices
+	brdf   objects.BRDF      // brdf nil for specular surfaces, which can't be connected to
+	light  lights.Emitter    // light of light vertices
+	beta   vec3.Color        // beta throughput of the subpath up to this vertex
+	delta  bool              // delta whether the vertex scatters in a single direction
+	pdfFwd float64           // pdfFwd area density of sampling this vertex from the previous one
+	pdfRev float64           // pdfRev area density of sampling this vertex from the next one
+}
+
+// connectible checks whether a deterministic connection can be made to v
+func (v vertex) connectible() bool {
+	return v.kind != surfaceVertex || v.brdf != nil
+}
+
+// bdptState holds what one sample needs to know about the scene, camera and film
+type bdptState struct {
+	scene       *Scene
+	cam         *camera.Camera
+	film        *renderer.SplatFilm
+	smp         sampler.Sampler
+	emitters    []lights.Emitter
+	farLights   []lights.Light // farLights lights that can't emit subpaths, only found with shadow rays
+	filmArea    float64        // filmArea area of the film at distance 1 from the lens
+	lightPick   float64        // lightPick probability of choosing any one emitter
+	lightTracer bool           // lightTracer whether paths can be connected to the camera
+}
+
+func newBDPTState(scene *Scene, cam *camera.Camera, film *renderer.SplatFilm, smp sampler.Sampler) *bdptState {
+	st := &bdptState{scene: scene, cam: cam, film: film, smp: smp, lightTracer: cam != nil && film != nil}
+	for _, l := range scene.Lights {
+		if e, ok := l.(lights.Emitter); ok {
+			st.emitters = append(st.emitters, e)
+		} else {
+			st.farLights = append(st.farLights, l)
+		}
+	}
+	if len(st.emitters) > 0 {
+		st.lightPick = 1 / float64(len(st.emitters))
+	}
+	if st.lightTracer {
+		// Pixels are sampled with u in [0, width/(width-1)) so the film is a bit wider than the viewport
+		w, h := float64(film.Width), float64(film.Height)
+		st.filmArea = cam.ViewPortWidth * cam.ViewPortHeight * w / (w - 1) * h / (h - 1)
+	}
+	return st
+}
+
+// pickEmitter picks one of the emitters uniformly
+func (st *bdptState) pickEmitter() lights.Emitter {
+	i := int(st.smp.Get1D() * float64(len(st.emitters)))
+	if i >= len(st.emitters) {
+		i = len(st.emitters) - 1
+	}
+	return st.emitters[i]
+}
+
+// cameraSubpath traces a subpath starting with the camera ray r. The sky and
+// lights that can't emit subpaths are added to radiance along the way.
+func (st *bdptState) cameraSubpath(r ray.Ray, maxVertices int, hitRec *objects.HitRecord, radiance *vec3.Color) []vertex {
+	path := make([]vertex, 0, maxVertices)
+	path = append(path, vertex{kind: cameraVertex, p: r.Origin, beta: vec3.Color{X: 1, Y: 1, Z: 1}})
+	pdfDir := 1.0
+	if st.lightTracer {
+		pdfDir = st.cameraPdfDir(r.Direction)
+	}
+	return st.randomWalk(r, vec3.Color{X: 1, Y: 1, Z: 1}, pdfDir, maxVertices, path, hitRec, radiance)
+}
+
+// lightSubpath traces a subpath starting at a randomly picked emitter
+func (st *bdptState) lightSubpath(maxVertices int, hitRec *objects.HitRecord) []vertex {
+	if len(st.emitters) == 0 || maxVertices == 0 {
+		return nil
+	}
+	light := st.pickEmitter()
+	r, le, pdfPos, pdfDir := light.SampleLe(st.smp)
+	if pdfPos == 0 || pdfDir == 0 || isBlack(le) {
+		return nil
+	}
+	path := make([]vertex, 0, maxVertices)
+	path = append(path, vertex{kind: lightVertex, p: r.Origin, light: light, beta: le, pdfFwd: pdfPos * st.lightPick})
+	beta := le.ScalarDiv(st.lightPick * pdfPos * pdfDir)
+	return st.randomWalk(r, beta, pdfDir, maxVertices, path, hitRec, nil)
+}
+
+// randomWalk extends path by following r until it escapes or path is full.
+// pdfDir is the solid angle density r was sampled with. Only camera subpaths
+// pass radiance, that's where the sky and far lights are accumulated.
+func (st *bdptState) randomWalk(r ray.Ray, beta vec3.Color, pdfDir float64, maxVertices int, path []vertex, hitRec *objects.HitRecord, radiance *vec3.Color) []vertex {
+	var scattered ray.Ray
+	var attenuation vec3.Color
+	tmax := math.Inf(1)
+	for len(path) < maxVertices {
+		if !st.scene.World.Hit(r, tmin, tmax, hitRec) {
+			if radiance != nil {
+				*radiance = radiance.Add(beta.Mul(Background(r)))
+			}
+			break
+		}
+
+		prev := len(path) - 1
+		v := vertex{kind: surfaceVertex, p: hitRec.P, n: hitRec.Normal, rIn: r, rec: *hitRec, beta: beta}
+		v.brdf, _ = hitRec.Material.(objects.BRDF)
+		v.delta = v.brdf == nil
+		v.pdfFwd = convertDensity(pdfDir, path[prev], v)
+		if radiance != nil && v.brdf != nil {
+			*radiance = radiance.Add(beta.Mul(st.farLight(v)))
+		}
+		path = append(path, v)
+		if len(path) == maxVertices {
+			break
+		}
+
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, st.smp) {
+			break
+		}
+		// Specular bounces have no density to speak of, MIS treats them separately
+		pdfDir = 0
+		pdfRev := 0.0
+		if v.brdf != nil {
+			pdfDir = v.brdf.PDF(r, v.rec, scattered.Direction)
+			pdfRev = v.brdf.PDF(r, v.rec, r.Direction.Negate())
+		}
+		path[prev].pdfRev = convertDensity(pdfRev, v, path[prev])
+		beta = beta.Mul(attenuation)
+		r = scattered
+	}
+	return path
+}
+
+// farLight adds the lights that can't start a light subpath, there's only one
+// way of finding them so they need no weighting
+func (st *bdptState) farLight(v vertex) vec3.Color {
+	total := vec3.Color{X: 0, Y: 0, Z: 0}
+	for _, light := range st.farLights {
+		wi, dist, li := light.Sample(v.p)
+		cosTheta := v.n.Dot(wi)
+		if cosTheta <= 0 || !lights.Unoccluded(st.scene.World, v.p, wi, dist) {
+			continue
+		}
+		total = total.Add(v.brdf.Eval(v.rIn, v.rec, wi).Mul(li).ScalarMul(cosTheta))
+	}
+	return total
+}
+
+// connect joins the first t vertices of the camera subpath with the first s of
+// the light subpath, s == 1 samples a new point on a light instead
+func (st *bdptState) connect(camPath, lightPath []vertex, s, t int) vec3.Color {
+	black := vec3.Color{X: 0, Y: 0, Z: 0}
+	pt := camPath[t-1]
+	if !pt.connectible() {
+		return black
+	}
+
+	var sampled vertex
+	var l vec3.Color
+	if s == 1 {
+		light := st.pickEmitter()
+		wi, dist, li := light.Sample(pt.p)
+		if isBlack(li) {
+			return black
+		}
+		sampled = vertex{
+			kind:   lightVertex,
+			p:      pt.p.Add(wi.ScalarMul(dist)),
+			light:  light,
+			beta:   li.ScalarDiv(st.lightPick),
+			pdfFwd: st.lightPick,
+		}
+		l = pt.beta.Mul(st.f(pt, sampled)).Mul(sampled.beta).ScalarMul(math.Abs(pt.n.Dot(wi)))
+		if isBlack(l) || !lights.Unoccluded(st.scene.World, pt.p, wi, dist) {
+			return black
+		}
+	} else {
+		qs := lightPath[s-1]
+		if !qs.connectible() {
+			return black
+		}
+		l = qs.beta.Mul(st.f(qs, pt)).Mul(st.f(pt, qs)).Mul(pt.beta)
+		if isBlack(l) {
+			return black
+		}
+		d := pt.p.Sub(qs.p)
+		dist := d.Length()
+		w := d.ScalarDiv(dist)
+		if !lights.Unoccluded(st.scene.World, qs.p, w, dist) {
+			return black
+		}
+		g := math.Abs(qs.n.Dot(w)) * math.Abs(pt.n.Dot(w)) / (dist * dist)
+		l = l.ScalarMul(g)
+	}
+	return l.ScalarMul(st.misWeight(camPath, lightPath, sampled, s, t))
+}
+
+// splatToCamera connects the end of the first s vertices of the light subpath
+// to a point on the lens and splats the result on the film
+func (st *bdptState) splatToCamera(lightPath []vertex, s int) {
+	qs := lightPath[s-1]
+	if !st.lightTracer || !qs.connectible() {
+		return
+	}
+	lens := st.cam.SampleLens(st.smp)
+	d := lens.Sub(qs.p)
+	dist := d.Length()
+	wi := d.ScalarDiv(dist)
+	cosTheta := wi.Negate().Dot(st.cam.W.Negate())
+	if cosTheta <= 0 {
+		return
+	}
+	u, v, ok := st.cam.Project(qs.p, lens)
+	if !ok {
+		return
+	}
+
+	// Importance emitted by the camera towards qs and the density of sampling the lens point
+	lensArea := st.cam.LensArea()
+	we := 1 / (st.filmArea * lensArea * math.Pow(cosTheta, 4))
+	pdf := dist * dist / (cosTheta * lensArea)
+	sampled := vertex{kind: cameraVertex, p: lens, beta: vec3.Color{X: we / pdf, Y: we / pdf, Z: we / pdf}}
+
+	l := qs.beta.Mul(st.f(qs, sampled)).Mul(sampled.beta).ScalarMul(math.Abs(qs.n.Dot(wi)))
+	if isBlack(l) || !lights.Unoccluded(st.scene.World, qs.p, wi, dist) {
+		return
+	}
+	st.film.Splat(u, v, l.ScalarMul(st.misWeight([]vertex{sampled}, lightPath, sampled, s, 1)))
+}
+
+// f evaluates the BRDF at surface vertex v for light going towards next
+func (st *bdptState) f(v, next vertex) vec3.Color {
+	wi := next.p.Sub(v.p).Unit()
+	if v.brdf == nil || v.n.Dot(wi) <= 0 {
+		return vec3.Color{X: 0, Y: 0, Z: 0}
+	}
+	return v.brdf.Eval(v.rIn, v.rec, wi)
+}
+
+// cameraPdfDir is the solid angle density of the camera generating a ray along w
+func (st *bdptState) cameraPdfDir(w vec3.Vec3) float64 {
+	cosTheta := w.Unit().Dot(st.cam.W.Negate())
+	if cosTheta <= 0 {
+		return 0
+	}
+	return 1 / (st.filmArea * cosTheta * cosTheta * cosTheta)
+}
+
+// pdf is the area density of v sampling next, prev is where the path arrived at v from
+func (st *bdptState) pdf(v vertex, prev *vertex, next vertex) float64 {
+	switch v.kind {
+	case cameraVertex:
+		if !st.lightTracer {
+			return 0
+		}
+		return convertDensity(st.cameraPdfDir(next.p.Sub(v.p)), v, next)
+	case lightVertex:
+		_, pdfDir := v.light.PdfLe(next.p.Sub(v.p))
+		return convertDensity(pdfDir, v, next)
+	}
+	if v.brdf == nil {
+		return 0
+	}
+	rIn := v.rIn
+	if prev != nil {
+		rIn = ray.Ray{Origin: prev.p, Direction: v.p.Sub(prev.p)}
+	}
+	return convertDensity(v.brdf.PDF(rIn, v.rec, next.p.Sub(v.p)), v, next)
+}
+
+// misVertex is the part of a vertex that the MIS weight depends on
+type misVertex struct {
+	pdfFwd float64
+	pdfRev float64
+	delta  bool
+}
+
+// misWeight computes the power heuristic weight of the strategy (s, t) against
+// every other strategy that could have generated the same path
+func (st *bdptState) misWeight(camPath, lightPath []vertex, sampled vertex, s, t int) float64 {
+	if s+t == 2 {
+		return 1
+	}
+
+	// The connection changes the reverse densities of the vertices next to it,
+	// work on copies of the densities so the subpaths can be reused
+	cam := make([]misVertex, t)
+	for i := 0; i < t; i++ {
+		cam[i] = misVertex{camPath[i].pdfFwd, camPath[i].pdfRev, camPath[i].delta}
+	}
+	light := make([]misVertex, s)
+	for i := 0; i < s; i++ {
+		light[i] = misVertex{lightPath[i].pdfFwd, lightPath[i].pdfRev, lightPath[i].delta}
+	}
+
+	pt := camPath[t-1]
+	if t == 1 {
+		pt = sampled
+		cam[0] = misVertex{sampled.pdfFwd, sampled.pdfRev, false}
+	}
+	qs := lightPath[s-1]
+	if s == 1 {
+		qs = sampled
+		light[0] = misVertex{sampled.pdfFwd, sampled.pdfRev, false}
+	}
+	var ptMinus, qsMinus *vertex
+	if t > 1 {
+		ptMinus = &camPath[t-2]
+	}
+	if s > 1 {
+		qsMinus = &lightPath[s-2]
+	}
+
+	cam[t-1].delta = false
+	light[s-1].delta = false
+	cam[t-1].pdfRev = st.pdf(qs, qsMinus, pt)
+	if ptMinus != nil {
+		cam[t-2].pdfRev = st.pdf(pt, &qs, *ptMinus)
+	}
+	light[s-1].pdfRev = st.pdf(pt, ptMinus, qs)
+	if qsMinus != nil {
+		light[s-2].pdfRev = st.pdf(qs, &pt, *qsMinus)
+	}
+
+	sumRi := 0.0
+	ri := 1.0
+	for i := t - 1; i > 0; i-- {
+		ri *= remap0(cam[i].pdfRev) / remap0(cam[i].pdfFwd)
+		if cam[i].delta || cam[i-1].delta || (i == 1 && !st.lightTracer) {
+			continue
+		}
+		sumRi += ri
+	}
+	ri = 1
+	for i := s - 1; i >= 0; i-- {
+		ri *= remap0(light[i].pdfRev) / remap0(light[i].pdfFwd)
+		// Every emitter is a delta light, they can't be hit so there's no s == 0 strategy
+		deltaLight := i == 0 || light[i-1].delta
+		if light[i].delta || deltaLight {
+			continue
+		}
+		sumRi += ri
+	}
+	return 1 / (1 + sumRi)
+}
+
+// convertDensity turns a solid angle density at from into an area density at to
+func convertDensity(pdf float64, from, to vertex) float64 {
+	w := to.p.Sub(from.p)
+	distSq := w.LengthSquared()
+	if distSq == 0 {
+		return 0
+	}
+	pdf /= distSq
+	if to.kind == surfaceVertex {
+		pdf *= math.Abs(to.n.Dot(w.ScalarDiv(math.Sqrt(distSq))))
+	}
+	return pdf
+}
+
+// remap0 maps densities of 0 (from delta vertices) to 1 so they cancel out in the ratios
+func remap0(f float64) float64 {
+	if f == 0 {
+		return 1
+	}
+	return f
+}
+
+func isBlack(c vec3.Color) bool {
+	return c.X == 0 && c.Y == 0 && c.Z == 0
+}
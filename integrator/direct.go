@@ -0,0 +1,51 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// DirectLighting only computes light that reaches a diffuse surface straight
+// from a light or the sky, there is no indirect bounce light. Specular surfaces
+// are followed until they reach a diffuse one so mirrors and glass still work.
+type DirectLighting struct {
+	MaxDepth   int // MaxDepth max number of specular bounces
+	SkySamples int // SkySamples number of shadow rays towards the sky per diffuse hit
+}
+
+// Li implements `Integrator` for DirectLighting
+func (d DirectLighting) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	throughput := vec3.Color{X: 1, Y: 1, Z: 1}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+
+	tmax := math.Inf(1)
+	for depth := 0; depth < d.MaxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, tmax, hitRec) {
+			return throughput.Mul(Background(r))
+		}
+
+		if brdf, ok := hitRec.Material.(objects.BRDF); ok {
+			radiance := directLight(r, *hitRec, scene)
+			if d.SkySamples > 0 {
+				sky := vec3.Color{X: 0, Y: 0, Z: 0}
+				for i := 0; i < d.SkySamples; i++ {
+					sky = sky.Add(sampleSky(r, *hitRec, brdf, scene, false, smp))
+				}
+				radiance = radiance.Add(sky.ScalarDiv(float64(d.SkySamples)))
+			}
+			return throughput.Mul(radiance)
+		}
+
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			break
+		}
+		throughput = throughput.Mul(attenuation)
+		r = scattered
+	}
+	return vec3.Color{X: 0, Y: 0, Z: 0}
+}
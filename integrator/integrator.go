@@ -0,0 +1,91 @@
+package integrator
+
+import (
+	"context"
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+const (
+	tmin = 0.001 // tmin ignores hits right at the ray origin (shadow acne)
+)
+
+// Scene is everything an integrator needs to know about the world
+type Scene struct {
+	World  objects.HittableList // World the shapes that rays can hit
+	Lights lights.Lights        // Lights punctual lights, which can only be sampled explicitly
+}
+
+// Integrator computes how much light arrives at the camera along a ray.
+// Implementations must be safe to use from several workers at once, any
+// scratch state lives in the HitRecord each worker passes in.
+type Integrator interface {
+	Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color
+}
+
+// A Splatter is an Integrator that also adds light to pixels other than the one
+// being sampled, so it needs the camera to find which pixel that is
+type Splatter interface {
+	Integrator
+	LiSplat(r ray.Ray, scene *Scene, cam *camera.Camera, film *renderer.SplatFilm, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color
+}
+
+// An ImageIntegrator renders the whole image at once rather than sample by
+// sample. progress is called after every iteration, with a snapshot of the
+// image so far when an intermediate image is due and nil otherwise. When ctx is
+// cancelled it stops after the current iteration and returns the image so far.
+type ImageIntegrator interface {
+	Integrator
+	Render(ctx context.Context, scene *Scene, cam *camera.Camera, width, height int, progress func(iteration, iterations int, snapshot *renderer.Film)) *renderer.Film
+}
+
+// Background is the color of the sky seen by rays that don't hit anything
+func Background(r ray.Ray) vec3.Color {
+	unitDirection := r.Direction.Unit()
+	t := 0.5 * (unitDirection.Y + 1.0)
+	return vec3.Color{X: 1, Y: 1, Z: 1}.ScalarMul(1 - t).Add(vec3.Color{X: 0.5, Y: 0.7, Z: 1}.ScalarMul(t))
+}
+
+// directLight sums the light arriving at the hit point from every punctual light that isn't in shadow
+func directLight(r ray.Ray, rec objects.HitRecord, scene *Scene) vec3.Color {
+	total := vec3.Color{X: 0, Y: 0, Z: 0}
+	brdf, ok := rec.Material.(objects.BRDF)
+	if !ok {
+		return total
+	}
+	for _, light := range scene.Lights {
+		wi, dist, li := light.Sample(rec.P)
+		cosTheta := rec.Normal.Dot(wi)
+		if cosTheta <= 0 {
+			continue
+		}
+		if !lights.Unoccluded(scene.World, rec.P, wi, dist) {
+			continue
+		}
+		total = total.Add(brdf.Eval(r, rec, wi).Mul(li).ScalarMul(cosTheta))
+	}
+	return total
+}
+
+// skyVisible checks whether a ray leaving p in direction wi escapes to the sky
+func skyVisible(scene *Scene, p vec3.Point, wi vec3.Vec3) bool {
+	return lights.Unoccluded(scene.World, p, wi, math.Inf(1))
+}
+
+// powerHeuristic is Veach's multiple importance sampling weight (with beta = 2)
+// for a sample drawn from the strategy with density pdfA
+func powerHeuristic(pdfA, pdfB float64) float64 {
+	a := pdfA * pdfA
+	b := pdfB * pdfB
+	if a+b == 0 {
+		return 0
+	}
+	return a / (a + b)
+}
@@ -0,0 +1,260 @@
+package integrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/internal/scenetest"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func testScene() *Scene {
+	return &Scene{World: scenetest.World(), Lights: scenetest.Lights()}
+}
+
+func TestTraceRayMatchesReference(t *testing.T) {
+	scene := testScene()
+	rays := []ray.Ray{
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}},
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: -0.3, Z: -1}},
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: 0, Z: -1}},
+	}
+	samples := 20000
+	maxDepth := 50
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	for _, r := range rays {
+		reference := scenetest.MeanColor(samples, func() vec3.Color { return RayColor(r, scene, maxDepth, smp, hr) })
+		iterative := scenetest.MeanColor(samples, func() vec3.Color { return TraceRay(r, scene, maxDepth, 0, smp, hr) })
+		roulette := scenetest.MeanColor(samples, func() vec3.Color { return TraceRay(r, scene, maxDepth, 3, smp, hr) })
+		if !scenetest.ColorsClose(reference, iterative, 0.02) {
+			t.Errorf("Iterative integrator diverges from reference: expected=%v actual=%v", reference, iterative)
+		}
+		if !scenetest.ColorsClose(reference, roulette, 0.02) {
+			t.Errorf("Russian roulette integrator diverges from reference: expected=%v actual=%v", reference, roulette)
+		}
+	}
+}
+
+func TestNEEMatchesPath(t *testing.T) {
+	scene := testScene()
+	rays := []ray.Ray{
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}},
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: -0.3, Z: -1}},
+	}
+	samples := 20000
+	path := Path{MaxDepth: 50}
+	nee := NEE{MaxDepth: 50}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	for _, r := range rays {
+		expected := scenetest.MeanColor(samples, func() vec3.Color { return path.Li(r, scene, smp, hr) })
+		actual := scenetest.MeanColor(samples, func() vec3.Color { return nee.Li(r, scene, smp, hr) })
+		if !scenetest.ColorsClose(expected, actual, 0.02) {
+			t.Errorf("NEE integrator diverges from path tracer: expected=%v actual=%v", expected, actual)
+		}
+	}
+}
+
+func TestBDPTMatchesPath(t *testing.T) {
+	scene := testScene()
+	scene.Lights = append(scene.Lights, lights.DirectionalLight{
+		Direction: vec3.Vec3{X: -1, Y: -1, Z: 0},
+		Color:     vec3.Color{X: 1, Y: 1, Z: 1},
+		Intensity: 0.5,
+	})
+	rays := []ray.Ray{
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0, Y: 0, Z: -1}},
+		{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: -0.3, Z: -1}},
+	}
+	samples := 20000
+	path := Path{MaxDepth: 50}
+	bdpt := BDPT{MaxDepth: 50}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	for _, r := range rays {
+		expected := scenetest.MeanColor(samples, func() vec3.Color { return path.Li(r, scene, smp, hr) })
+		actual := scenetest.MeanColor(samples, func() vec3.Color { return bdpt.Li(r, scene, smp, hr) })
+		if !scenetest.ColorsClose(expected, actual, 0.02) {
+			t.Errorf("BDPT integrator diverges from path tracer: expected=%v actual=%v", expected, actual)
+		}
+	}
+}
+
+func TestBDPTLightTracingMatchesPath(t *testing.T) {
+	// Light tracing connects light subpaths to the camera, which only happens
+	// with a film to splat on. Closed in by a diffuse sphere all the light is
+	// the point light's, and light tracing carries enough of it for splats
+	// that are off by a third to show.
+	scene := testScene()
+	scene.World.Add(objects.Sphere{Radius: 4, Mat: objects.Lambertian{Albedo: vec3.Color{X: 0.5, Y: 0.5, Z: 0.5}}})
+	cam := camera.InitCamera(vec3.Point{X: 0, Y: 0, Z: 1}, vec3.Point{X: 0, Y: 0, Z: -1}, vec3.Vec3{X: 0, Y: 1, Z: 0}, 120, 2, 0, 1)
+	width, height := 32, 16
+	samples := 256 * width * height
+	path := Path{MaxDepth: 5}
+	bdpt := BDPT{MaxDepth: 5}
+	film := renderer.NewSplatFilm(width, height)
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+
+	// Halves of the image, so splats landing on the wrong side show
+	var expected, actual [2]vec3.Color
+	for i := 0; i < samples; i++ {
+		// Same film coordinates as the workers, which go slightly past 1
+		u := smp.Get1D() * float64(width) / float64(width-1)
+		v := smp.Get1D() * float64(height) / float64(height-1)
+		half := int(u * float64(width-1) / float64(width/2))
+		r := cam.GetRay(u, v, smp)
+		expected[half] = expected[half].Add(path.Li(r, scene, smp, hr))
+		actual[half] = actual[half].Add(bdpt.LiSplat(r, scene, cam, film, smp, hr))
+	}
+	splatted := vec3.Color{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// A pixel is the mean of its samples plus what was splatted on it
+			// over the samples per pixel, so splats count like samples do
+			actual[x/(width/2)] = actual[x/(width/2)].Add(film.At(x, y))
+			splatted = splatted.Add(film.At(x, y))
+		}
+	}
+	total := expected[0].Add(expected[1])
+	if share := splatted.X / total.X; share < 0.05 {
+		t.Fatalf("light tracing carries %.0f%% of the light, too little to be tested", 100*share)
+	}
+	for half := range expected {
+		e, a := expected[half].ScalarDiv(float64(samples/2)), actual[half].ScalarDiv(float64(samples/2))
+		if !scenetest.ColorsClose(e, a, 0.02*e.Length()) {
+			t.Errorf("BDPT with light tracing diverges from path tracer in half %d: expected=%v actual=%v", half, e, a)
+		}
+	}
+}
+
+func TestMLTMatchesPath(t *testing.T) {
+	scene := testScene()
+	scene.World.Add(objects.Sphere{Radius: 4, Mat: objects.Lambertian{Albedo: vec3.Color{X: 0.5, Y: 0.5, Z: 0.5}}})
+	cam := scenetest.Camera(2)
+	width, height := 32, 16
+	samples := 64
+	path := Path{MaxDepth: 50}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	expected := scenetest.MeanColor(samples*width*height, func() vec3.Color {
+		// Same film coordinates as the workers, which go slightly past 1
+		u := smp.Get1D() * float64(width) / float64(width-1)
+		v := smp.Get1D() * float64(height) / float64(height-1)
+		r := cam.GetRay(u, v, smp)
+		return path.Li(r, scene, smp, hr)
+	})
+
+	mlt := MLT{MaxDepth: 50, Bootstrap: 20000, Chains: 16, Mutations: samples}
+	actual := vec3.Color{}
+	img := mlt.Render(context.Background(), scene, cam, width, height, nil)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			actual = actual.Add(img.At(x, y))
+		}
+	}
+	actual = actual.ScalarDiv(float64(width * height))
+	if !scenetest.ColorsClose(expected, actual, 0.02) {
+		t.Errorf("MLT integrator diverges from path tracer: expected=%+v actual=%+v", expected, actual)
+	}
+}
+
+func TestMLTLargeStep(t *testing.T) {
+	if m := (MLT{}).withDefaults(); *m.LargeStep != defaultLargeStep {
+		t.Errorf("MLT without a large step probability has %g, expected %g", *m.LargeStep, defaultLargeStep)
+	}
+	// Small steps only
+	zero := 0.0
+	if m := (MLT{LargeStep: &zero}).withDefaults(); *m.LargeStep != 0 {
+		t.Errorf("MLT large step probability 0 became %g", *m.LargeStep)
+	}
+}
+
+func TestSPPMMatchesPath(t *testing.T) {
+	// Closed in so that all the light comes from the point light, which photons
+	// reach much more easily than the sky
+	scene := testScene()
+	scene.World.Add(objects.Sphere{Radius: 4, Mat: objects.Lambertian{Albedo: vec3.Color{X: 0.5, Y: 0.5, Z: 0.5}}})
+	cam := scenetest.Camera(2)
+	width, height := 32, 16
+	path := Path{MaxDepth: 5}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	expected := scenetest.MeanColor(64*width*height, func() vec3.Color {
+		u := smp.Get1D() * float64(width) / float64(width-1)
+		v := smp.Get1D() * float64(height) / float64(height-1)
+		r := cam.GetRay(u, v, smp)
+		return path.Li(r, scene, smp, hr)
+	})
+
+	sppm := SPPM{MaxDepth: 5, Iterations: 32, Photons: 20000, Seed: 1}
+	actual := vec3.Color{}
+	img := sppm.Render(context.Background(), scene, cam, width, height, nil)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			actual = actual.Add(img.At(x, y))
+		}
+	}
+	actual = actual.ScalarDiv(float64(width * height))
+	if !scenetest.ColorsClose(expected, actual, 0.05*expected.Length()) {
+		t.Errorf("SPPM integrator diverges from path tracer: expected=%+v actual=%+v", expected, actual)
+	}
+}
+
+func TestSPPMDefaults(t *testing.T) {
+	// Left out, the passes and photons mustn't leave an empty image
+	pm := SPPM{MaxDepth: 5}.withDefaults()
+	if pm.Iterations <= 0 || pm.Photons <= 0 || pm.Radius <= 0 {
+		t.Errorf("SPPM defaults render nothing: %+v", pm)
+	}
+}
+
+func TestKDTreeQuery(t *testing.T) {
+	photons := make([]photon, 2000)
+	for i := range photons {
+		photons[i] = photon{p: utils.RandomVec3Between(-1, 1)}
+	}
+	center := vec3.Point{X: 0.1, Y: -0.2, Z: 0.3}
+	radius := 0.25
+	expected := 0
+	for _, ph := range photons {
+		if ph.p.Sub(center).Length() <= radius {
+			expected++
+		}
+	}
+
+	tree := buildKDTree(photons)
+	actual := 0
+	tree.query(center, radius, func(ph *photon) { actual++ })
+	if actual != expected {
+		t.Errorf("Wrong number of photons within radius: expected=%d actual=%d", expected, actual)
+	}
+}
+
+func BenchmarkRayColor(b *testing.B) {
+	scene := testScene()
+	r := ray.Ray{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: -0.3, Z: -1}}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	for n := 0; n < b.N; n++ {
+		RayColor(r, scene, 50, smp, hr)
+	}
+}
+
+func BenchmarkTraceRayRoulette(b *testing.B) {
+	scene := testScene()
+	r := ray.Ray{Origin: vec3.Point{X: 0, Y: 0, Z: 1}, Direction: vec3.Vec3{X: 0.5, Y: -0.3, Z: -1}}
+	hr := new(objects.HitRecord)
+	smp := sampler.Independent{}
+	for n := 0; n < b.N; n++ {
+		TraceRay(r, scene, 50, 3, smp, hr)
+	}
+}
@@ -0,0 +1,111 @@
+package integrator
+
+import (
+	"sort"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// photon is a packet of light that landed on a diffuse surface
+type photon struct {
+	p    vec3.Point // p where the photon landed
+	wi   vec3.Vec3  // wi unit direction the photon came from
+	beta vec3.Color // beta power carried by the photon
+}
+
+// kdTree is a balanced kd-tree of photons stored implicitly in a slice: the
+// photon in the middle of every range splits it along axes[middle]
+type kdTree struct {
+	photons []photon
+	axes    []uint8
+}
+
+// buildKDTree builds the tree in place, reordering photons
+func buildKDTree(photons []photon) *kdTree {
+	t := &kdTree{photons: photons, axes: make([]uint8, len(photons))}
+	t.build(0, len(photons))
+	return t
+}
+
+func (t *kdTree) build(lo, hi int) {
+	if hi-lo <= 1 {
+		return
+	}
+	// Split along the axis the photons are most spread out on
+	min, max := t.photons[lo].p, t.photons[lo].p
+	for _, ph := range t.photons[lo+1 : hi] {
+		for axis := 0; axis < 3; axis++ {
+			c := component(ph.p, axis)
+			if c < component(min, axis) {
+				setComponent(&min, axis, c)
+			}
+			if c > component(max, axis) {
+				setComponent(&max, axis, c)
+			}
+		}
+	}
+	extent := max.Sub(min)
+	axis := 0
+	if extent.Y > extent.X {
+		axis = 1
+	}
+	if extent.Z > component(extent, axis) {
+		axis = 2
+	}
+
+	section := t.photons[lo:hi]
+	sort.Slice(section, func(i, j int) bool {
+		return component(section[i].p, axis) < component(section[j].p, axis)
+	})
+	mid := (lo + hi) / 2
+	t.axes[mid] = uint8(axis)
+	t.build(lo, mid)
+	t.build(mid+1, hi)
+}
+
+// query calls fn for every photon within radius of p
+func (t *kdTree) query(p vec3.Point, radius float64, fn func(*photon)) {
+	t.queryRange(0, len(t.photons), p, radius*radius, fn)
+}
+
+func (t *kdTree) queryRange(lo, hi int, p vec3.Point, radiusSq float64, fn func(*photon)) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	ph := &t.photons[mid]
+	if ph.p.Sub(p).LengthSquared() <= radiusSq {
+		fn(ph)
+	}
+	axis := int(t.axes[mid])
+	d := component(p, axis) - component(ph.p, axis)
+	near, far := [2]int{lo, mid}, [2]int{mid + 1, hi}
+	if d > 0 {
+		near, far = far, near
+	}
+	t.queryRange(near[0], near[1], p, radiusSq, fn)
+	if d*d <= radiusSq {
+		t.queryRange(far[0], far[1], p, radiusSq, fn)
+	}
+}
+
+func component(v vec3.Vec3, axis int) float64 {
+	switch axis {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	}
+	return v.Z
+}
+
+func setComponent(v *vec3.Vec3, axis int, c float64) {
+	switch axis {
+	case 0:
+		v.X = c
+	case 1:
+		v.Y = c
+	default:
+		v.Z = c
+	}
+}
@@ -0,0 +1,321 @@
+package integrator
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"runtime"
+	"sort"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+	"lukechampine.com/frand"
+)
+
+const (
+	defaultBootstrap = 100000 // defaultBootstrap paths used to estimate the image brightness
+	defaultLargeStep = 0.3    // defaultLargeStep probability of a large step mutation
+	defaultSigma     = 0.01   // defaultSigma standard deviation of small step mutations
+	defaultChains    = 64     // defaultChains fixed rather than one per CPU so renders can be reproduced anywhere
+)
+
+// MLT is primary sample space Metropolis light transport (Kelemen et al.). A
+// path traced with Path is fully determined by the random numbers it consumes,
+// so instead of mutating the path itself the chains mutate those numbers: small
+// steps nudge every number a little to explore around a bright path (a caustic
+// seen in a mirror, light through a keyhole) and large steps pick brand new ones
+// so the whole image still gets covered.
+//
+// The chains only know about relative brightness, the absolute level comes from
+// the Bootstrap paths traced up front.
+type MLT struct {
+	MaxDepth   int      // MaxDepth max number of bounces
+	Bootstrap  int      // Bootstrap paths traced to normalise the image and seed the chains
+	Chains     int      // Chains number of Markov chains run in parallel
+	Mutations  int      // Mutations per pixel, this plays the role of samples per pixel
+	LargeStep  *float64 // LargeStep probability of a mutation picking brand new numbers, nil for the default
+	Sigma      float64  // Sigma standard deviation of the small step mutations
+	WriteEvery int      // WriteEvery mutations per pixel between intermediate images, 0 disables them
+	Seed       uint64   // Seed every random number of the render is derived from
+}
+
+// Li implements `Integrator` for MLT. The chains need the whole image so on its
+// own this is just the path tracer, see Render.
+func (m MLT) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return TraceRay(r, scene, m.MaxDepth, 0, smp, hitRec)
+}
+
+// mltChain is the state of one Markov chain between mutations
+type mltChain struct {
+	smp     *mltSampler
+	rng     *frand.RNG // rng decides whether mutations are accepted
+	s, t    float64    // s, t film coordinates of the current path
+	current vec3.Color // current radiance carried by the current path
+	hitRec  *objects.HitRecord
+}
+
+// Render implements `ImageIntegrator` for MLT
+func (m MLT) Render(ctx context.Context, scene *Scene, cam *camera.Camera, width, height int, progress func(iteration, iterations int, snapshot *renderer.Film)) *renderer.Film {
+	m = m.withDefaults()
+	numWorkers := runtime.NumCPU()
+	film := renderer.NewSplatFilm(width, height)
+
+	// Each bootstrap path gets its own seed so the chains can replay it later,
+	// the chains get theirs from a second key
+	key := utils.SeedBytes(m.Seed)
+	chainKey := utils.SeedBytes(m.Seed)
+	chainKey[8] = 1
+	weights := make([]float64, m.Bootstrap)
+	parallel(numWorkers, m.Bootstrap, func(i int) {
+		smp := newMLTSampler(deriveSeed(key, i), m.Sigma, *m.LargeStep)
+		_, _, l := m.sampleL(scene, cam, width, height, smp, new(objects.HitRecord))
+		weights[i] = luminance(l)
+	})
+	cdf := make([]float64, m.Bootstrap)
+	sum := 0.0
+	for i, w := range weights {
+		sum += w
+		cdf[i] = sum
+	}
+	if sum == 0 {
+		return m.image(film, 0)
+	}
+	b := sum / float64(m.Bootstrap)
+
+	chains := make([]mltChain, m.Chains)
+	parallel(numWorkers, m.Chains, func(c int) {
+		rng := frand.NewCustom(deriveSeed(chainKey, c), 1024, 12)
+		i := sort.SearchFloat64s(cdf, rng.Float64()*sum)
+		if i >= m.Bootstrap {
+			i = m.Bootstrap - 1
+		}
+		chain := mltChain{
+			smp:    newMLTSampler(deriveSeed(key, i), m.Sigma, *m.LargeStep),
+			rng:    rng,
+			hitRec: new(objects.HitRecord),
+		}
+		chain.s, chain.t, chain.current = m.sampleL(scene, cam, width, height, chain.smp, chain.hitRec)
+		chains[c] = chain
+	})
+
+	// Every iteration runs one mutation per pixel spread over the chains
+	pixels := width * height
+	for iter := 1; iter <= m.Mutations; iter++ {
+		if ctx.Err() != nil {
+			return m.image(film, iter-1)
+		}
+		parallel(numWorkers, m.Chains, func(c int) {
+			count := pixels / m.Chains
+			if c < pixels%m.Chains {
+				count++
+			}
+			for k := 0; k < count; k++ {
+				m.mutate(&chains[c], scene, cam, film, b)
+			}
+		})
+
+		var snapshot *renderer.Film
+		if iter == m.Mutations || (m.WriteEvery > 0 && iter%m.WriteEvery == 0) {
+			snapshot = m.image(film, iter)
+		}
+		if progress != nil {
+			progress(iter, m.Mutations, snapshot)
+		}
+		if iter == m.Mutations {
+			return snapshot
+		}
+	}
+	return m.image(film, 0)
+}
+
+// mutate proposes a new path for the chain and splats both the current and the
+// proposed one, weighted by how likely each is to be kept (the expected value
+// technique, which wastes nothing on rejected proposals)
+func (m MLT) mutate(chain *mltChain, scene *Scene, cam *camera.Camera, film *renderer.SplatFilm, b float64) {
+	chain.smp.startIteration()
+	s, t, proposed := m.sampleL(scene, cam, film.Width, film.Height, chain.smp, chain.hitRec)
+	currentY := luminance(chain.current)
+	proposedY := luminance(proposed)
+	accept := 1.0
+	if currentY > 0 {
+		accept = math.Min(1, proposedY/currentY)
+	}
+	if accept > 0 && proposedY > 0 {
+		film.Splat(s, t, proposed.ScalarMul(accept*b/proposedY))
+	}
+	if currentY > 0 {
+		film.Splat(chain.s, chain.t, chain.current.ScalarMul((1-accept)*b/currentY))
+	}
+
+	if chain.rng.Float64() < accept {
+		chain.s, chain.t, chain.current = s, t, proposed
+		chain.smp.accept()
+	} else {
+		chain.smp.reject()
+	}
+}
+
+// sampleL traces a path entirely from the numbers in smp. The first two pick
+// where on the film the path starts, which is returned with its radiance.
+func (m MLT) sampleL(scene *Scene, cam *camera.Camera, width, height int, smp sampler.Sampler, hitRec *objects.HitRecord) (float64, float64, vec3.Color) {
+	s, t := smp.Get2D()
+	s *= float64(width) / float64(width-1)
+	t *= float64(height) / float64(height-1)
+	r := cam.GetRay(s, t, smp)
+	return s, t, TraceRay(r, scene, m.MaxDepth, 0, smp, hitRec)
+}
+
+// image averages what was splatted over the given number of mutations per pixel
+func (m MLT) image(film *renderer.SplatFilm, mutations int) *renderer.Film {
+	img := renderer.NewFilm(film.Width, film.Height, nil)
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			color := vec3.Color{X: 0, Y: 0, Z: 0}
+			if mutations > 0 {
+				color = film.At(x, y).ScalarDiv(float64(mutations))
+			}
+			img.Set(x, y, color)
+		}
+	}
+	return img
+}
+
+// withDefaults fills in any setting left at its zero value, or left out for
+// LargeStep which can be 0 for small steps only
+func (m MLT) withDefaults() MLT {
+	if m.Bootstrap <= 0 {
+		m.Bootstrap = defaultBootstrap
+	}
+	if m.Chains <= 0 {
+		m.Chains = defaultChains
+	}
+	if m.Mutations <= 0 {
+		m.Mutations = 1
+	}
+	if m.LargeStep == nil {
+		largeStep := defaultLargeStep
+		m.LargeStep = &largeStep
+	}
+	if m.Sigma <= 0 {
+		m.Sigma = defaultSigma
+	}
+	return m
+}
+
+// luminance is the brightness of c as perceived by the eye
+func luminance(c vec3.Color) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
+
+// deriveSeed derives the i-th seed from key, like the seed of a bootstrap path
+func deriveSeed(key []byte, i int) []byte {
+	seed := make([]byte, len(key))
+	copy(seed, key)
+	binary.LittleEndian.PutUint64(seed[len(seed)-8:], uint64(i))
+	return seed
+}
+
+// primarySample is one of the numbers in a path's primary sample vector
+type primarySample struct {
+	value        float64
+	lastModified int // lastModified iteration the value last changed in
+	valueBackup  float64
+	modifyBackup int
+}
+
+// mltSampler hands out the numbers of the current point in primary sample
+// space. Numbers are only mutated when a path asks for them, so paths of
+// different lengths can share the same vector: a number that wasn't used for a
+// while catches up on all the small steps it missed at once.
+type mltSampler struct {
+	rng           *frand.RNG
+	sigma         float64
+	largeStepProb float64
+	x             []primarySample
+	iteration     int
+	largeStep     bool
+	lastLargeStep int // lastLargeStep iteration of the last accepted large step
+	index         int // index of the next number handed out
+}
+
+// newMLTSampler creates a sampler whose initial numbers are fully determined by seed
+func newMLTSampler(seed []byte, sigma, largeStepProb float64) *mltSampler {
+	return &mltSampler{
+		rng:           frand.NewCustom(seed, 1024, 12),
+		sigma:         sigma,
+		largeStepProb: largeStepProb,
+		largeStep:     true,
+	}
+}
+
+// Get1D implements `sampler.Sampler` for mltSampler
+func (s *mltSampler) Get1D() float64 {
+	i := s.index
+	s.index++
+	s.ensureReady(i)
+	return s.x[i].value
+}
+
+// Get2D implements `sampler.Sampler` for mltSampler
+func (s *mltSampler) Get2D() (float64, float64) {
+	return s.Get1D(), s.Get1D()
+}
+
+// startIteration starts a new mutation, the next path traced sees the mutated numbers
+func (s *mltSampler) startIteration() {
+	s.iteration++
+	s.largeStep = s.rng.Float64() < s.largeStepProb
+	s.index = 0
+}
+
+// accept keeps the mutated numbers
+func (s *mltSampler) accept() {
+	if s.largeStep {
+		s.lastLargeStep = s.iteration
+	}
+}
+
+// reject goes back to the numbers from before the mutation
+func (s *mltSampler) reject() {
+	for i := range s.x {
+		if s.x[i].lastModified == s.iteration {
+			s.x[i].value = s.x[i].valueBackup
+			s.x[i].lastModified = s.x[i].modifyBackup
+		}
+	}
+	s.iteration--
+}
+
+// ensureReady applies the current mutation to number i
+func (s *mltSampler) ensureReady(i int) {
+	for len(s.x) <= i {
+		s.x = append(s.x, primarySample{})
+	}
+	xi := &s.x[i]
+
+	// A large step was accepted since this number was last used, so its value is
+	// stale and is replaced by a fresh one
+	if xi.lastModified < s.lastLargeStep {
+		xi.value = s.rng.Float64()
+		xi.lastModified = s.lastLargeStep
+	}
+
+	xi.valueBackup = xi.value
+	xi.modifyBackup = xi.lastModified
+	if s.largeStep {
+		xi.value = s.rng.Float64()
+	} else {
+		// The sum of n normal steps is a single normal step sqrt(n) times wider
+		n := float64(s.iteration - xi.lastModified)
+		u := math.Max(2*s.rng.Float64()-1, -1+1e-12)
+		normal := math.Sqrt2 * math.Erfinv(u)
+		xi.value += normal * s.sigma * math.Sqrt(n)
+		xi.value -= math.Floor(xi.value)
+	}
+	xi.lastModified = s.iteration
+}
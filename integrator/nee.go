@@ -0,0 +1,107 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// skyPDF is the density of sampleHemisphere, uniform over the hemisphere
+const skyPDF = 1 / (2 * math.Pi)
+
+// NEE is a path tracer with next event estimation. Besides the punctual lights,
+// at every diffuse bounce the sky is sampled directly with a shadow ray. The sky
+// can also be found by the scattered ray so both estimates are combined with
+// multiple importance sampling.
+type NEE struct {
+	MaxDepth      int // MaxDepth max number of bounces
+	RouletteDepth int // RouletteDepth bounces before Russian roulette may end a path, 0 disables it
+}
+
+// Li implements `Integrator` for NEE
+func (n NEE) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return n.LiAOV(r, scene, smp, hitRec, nil)
+}
+
+// LiAOV implements `AOVIntegrator` for NEE, aov may be nil
+func (n NEE) LiAOV(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord, aov *AOVSample) vec3.Color {
+	radiance := vec3.Color{X: 0, Y: 0, Z: 0}
+	throughput := vec3.Color{X: 1, Y: 1, Z: 1}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+	// brdfPDF is the density with which the last bounce picked r, 0 after specular bounces
+	brdfPDF := 0.0
+
+	tmax := math.Inf(1)
+	for depth := 0; depth < n.MaxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, tmax, hitRec) {
+			if depth == 0 {
+				aov.recordMiss(r)
+			}
+			weight := 1.0
+			if brdfPDF > 0 {
+				weight = powerHeuristic(brdfPDF, skyPDF)
+			}
+			sky := throughput.Mul(Background(r)).ScalarMul(weight)
+			aov.addLight(sky, depth)
+			return radiance.Add(sky)
+		}
+		if depth == 0 {
+			aov.recordHit(r, *hitRec)
+		}
+
+		direct := throughput.Mul(directLight(r, *hitRec, scene))
+		aov.addLight(direct, depth+1)
+		radiance = radiance.Add(direct)
+		brdf, diffuse := hitRec.Material.(objects.BRDF)
+		if diffuse {
+			sky := throughput.Mul(sampleSky(r, *hitRec, brdf, scene, true, smp))
+			aov.addLight(sky, depth+1)
+			radiance = radiance.Add(sky)
+		}
+
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			return radiance
+		}
+		brdfPDF = 0
+		if diffuse {
+			brdfPDF = brdf.PDF(r, *hitRec, scattered.Direction)
+		}
+		throughput = throughput.Mul(attenuation)
+
+		if !survivesRoulette(&throughput, depth, n.RouletteDepth, smp) {
+			return radiance
+		}
+		r = scattered
+	}
+	return radiance
+}
+
+// sampleHemisphere picks a direction uniformly on the hemisphere around normal
+func sampleHemisphere(normal vec3.Vec3, smp sampler.Sampler) vec3.Vec3 {
+	w := sampler.UnitVector(smp)
+	if w.Dot(normal) < 0 {
+		return w.Negate()
+	}
+	return w
+}
+
+// sampleSky estimates the light arriving from the sky at a diffuse hit with a
+// single shadow ray. When mis is set the estimate is weighted against the
+// chance of the BRDF sampling the same direction.
+func sampleSky(r ray.Ray, rec objects.HitRecord, brdf objects.BRDF, scene *Scene, mis bool, smp sampler.Sampler) vec3.Color {
+	wi := sampleHemisphere(rec.Normal, smp)
+	cosTheta := rec.Normal.Dot(wi)
+	if cosTheta <= 0 || !skyVisible(scene, rec.P, wi) {
+		return vec3.Color{X: 0, Y: 0, Z: 0}
+	}
+	weight := 1.0
+	if mis {
+		weight = powerHeuristic(skyPDF, brdf.PDF(r, rec, wi))
+	}
+	li := Background(ray.Ray{Origin: rec.P, Direction: wi})
+	return brdf.Eval(r, rec, wi).Mul(li).ScalarMul(cosTheta * weight / skyPDF)
+}
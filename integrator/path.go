@@ -0,0 +1,137 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// minSurvival is the lowest probability a path has of surviving Russian roulette,
+// keeps very dark paths from being weighted by huge factors when they do survive
+const minSurvival = 0.05
+
+// Path is the simple path tracer: rays bounce around following the materials
+// until they escape to the sky, punctual lights are added at every bounce
+type Path struct {
+	MaxDepth      int  // MaxDepth max number of bounces
+	RouletteDepth int  // RouletteDepth bounces before Russian roulette may end a path, 0 disables it
+	Reference     bool // Reference use the original recursive RayColor, mostly useful to compare against
+}
+
+// Li implements `Integrator` for Path
+func (p Path) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	if p.Reference {
+		return RayColor(r, scene, p.MaxDepth, smp, hitRec)
+	}
+	return TraceRay(r, scene, p.MaxDepth, p.RouletteDepth, smp, hitRec)
+}
+
+// LiAOV implements `AOVIntegrator` for Path
+func (p Path) LiAOV(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord, aov *AOVSample) vec3.Color {
+	if p.Reference {
+		return rayColor(r, scene, p.MaxDepth, smp, hitRec, vec3.Color{X: 1, Y: 1, Z: 1}, 0, aov)
+	}
+	return traceRay(r, scene, p.MaxDepth, p.RouletteDepth, smp, hitRec, aov)
+}
+
+// RayColor returns the ray color
+func RayColor(r ray.Ray, scene *Scene, depth int, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return rayColor(r, scene, depth, smp, hitRec, vec3.Color{X: 1, Y: 1, Z: 1}, 0, nil)
+}
+
+// rayColor is RayColor for a ray that already bounced off the given number of
+// surfaces, with throughput the attenuation along the way. Those only matter for
+// the AOVs.
+func rayColor(r ray.Ray, scene *Scene, depth int, smp sampler.Sampler, hitRec *objects.HitRecord, throughput vec3.Color, surfaces int, aov *AOVSample) vec3.Color {
+	if depth <= 0 {
+		return vec3.Color{X: 0, Y: 0, Z: 0}
+	}
+
+	tmax := math.Inf(1)
+	if scene.World.Hit(r, tmin, tmax, hitRec) {
+		if surfaces == 0 {
+			aov.recordHit(r, *hitRec)
+		}
+		// Punctual lights can't be hit by the scattered ray so they are sampled here
+		direct := directLight(r, *hitRec, scene)
+		aov.addLight(throughput.Mul(direct), surfaces+1)
+		scattered := new(ray.Ray)
+		attenuation := new(vec3.Color)
+		if hitRec.Material.Scatter(r, *hitRec, attenuation, scattered, smp) {
+			return direct.Add(attenuation.Mul(rayColor(*scattered, scene, depth-1, smp, hitRec, throughput.Mul(*attenuation), surfaces+1, aov)))
+		}
+		return direct
+	}
+
+	// If no hits then the color == background
+	if surfaces == 0 {
+		aov.recordMiss(r)
+	}
+	aov.addLight(throughput.Mul(Background(r)), surfaces)
+	return Background(r)
+}
+
+// TraceRay is the iterative version of RayColor. Instead of multiplying the
+// attenuation on the way back out of the recursion it keeps track of the path
+// throughput, which also lets paths be terminated early with Russian roulette
+// once they've bounced rrDepth times. A rrDepth of 0 disables Russian roulette,
+// in which case the result is the same as RayColor.
+func TraceRay(r ray.Ray, scene *Scene, maxDepth, rrDepth int, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return traceRay(r, scene, maxDepth, rrDepth, smp, hitRec, nil)
+}
+
+// traceRay is TraceRay filling in aov unless it's nil
+func traceRay(r ray.Ray, scene *Scene, maxDepth, rrDepth int, smp sampler.Sampler, hitRec *objects.HitRecord, aov *AOVSample) vec3.Color {
+	radiance := vec3.Color{X: 0, Y: 0, Z: 0}
+	throughput := vec3.Color{X: 1, Y: 1, Z: 1}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+
+	tmax := math.Inf(1)
+	for depth := 0; depth < maxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, tmax, hitRec) {
+			if depth == 0 {
+				aov.recordMiss(r)
+			}
+			sky := throughput.Mul(Background(r))
+			aov.addLight(sky, depth)
+			return radiance.Add(sky)
+		}
+		if depth == 0 {
+			aov.recordHit(r, *hitRec)
+		}
+
+		direct := throughput.Mul(directLight(r, *hitRec, scene))
+		aov.addLight(direct, depth+1)
+		radiance = radiance.Add(direct)
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			return radiance
+		}
+		throughput = throughput.Mul(attenuation)
+
+		if !survivesRoulette(&throughput, depth, rrDepth, smp) {
+			return radiance
+		}
+		r = scattered
+	}
+	return radiance
+}
+
+// survivesRoulette plays Russian roulette once the path has bounced rrDepth times.
+// Paths that carry little light are likely to be killed, the ones that survive
+// have their throughput boosted so the estimate stays unbiased.
+func survivesRoulette(throughput *vec3.Color, depth, rrDepth int, smp sampler.Sampler) bool {
+	if rrDepth <= 0 || depth+1 < rrDepth {
+		return true
+	}
+	survival := utils.Clamp(math.Max(throughput.X, math.Max(throughput.Y, throughput.Z)), minSurvival, 1)
+	if smp.Get1D() >= survival {
+		return false
+	}
+	*throughput = throughput.ScalarDiv(survival)
+	return true
+}
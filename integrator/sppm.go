@@ -0,0 +1,338 @@
+package integrator
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+const (
+	// sppmAlpha is the fraction of new photons kept when shrinking the radius
+	sppmAlpha = 2.0 / 3.0
+	// defaultPhotonRadius initial gather radius when none is configured
+	defaultPhotonRadius = 0.1
+	// defaultPhotonIterations camera + photon passes when none are configured
+	defaultPhotonIterations = 64
+	// defaultPhotons photons shot per iteration when none are configured
+	defaultPhotons = 100000
+)
+
+// SPPM is a stochastic progressive photon mapper. Every iteration it traces one
+// camera ray per pixel to the first diffuse surface (the visible point), then
+// shoots photons from the lights and the sky and gathers the ones landing near
+// each visible point. The gather radius shrinks as photons accumulate so the
+// estimate converges, which resolves caustics that camera paths can't find.
+//
+// Photons from the sky and directional lights are shot from a disk as big as the
+// sphere bounding the world, so a huge ground sphere spreads them very thin and
+// those need many more photons (or a bigger radius) to converge.
+type SPPM struct {
+	MaxDepth   int     // MaxDepth max number of bounces of camera and photon paths
+	Iterations int     // Iterations number of camera + photon passes
+	Photons    int     // Photons number of photons shot per iteration
+	Radius     float64 // Radius initial gather radius
+	WriteEvery int     // WriteEvery iterations between intermediate images, 0 disables them
+	Seed       uint64  // Seed every random number of the render is derived from
+}
+
+// Li implements `Integrator` for SPPM. Photons need the whole image so on its
+// own this only gives the direct lighting at the visible point, see Render.
+func (pm SPPM) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	return DirectLighting{MaxDepth: pm.MaxDepth, SkySamples: 1}.Li(r, scene, smp, hitRec)
+}
+
+// visiblePoint is the first diffuse surface seen through a pixel
+type visiblePoint struct {
+	rIn  ray.Ray
+	rec  objects.HitRecord
+	brdf objects.BRDF
+	beta vec3.Color // beta throughput from the camera, nil brdf means there's no visible point
+}
+
+// sppmPixel holds everything SPPM knows about a pixel
+type sppmPixel struct {
+	x, y   int        // x, y image coordinates
+	ld     vec3.Color // ld sum of the direct lighting over all iterations
+	radius float64    // radius current gather radius
+	n      float64    // n photons accumulated so far
+	tau    vec3.Color // tau accumulated photon flux
+	vp     visiblePoint
+	phi    vec3.Color // phi flux gathered in the current iteration
+	m      int        // m photons gathered in the current iteration
+}
+
+// photonSource describes where photons can be shot from
+type photonSource struct {
+	emitters  []lights.Emitter
+	far       []lights.DirectionalLight
+	center    vec3.Point // center of the sphere bounding the world
+	radius    float64    // radius of the sphere bounding the world
+	pickPDF   float64    // pickPDF probability of choosing any one source, the sky is one of them
+	numSource int
+}
+
+// Render implements `ImageIntegrator` for SPPM
+func (pm SPPM) Render(ctx context.Context, scene *Scene, cam *camera.Camera, width, height int, progress func(iteration, iterations int, snapshot *renderer.Film)) *renderer.Film {
+	pm = pm.withDefaults()
+	pixels := make([]sppmPixel, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels[y*width+x] = sppmPixel{x: x, y: y, radius: pm.Radius}
+		}
+	}
+	src := newPhotonSource(scene)
+	numWorkers := runtime.NumCPU()
+
+	for iter := 1; iter <= pm.Iterations; iter++ {
+		if ctx.Err() != nil {
+			return pm.image(pixels, width, height, iter-1)
+		}
+		parallel(numWorkers, len(pixels), func(i int) {
+			smp := sampler.NewRandom(pm.Seed)
+			smp.StartPixelSample(pixels[i].x, pixels[i].y, iter)
+			pm.cameraPass(&pixels[i], scene, cam, width, height, smp)
+		})
+
+		// Every worker shoots a consecutive range of the photons, they're merged
+		// into a single map in order so it doesn't depend on the number of workers.
+		// Photon i of an iteration is sampled like a pixel sample at (i, iter).
+		shares := make([][]photon, numWorkers)
+		parallel(numWorkers, numWorkers, func(w int) {
+			smp := sampler.NewRandom(pm.Seed + 1)
+			hr := new(objects.HitRecord)
+			for i := w * pm.Photons / numWorkers; i < (w+1)*pm.Photons/numWorkers; i++ {
+				smp.StartPixelSample(i, iter, 0)
+				shares[w] = pm.tracePhoton(scene, src, shares[w], smp, hr)
+			}
+		})
+		var photons []photon
+		for _, share := range shares {
+			photons = append(photons, share...)
+		}
+		photonMap := buildKDTree(photons)
+
+		parallel(numWorkers, len(pixels), func(i int) {
+			pm.gather(&pixels[i], photonMap)
+		})
+
+		var snapshot *renderer.Film
+		if iter == pm.Iterations || (pm.WriteEvery > 0 && iter%pm.WriteEvery == 0) {
+			snapshot = pm.image(pixels, width, height, iter)
+		}
+		if progress != nil {
+			progress(iter, pm.Iterations, snapshot)
+		}
+		if iter == pm.Iterations {
+			return snapshot
+		}
+	}
+	return pm.image(pixels, width, height, 0)
+}
+
+// cameraPass finds the visible point of a pixel, adding the direct lighting along the way
+func (pm SPPM) cameraPass(px *sppmPixel, scene *Scene, cam *camera.Camera, width, height int, smp sampler.Sampler) {
+	// Same jittered sampling as the workers, image rows go down while t goes up
+	j := height - 1 - px.y
+	du, dv := smp.Get2D()
+	u := (float64(px.x) + du) / float64(width-1)
+	v := (float64(j) + dv) / float64(height-1)
+	r := cam.GetRay(u, v, smp)
+
+	hitRec := new(objects.HitRecord)
+	beta := vec3.Color{X: 1, Y: 1, Z: 1}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+	px.vp = visiblePoint{}
+	for depth := 0; depth < pm.MaxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, math.Inf(1), hitRec) {
+			px.ld = px.ld.Add(beta.Mul(Background(r)))
+			return
+		}
+		if brdf, ok := hitRec.Material.(objects.BRDF); ok {
+			direct := directLight(r, *hitRec, scene).Add(sampleSky(r, *hitRec, brdf, scene, false, smp))
+			px.ld = px.ld.Add(beta.Mul(direct))
+			px.vp = visiblePoint{rIn: r, rec: *hitRec, brdf: brdf, beta: beta}
+			return
+		}
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			return
+		}
+		beta = beta.Mul(attenuation)
+		r = scattered
+	}
+}
+
+// tracePhoton shoots a single photon and appends everywhere it lands to photons.
+// The first surface it hits is left out, that light is the direct lighting
+// already computed in the camera pass.
+func (pm SPPM) tracePhoton(scene *Scene, src photonSource, photons []photon, smp sampler.Sampler, hitRec *objects.HitRecord) []photon {
+	r, beta, ok := src.emit(smp)
+	if !ok {
+		return photons
+	}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+	for depth := 0; depth < pm.MaxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, math.Inf(1), hitRec) {
+			return photons
+		}
+		if _, diffuse := hitRec.Material.(objects.BRDF); diffuse && depth > 0 {
+			photons = append(photons, photon{p: hitRec.P, wi: r.Direction.Unit().Negate(), beta: beta})
+		}
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			return photons
+		}
+		// Russian roulette keeps photon power roughly constant instead of dimming it
+		survival := math.Min(1, math.Max(attenuation.X, math.Max(attenuation.Y, attenuation.Z)))
+		if survival <= 0 || smp.Get1D() >= survival {
+			return photons
+		}
+		beta = beta.Mul(attenuation).ScalarDiv(survival)
+		r = scattered
+	}
+	return photons
+}
+
+// gather adds the photons around a pixel's visible point and shrinks its radius
+func (pm SPPM) gather(px *sppmPixel, photonMap *kdTree) {
+	vp := px.vp
+	if vp.brdf != nil {
+		photonMap.query(vp.rec.P, px.radius, func(ph *photon) {
+			if vp.rec.Normal.Dot(ph.wi) <= 0 {
+				return
+			}
+			px.phi = px.phi.Add(ph.beta.Mul(vp.brdf.Eval(vp.rIn, vp.rec, ph.wi)))
+			px.m++
+		})
+	}
+	if px.m > 0 {
+		n := px.n + sppmAlpha*float64(px.m)
+		radius := px.radius * math.Sqrt(n/(px.n+float64(px.m)))
+		px.tau = px.tau.Add(vp.beta.Mul(px.phi)).ScalarMul(radius * radius / (px.radius * px.radius))
+		px.n = n
+		px.radius = radius
+	}
+	px.phi = vec3.Color{X: 0, Y: 0, Z: 0}
+	px.m = 0
+}
+
+// image turns the state of the pixels after the given number of iterations into an image
+func (pm SPPM) image(pixels []sppmPixel, width, height, iterations int) *renderer.Film {
+	img := renderer.NewFilm(width, height, nil)
+	totalPhotons := float64(iterations) * float64(pm.Photons)
+	for _, px := range pixels {
+		color := vec3.Color{X: 0, Y: 0, Z: 0}
+		if iterations > 0 {
+			color = px.ld.ScalarDiv(float64(iterations))
+			if totalPhotons > 0 {
+				color = color.Add(px.tau.ScalarDiv(totalPhotons * math.Pi * px.radius * px.radius))
+			}
+		}
+		img.Set(px.x, px.y, color)
+	}
+	return img
+}
+
+// withDefaults fills in any setting left at its zero value
+func (pm SPPM) withDefaults() SPPM {
+	if pm.Iterations <= 0 {
+		pm.Iterations = defaultPhotonIterations
+	}
+	if pm.Photons <= 0 {
+		pm.Photons = defaultPhotons
+	}
+	if pm.Radius <= 0 {
+		pm.Radius = defaultPhotonRadius
+	}
+	return pm
+}
+
+func newPhotonSource(scene *Scene) photonSource {
+	src := photonSource{}
+	for _, l := range scene.Lights {
+		switch light := l.(type) {
+		case lights.Emitter:
+			src.emitters = append(src.emitters, light)
+		case lights.DirectionalLight:
+			src.far = append(src.far, light)
+		}
+	}
+	src.center, src.radius = scene.World.BoundingBox().BoundingSphere()
+	// The sky is a light source too
+	src.numSource = len(src.emitters) + len(src.far) + 1
+	src.pickPDF = 1 / float64(src.numSource)
+	return src
+}
+
+// emit picks a light source uniformly and returns a photon ray leaving it with its power
+func (src photonSource) emit(smp sampler.Sampler) (ray.Ray, vec3.Color, bool) {
+	i := int(smp.Get1D() * float64(src.numSource))
+	if i >= src.numSource {
+		i = src.numSource - 1
+	}
+	if i < len(src.emitters) {
+		r, le, pdfPos, pdfDir := src.emitters[i].SampleLe(smp)
+		if pdfPos == 0 || pdfDir == 0 {
+			return r, le, false
+		}
+		return r, le.ScalarDiv(src.pickPDF * pdfPos * pdfDir), true
+	}
+	if src.radius <= 0 {
+		return ray.Ray{}, vec3.Color{}, false
+	}
+
+	// Lights infinitely far away shoot parallel photons from a disk covering the world
+	diskArea := math.Pi * src.radius * src.radius
+	if i -= len(src.emitters); i < len(src.far) {
+		light := src.far[i]
+		dir := light.Direction.Unit()
+		return src.diskRay(dir, smp), light.Color.ScalarMul(light.Intensity * diskArea / src.pickPDF), true
+	}
+	// The sky: uniform directions, w is where the light comes from
+	w := sampler.UnitVector(smp)
+	le := Background(ray.Ray{Direction: w})
+	return src.diskRay(w.Negate(), smp), le.ScalarMul(diskArea * 4 * math.Pi / src.pickPDF), true
+}
+
+// diskRay returns a ray travelling along dir from a random point on a disk
+// facing dir, just outside of the world's bounding sphere
+func (src photonSource) diskRay(dir vec3.Vec3, smp sampler.Sampler) ray.Ray {
+	u := dir.Cross(vec3.Vec3{X: 0, Y: 1, Z: 0})
+	if u.LengthSquared() < 1e-6 {
+		u = dir.Cross(vec3.Vec3{X: 1, Y: 0, Z: 0})
+	}
+	u = u.Unit()
+	v := dir.Cross(u)
+	d := sampler.InUnitDisk(smp)
+	origin := src.center.Sub(dir.ScalarMul(src.radius)).Add(u.ScalarMul(d.X * src.radius)).Add(v.ScalarMul(d.Y * src.radius))
+	return ray.Ray{Origin: origin, Direction: dir}
+}
+
+// parallel calls fn for every index in [0, n) spread over numWorkers goroutines
+func parallel(numWorkers, n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	chunk := (n + numWorkers - 1) / numWorkers
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				fn(i)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+package integrator
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Whitted is a classic Whitted style ray tracer for fast previews. Diffuse
+// surfaces get the punctual lights plus a flat ambient term taken from the sky
+// above them, mirrors and glass are followed, nothing is sampled randomly at
+// diffuse surfaces so a single sample per pixel gives a clean (if flat) image.
+type Whitted struct {
+	MaxDepth int // MaxDepth max number of specular bounces
+}
+
+// Li implements `Integrator` for Whitted
+func (w Whitted) Li(r ray.Ray, scene *Scene, smp sampler.Sampler, hitRec *objects.HitRecord) vec3.Color {
+	throughput := vec3.Color{X: 1, Y: 1, Z: 1}
+	var scattered ray.Ray
+	var attenuation vec3.Color
+
+	tmax := math.Inf(1)
+	for depth := 0; depth < w.MaxDepth; depth++ {
+		if !scene.World.Hit(r, tmin, tmax, hitRec) {
+			return throughput.Mul(Background(r))
+		}
+
+		if brdf, ok := hitRec.Material.(objects.BRDF); ok {
+			// Lambertian reflectance is Eval * pi, lit by the sky straight above the surface
+			ambient := Background(ray.Ray{Origin: hitRec.P, Direction: hitRec.Normal})
+			reflectance := brdf.Eval(r, *hitRec, hitRec.Normal).ScalarMul(math.Pi)
+			radiance := directLight(r, *hitRec, scene).Add(reflectance.Mul(ambient))
+			return throughput.Mul(radiance)
+		}
+
+		if !hitRec.Material.Scatter(r, *hitRec, &attenuation, &scattered, smp) {
+			break
+		}
+		throughput = throughput.Mul(attenuation)
+		r = scattered
+	}
+	return vec3.Color{X: 0, Y: 0, Z: 0}
+}
@@ -0,0 +1,61 @@
+// Package scenetest has the small scene the tests of the integrators and the
+// tracer render, and helpers to compare what they make of it
+package scenetest
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/lights"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// World returns a ground, a diffuse sphere at (0, 0, -1) and a fuzzy metal one
+// next to it
+func World() objects.HittableList {
+	world := objects.HittableList{}
+	world.Add(objects.Sphere{
+		Center: vec3.Point{X: 0, Y: -100.5, Z: -1},
+		Radius: 100,
+		Mat:    objects.Lambertian{Albedo: vec3.Color{X: 0.8, Y: 0.8, Z: 0}},
+	})
+	world.Add(objects.Sphere{
+		Center: vec3.Point{X: 0, Y: 0, Z: -1},
+		Radius: 0.5,
+		Mat:    objects.Lambertian{Albedo: vec3.Color{X: 0.1, Y: 0.2, Z: 0.5}},
+	})
+	world.Add(objects.Sphere{
+		Center: vec3.Point{X: 1, Y: 0, Z: -1},
+		Radius: 0.5,
+		Mat:    objects.Metal{Albedo: vec3.Color{X: 0.8, Y: 0.6, Z: 0.2}, Fuzz: 0.3},
+	})
+	return world
+}
+
+// Lights returns a point light above the spheres
+func Lights() lights.Lights {
+	return lights.Lights{
+		lights.PointLight{Position: vec3.Point{X: 0, Y: 2, Z: 0}, Color: vec3.Color{X: 1, Y: 1, Z: 1}, Intensity: 2},
+	}
+}
+
+// Camera returns a camera 1.5 in front of the diffuse sphere, looking straight
+// at it
+func Camera(aspect float64) *camera.Camera {
+	return camera.InitCamera(vec3.Point{X: 0, Y: 0, Z: 1}, vec3.Point{X: 0, Y: 0, Z: -1}, vec3.Vec3{X: 0, Y: 1, Z: 0}, 90, aspect, 0, 1)
+}
+
+// MeanColor averages many samples of the same ray
+func MeanColor(samples int, trace func() vec3.Color) vec3.Color {
+	sum := vec3.Color{}
+	for i := 0; i < samples; i++ {
+		sum = sum.Add(trace())
+	}
+	return sum.ScalarDiv(float64(samples))
+}
+
+// ColorsClose tells whether every component of a and b is within tolerance
+func ColorsClose(a, b vec3.Color, tolerance float64) bool {
+	return math.Abs(a.X-b.X) < tolerance && math.Abs(a.Y-b.Y) < tolerance && math.Abs(a.Z-b.Z) < tolerance
+}
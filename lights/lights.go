@@ -0,0 +1,291 @@
+package lights
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// shadowEpsilon keeps shadow rays from hitting the surface they start on
+const shadowEpsilon = 0.001
+
+// Light describes a punctual light source. These are "delta" lights: they have no
+// area so rays can never hit them, the integrator has to sample them explicitly.
+type Light interface {
+	// Sample returns the unit direction from p towards the light, the distance to
+	// the light (+Inf for lights infinitely far away) and the radiance arriving at p
+	Sample(p vec3.Point) (wi vec3.Vec3, dist float64, li vec3.Color)
+}
+
+// PointLight emits light equally in all directions from a single point
+type PointLight struct {
+	Position  vec3.Point // Position of the light
+	Color     vec3.Color // Color of the light
+	Intensity float64    // Intensity scales Color, falls off with the square of the distance
+}
+
+// Sample implements `Light` for PointLight
+func (l PointLight) Sample(p vec3.Point) (vec3.Vec3, float64, vec3.Color) {
+	toLight := l.Position.Sub(p)
+	distSq := toLight.LengthSquared()
+	dist := math.Sqrt(distSq)
+	return toLight.ScalarDiv(dist), dist, l.Color.ScalarMul(l.Intensity / distSq)
+}
+
+// SpotLight is a point light that only emits inside a cone
+type SpotLight struct {
+	Position   vec3.Point // Position of the light
+	Direction  vec3.Vec3  // Direction the spotlight is pointing at
+	Color      vec3.Color // Color of the light
+	Intensity  float64    // Intensity scales Color, falls off with the square of the distance
+	Angle      float64    // Angle in degrees between the axis and the edge of the cone
+	Falloff    float64    // Falloff angle in degrees at which the light starts fading out towards the edge of the cone
+	cosAngle   float64
+	cosFalloff float64
+}
+
+// InitSpotLight precomputes the cosines of the cone angles, must be called before sampling
+func (l *SpotLight) InitSpotLight() {
+	l.Direction = l.Direction.Unit()
+	l.cosAngle = math.Cos(l.Angle * math.Pi / 180)
+	l.cosFalloff = math.Cos(l.Falloff * math.Pi / 180)
+}
+
+// Sample implements `Light` for SpotLight
+func (l SpotLight) Sample(p vec3.Point) (vec3.Vec3, float64, vec3.Color) {
+	toLight := l.Position.Sub(p)
+	distSq := toLight.LengthSquared()
+	dist := math.Sqrt(distSq)
+	wi := toLight.ScalarDiv(dist)
+	return wi, dist, l.Color.ScalarMul(l.Intensity * l.falloff(wi.Negate()) / distSq)
+}
+
+// falloff returns how much light leaves the spotlight in direction w
+func (l SpotLight) falloff(w vec3.Vec3) float64 {
+	cosTheta := w.Dot(l.Direction)
+	if cosTheta < l.cosAngle {
+		return 0
+	}
+	if cosTheta >= l.cosFalloff {
+		return 1
+	}
+	// Smooth fade between the falloff angle and the edge of the cone
+	delta := (cosTheta - l.cosAngle) / (l.cosFalloff - l.cosAngle)
+	return delta * delta * delta * delta
+}
+
+// DirectionalLight is a light infinitely far away, like the sun, all of its rays are parallel
+type DirectionalLight struct {
+	Direction vec3.Vec3  // Direction the light is travelling in
+	Color     vec3.Color // Color of the light
+	Intensity float64    // Intensity scales Color, does not fall off with distance
+}
+
+// Sample implements `Light` for DirectionalLight
+func (l DirectionalLight) Sample(p vec3.Point) (vec3.Vec3, float64, vec3.Color) {
+	return l.Direction.Unit().Negate(), math.Inf(1), l.Color.ScalarMul(l.Intensity)
+}
+
+// Unoccluded checks whether anything in the world blocks the segment from p
+// travelling dist along the unit direction wi
+func Unoccluded(world objects.HittableList, p vec3.Point, wi vec3.Vec3, dist float64) bool {
+	shadowRay := ray.Ray{Origin: p, Direction: wi}
+	return !world.Hit(shadowRay, shadowEpsilon, dist-shadowEpsilon, new(objects.HitRecord))
+}
+
+// Lights is a slice of lights
+type Lights []Light
+
+// UnmarshalJSON picks the concrete light type from the "type" field of each element
+func (ls *Lights) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range raw {
+		var obj map[string]interface{}
+		err := json.Unmarshal(r, &obj)
+		if err != nil {
+			return err
+		}
+
+		lightType := ""
+		if t, ok := obj["type"].(string); ok {
+			lightType = strings.ToLower(t)
+		}
+
+		var actual Light
+		switch lightType {
+		case "point":
+			actual = newPointLight(obj)
+		case "spot":
+			actual = newSpotLight(obj)
+		case "directional":
+			actual = newDirectionalLight(obj)
+		default:
+			return fmt.Errorf("unknown light type %q", lightType)
+		}
+		*ls = append(*ls, actual)
+	}
+	return nil
+}
+
+func newPointLight(obj map[string]interface{}) PointLight {
+	l := PointLight{Color: vec3.Color{X: 1, Y: 1, Z: 1}, Intensity: 1}
+	if c, ok := obj["position"].(map[string]interface{}); ok {
+		l.Position = vec3.Point{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if c, ok := obj["color"].(map[string]interface{}); ok {
+		l.Color = vec3.Color{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if i, ok := obj["intensity"].(float64); ok {
+		l.Intensity = i
+	}
+	return l
+}
+
+func newSpotLight(obj map[string]interface{}) SpotLight {
+	l := SpotLight{
+		Direction: vec3.Vec3{X: 0, Y: -1, Z: 0},
+		Color:     vec3.Color{X: 1, Y: 1, Z: 1},
+		Intensity: 1,
+		Angle:     30,
+		Falloff:   25,
+	}
+	if c, ok := obj["position"].(map[string]interface{}); ok {
+		l.Position = vec3.Point{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if c, ok := obj["direction"].(map[string]interface{}); ok {
+		l.Direction = vec3.Vec3{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if c, ok := obj["color"].(map[string]interface{}); ok {
+		l.Color = vec3.Color{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if i, ok := obj["intensity"].(float64); ok {
+		l.Intensity = i
+	}
+	if a, ok := obj["angle"].(float64); ok {
+		l.Angle = a
+	}
+	if f, ok := obj["falloff"].(float64); ok {
+		l.Falloff = f
+	}
+	if l.Falloff > l.Angle {
+		l.Falloff = l.Angle
+	}
+	l.InitSpotLight()
+	return l
+}
+
+func newDirectionalLight(obj map[string]interface{}) DirectionalLight {
+	l := DirectionalLight{
+		Direction: vec3.Vec3{X: 0, Y: -1, Z: 0},
+		Color:     vec3.Color{X: 1, Y: 1, Z: 1},
+		Intensity: 1,
+	}
+	if c, ok := obj["direction"].(map[string]interface{}); ok {
+		l.Direction = vec3.Vec3{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if c, ok := obj["color"].(map[string]interface{}); ok {
+		l.Color = vec3.Color{
+			X: c["x"].(float64),
+			Y: c["y"].(float64),
+			Z: c["z"].(float64),
+		}
+	}
+	if i, ok := obj["intensity"].(float64); ok {
+		l.Intensity = i
+	}
+	return l
+}
+
+// An Emitter is a Light that can also shoot rays into the scene, which is needed
+// by integrators that build paths starting from the lights. Lights infinitely far
+// away (DirectionalLight) have no finite origin to start from so they aren't Emitters.
+type Emitter interface {
+	Light
+	// SampleLe picks a ray leaving the light and returns it with the intensity it
+	// carries, the density of its origin (1 for a point) and of its direction
+	SampleLe(s sampler.Sampler) (r ray.Ray, le vec3.Color, pdfPos, pdfDir float64)
+	// PdfLe returns the densities SampleLe would pick a ray leaving along w with
+	PdfLe(w vec3.Vec3) (pdfPos, pdfDir float64)
+}
+
+// SampleLe implements `Emitter` for PointLight, rays leave uniformly in all directions
+func (l PointLight) SampleLe(s sampler.Sampler) (ray.Ray, vec3.Color, float64, float64) {
+	r := ray.Ray{Origin: l.Position, Direction: sampler.UnitVector(s)}
+	return r, l.Color.ScalarMul(l.Intensity), 1, 1 / (4 * math.Pi)
+}
+
+// PdfLe implements `Emitter` for PointLight
+func (l PointLight) PdfLe(w vec3.Vec3) (float64, float64) {
+	return 1, 1 / (4 * math.Pi)
+}
+
+// SampleLe implements `Emitter` for SpotLight, rays leave uniformly inside the cone
+func (l SpotLight) SampleLe(s sampler.Sampler) (ray.Ray, vec3.Color, float64, float64) {
+	u1, u2 := s.Get2D()
+	cosTheta := 1 - u1*(1-l.cosAngle)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u2
+	u, v := basis(l.Direction)
+	dir := u.ScalarMul(math.Cos(phi) * sinTheta).Add(v.ScalarMul(math.Sin(phi) * sinTheta)).Add(l.Direction.ScalarMul(cosTheta))
+	r := ray.Ray{Origin: l.Position, Direction: dir}
+	return r, l.Color.ScalarMul(l.Intensity * l.falloff(dir)), 1, l.conePDF()
+}
+
+// PdfLe implements `Emitter` for SpotLight
+func (l SpotLight) PdfLe(w vec3.Vec3) (float64, float64) {
+	if w.Unit().Dot(l.Direction) < l.cosAngle {
+		return 1, 0
+	}
+	return 1, l.conePDF()
+}
+
+// conePDF is the density of directions picked uniformly inside the cone
+func (l SpotLight) conePDF() float64 {
+	return 1 / (2 * math.Pi * (1 - l.cosAngle))
+}
+
+// basis returns two unit vectors perpendicular to w and each other
+func basis(w vec3.Vec3) (vec3.Vec3, vec3.Vec3) {
+	a := vec3.Vec3{X: 1, Y: 0, Z: 0}
+	if math.Abs(w.X) > 0.9 {
+		a = vec3.Vec3{X: 0, Y: 1, Z: 0}
+	}
+	v := w.Cross(a).Unit()
+	u := w.Cross(v)
+	return u, v
+}
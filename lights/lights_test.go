@@ -0,0 +1,126 @@
+package lights
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestPointLight(t *testing.T) {
+	l := PointLight{Position: vec3.Point{X: 0, Y: 4, Z: 0}, Color: vec3.Color{X: 1, Y: 0.5, Z: 0.25}, Intensity: 8}
+	wi, dist, li := l.Sample(vec3.Point{X: 0, Y: 2, Z: 0})
+	if wi != (vec3.Vec3{X: 0, Y: 1, Z: 0}) || dist != 2 {
+		t.Errorf("sampled %v at %g, want [0 1 0] at 2", wi, dist)
+	}
+	// Falls off with the square of the distance
+	if li != (vec3.Color{X: 2, Y: 1, Z: 0.5}) {
+		t.Errorf("radiance is %v, want [2 1 0.5]", li)
+	}
+
+	// Rays leave every way, the estimate of the power is 4 pi times the intensity
+	s := sampler.NewRandom(1)
+	const n = 20000
+	var power, up float64
+	for i := 0; i < n; i++ {
+		r, le, pdfPos, pdfDir := l.SampleLe(s)
+		if r.Origin != l.Position || !near(r.Direction.Length(), 1, 1e-9) {
+			t.Fatalf("ray %v doesn't leave the light", r)
+		}
+		if p, d := l.PdfLe(r.Direction); p != pdfPos || d != pdfDir {
+			t.Fatalf("PdfLe is %g %g, SampleLe %g %g", p, d, pdfPos, pdfDir)
+		}
+		power += le.X / pdfDir / n
+		if r.Direction.Y > 0 {
+			up++
+		}
+	}
+	if !near(power, 4*math.Pi*8, 1e-6) || !near(up/n, 0.5, 0.02) {
+		t.Errorf("power is %g, want %g, and %g of the rays go up, want half", power, 4*math.Pi*8, up/n)
+	}
+}
+
+func TestSpotLight(t *testing.T) {
+	var ls Lights
+	err := json.Unmarshal([]byte(`[{"type": "spot", "position": {"x": 0, "y": 0, "z": 0},
+		"direction": {"x": 0, "y": 0, "z": -2}, "intensity": 1, "angle": 30, "falloff": 40}]`), &ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ls[0].(SpotLight)
+	if l.Falloff != 30 || l.Direction != (vec3.Vec3{X: 0, Y: 0, Z: -1}) {
+		t.Errorf("falloff is %g and direction %v, want 30 and [0 0 -1]", l.Falloff, l.Direction)
+	}
+	l.Falloff = 20
+	l.InitSpotLight()
+
+	for _, c := range []struct {
+		degrees float64
+		want    func(float64) bool
+	}{
+		{0, func(v float64) bool { return near(v, 1, 1e-9) }},
+		{19, func(v float64) bool { return near(v, 1, 1e-9) }},
+		{25, func(v float64) bool { return v > 0 && v < 1 }},
+		{31, func(v float64) bool { return v == 0 }},
+		{180, func(v float64) bool { return v == 0 }},
+	} {
+		a := c.degrees * math.Pi / 180
+		p := vec3.Point{X: math.Sin(a), Y: 0, Z: -math.Cos(a)}
+		_, _, li := l.Sample(p)
+		if !c.want(li.X) {
+			t.Errorf("%g degrees off the axis the radiance is %g", c.degrees, li.X)
+		}
+	}
+
+	// Rays stay in the cone, and the power they estimate matches that of rays
+	// sent every way
+	s := sampler.NewRandom(2)
+	const n = 40000
+	var cone, sphere float64
+	for i := 0; i < n; i++ {
+		r, le, _, pdfDir := l.SampleLe(s)
+		if r.Direction.Dot(l.Direction) < l.cosAngle-1e-9 {
+			t.Fatalf("ray %v leaves the cone", r.Direction)
+		}
+		if _, d := l.PdfLe(r.Direction); d != pdfDir {
+			t.Fatalf("PdfLe is %g, SampleLe %g", d, pdfDir)
+		}
+		cone += le.X / pdfDir / n
+		w := sampler.UnitVector(s)
+		sphere += l.falloff(w) * 4 * math.Pi / n
+		if _, d := l.PdfLe(w); (d == 0) != (w.Dot(l.Direction) < l.cosAngle) {
+			t.Fatalf("PdfLe of %v is %g", w, d)
+		}
+	}
+	if !near(cone, sphere, 0.05*sphere) {
+		t.Errorf("power is %g sampling the cone and %g sampling every way", cone, sphere)
+	}
+}
+
+func TestDirectionalLight(t *testing.T) {
+	l := DirectionalLight{Direction: vec3.Vec3{X: 0, Y: -3, Z: 0}, Color: vec3.Color{X: 1, Y: 1, Z: 1}, Intensity: 2}
+	for _, p := range []vec3.Point{{}, {X: 100, Y: -50, Z: 3}} {
+		wi, dist, li := l.Sample(p)
+		if wi != (vec3.Vec3{X: 0, Y: 1, Z: 0}) || !math.IsInf(dist, 1) || li != (vec3.Color{X: 2, Y: 2, Z: 2}) {
+			t.Errorf("at %v sampled %v at %g with %v, want [0 1 0] at +Inf with [2 2 2]", p, wi, dist, li)
+		}
+	}
+}
+
+func TestUnknownLight(t *testing.T) {
+	for _, data := range []string{
+		`[{"type": "spotlight", "position": {"x": 0, "y": 1, "z": 0}}]`,
+		`[{"position": {"x": 0, "y": 1, "z": 0}}]`,
+	} {
+		var ls Lights
+		if err := json.Unmarshal([]byte(data), &ls); err == nil {
+			t.Errorf("%s: %d lights, expected an error", data, len(ls))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -8,18 +9,20 @@ import (
 	"log"
 	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"runtime"
 	"runtime/pprof"
+	"syscall"
 	"time"
 
 	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
 
+	"github.com/vfrazao-ns1/raytracing1weekend/animation"
 	"github.com/vfrazao-ns1/raytracing1weekend/camera"
-	"github.com/vfrazao-ns1/raytracing1weekend/objects"
-	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
 	"github.com/vfrazao-ns1/raytracing1weekend/utils"
-	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
 )
 
 const (
@@ -30,6 +33,11 @@ var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 var configFile = flag.String("config", "config.json", "Location of config file")
 var worldFile = flag.String("world", "world.json", "Location of world file")
+var format = flag.String("format", "", "Format of the images written, one of png, ppm, jpeg, tiff, exr or hdr. Defaults to the one the file extension stands for")
+var resume = flag.Bool("resume", false, "Carry on from the checkpoints of an interrupted render, skipping frames that are already rendered")
+var frames = flag.String("frames", "", "Frames of the animation to render as `start:end[:step]`, end included. Missing bounds are the first and last frames")
+var skipExisting = flag.Bool("skip-existing", false, "Skip frames of the animation that are already rendered, which have a .done file next to them")
+var lockDir = flag.String("lock", "", "Share the frames of the animation out between the processes started with this lock `directory`. Implies -skip-existing")
 
 func main() {
 	flag.Parse()
@@ -65,41 +73,168 @@ func main() {
 		log.Fatal(fmt.Sprintf("Unable to decode world config: %s\n+", err))
 	}
 
+	// Tracks are checked before anything is rendered
+	for _, tracks := range [][]animation.Track{tracerConfig.Animation.Tracks, worldConf.Tracks} {
+		for i := range tracks {
+			if err := tracks[i].Validate(); err != nil {
+				log.Fatal(fmt.Sprintf("Unable to set up animation: %s\n", err))
+			}
+		}
+	}
+
+	if !tracerConfig.Animation.Enabled && (*frames != "" || *skipExisting || *lockDir != "") {
+		log.Fatal("Unable to select frames: only animations have frames\n")
+	}
+	if *lockDir != "" {
+		if err := os.MkdirAll(*lockDir, 0755); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to make lock directory: %s\n", err))
+		}
+	}
+
+	// A resumed render has to keep the seed it was started with
+	frameNames := frameFileNames(tracerConfig)
+	seeded := tracerConfig.Seed != 0
+	if *resume && !seeded {
+		for _, name := range frameNames {
+			if cp, err := readCheckpoint(checkpointPath(name)); err == nil {
+				tracerConfig.Seed = cp.Seed
+				break
+			}
+		}
+		if tracerConfig.Seed == 0 {
+			fmt.Fprintf(os.Stderr, "No checkpoint to take the seed from, frames left to render get a new one\n")
+		}
+	}
+	// Processes sharing frames have to render them all with the same seed
+	if *lockDir != "" && !seeded {
+		if tracerConfig.Seed, err = sharedSeed(*lockDir, tracerConfig.Seed); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to share seed: %s\n", err))
+		}
+	}
+	// Printing the seed lets any render be reproduced by putting it in the config
+	tracerConfig.Seed = pickSeed(tracerConfig)
+	fmt.Fprintf(os.Stderr, "Seed: %d\n", tracerConfig.Seed)
+	hash := configHash(tracerConfig, w)
+	ctx := interruptContext()
+
 	imgHeight := utils.MakeEven(int(float64(tracerConfig.ImgWidth) / tracerConfig.Aspect))
 
 	cam := camera.InitCamera(tracerConfig.Camera.LookFrom, tracerConfig.Camera.LookAt, tracerConfig.Camera.Vup, tracerConfig.Camera.VFOV, float64(tracerConfig.ImgWidth)/float64(imgHeight), tracerConfig.Camera.Aperture, tracerConfig.Camera.FocusDist)
 
-	var world objects.HittableList
-	if worldConf.Random == true {
-		world = RandomWorld()
-	} else {
-		world = worldFromConfig(worldConf)
+	scene := sceneFromConfig(worldConf, tracerConfig.Seed)
+
+	integ, err := newIntegrator(tracerConfig)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up integrator: %s\n", err))
+	}
+	smp, err := newSampler(tracerConfig)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up sampler: %s\n", err))
 	}
 
 	if tracerConfig.Animation.Enabled {
-		framesPerSecond := tracerConfig.Animation.Fps
-		numFrames := framesPerSecond * tracerConfig.Animation.Duration
-		fileExt := filepath.Ext(tracerConfig.FileName)
-		baseFileName := tracerConfig.FileName[:len(tracerConfig.FileName)-len(fileExt)]
+		animRenderer, err := newAnimationRenderer(tracerConfig.Animation, tracerConfig.FileName)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to set up animation: %s\n", err))
+		}
+		if err := checkFrameFormat(*format, animRenderer); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to set up output: %s\n", err))
+		}
+		animFileName := tracerConfig.FileName
+		numFrames := len(frameNames) - 1
+		selected, err := parseFrameRange(*frames, numFrames)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to select frames: %s\n", err))
+		}
+		sim, err := newPhysics(worldConf, w)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to set up physics: %s\n", err))
+		}
+		// Rigs move the camera, keyframes go over that. Turntables follow their
+		// object around, the others are the same for every frame.
+		rigConf := tracerConfig.Animation.Rig
+		rig, err := newRig(rigConf, tracerConfig.Camera, scene.World)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to set up camera rig: %s\n", err))
+		}
+		followObject := rigFollowsObject(rigConf, worldConf, sim)
 		// radius of our circle is the distance from the origin in the XZ plane
 		r := math.Sqrt(math.Pow(tracerConfig.Camera.LookFrom.X, 2) + math.Pow(tracerConfig.Camera.LookFrom.Z, 2))
-		for i := 0; i < numFrames+1; i++ {
-			// Move in circle of radius r
-			// at a *constant* rate
-			// To do this we will move 2pi radian over numFrames
-			// From unit circle: x,y = cos(rad), sin(rad)
-			// We multiply by r
-			rad := 2 * math.Pi * float64(i) / float64(numFrames)
-			tracerConfig.Camera.LookFrom.X = math.Cos(rad) * r
-			tracerConfig.Camera.LookFrom.Z = math.Sin(rad) * r
-			cam = camera.InitCamera(tracerConfig.Camera.LookFrom, tracerConfig.Camera.LookAt, tracerConfig.Camera.Vup, tracerConfig.Camera.VFOV, float64(tracerConfig.ImgWidth)/float64(imgHeight), tracerConfig.Camera.Aperture, tracerConfig.Camera.FocusDist)
-			// Format specifier hardcoded to number of zero padding, might want to do this more dynamically some other time
-			tracerConfig.FileName = fmt.Sprintf("%s%05d%s", baseFileName, i, fileExt)
-			renderFrame(tracerConfig, world, cam)
+		for i, name := range frameNames {
+			// The simulation goes through every frame, rendered or not, so frames
+			// come out the same whichever of them a process renders
+			time := float64(i) / float64(tracerConfig.Animation.Fps)
+			if sim != nil {
+				sim.Advance(time)
+			}
+			if !selected.has(i) {
+				continue
+			}
+			lock, err := claimFrame(name)
+			if err != nil {
+				log.Fatal(fmt.Sprintf("Unable to lock frame: %s\n", err))
+			}
+			if lock == nil {
+				continue
+			}
+
+			frameScene := scene
+			if len(worldConf.Tracks) > 0 {
+				var frameWorld worldConfig
+				if err := animation.Apply(w, worldConf.Tracks, time, &frameWorld); err != nil {
+					log.Fatal(fmt.Sprintf("Unable to animate world: %s\n", err))
+				}
+				frameScene = sceneFromConfig(frameWorld, tracerConfig.Seed)
+			}
+			if sim != nil {
+				frameScene = placeBodies(sim, frameScene)
+			}
+
+			camConf := tracerConfig.Camera
+			if followObject {
+				if rig, err = newRig(rigConf, tracerConfig.Camera, frameScene.World); err != nil {
+					log.Fatal(fmt.Sprintf("Unable to set up camera rig: %s\n", err))
+				}
+			}
+			if rig != nil {
+				t := 0.0
+				if numFrames > 0 {
+					t = float64(i) / float64(numFrames)
+				}
+				camConf.LookFrom, camConf.LookAt = rig.At(t)
+			}
+			if len(tracerConfig.Animation.Tracks) > 0 {
+				camData, _ := json.Marshal(camConf)
+				if err := animation.Apply(camData, tracerConfig.Animation.Tracks, time, &camConf); err != nil {
+					log.Fatal(fmt.Sprintf("Unable to animate camera: %s\n", err))
+				}
+			} else if rig == nil {
+				// Without a rig or keyframes the camera orbits the origin
+				// Move in circle of radius r
+				// at a *constant* rate
+				// To do this we will move 2pi radian over numFrames
+				// From unit circle: x,y = cos(rad), sin(rad)
+				// We multiply by r
+				rad := 2 * math.Pi * float64(i) / float64(numFrames)
+				camConf.LookFrom.X = math.Cos(rad) * r
+				camConf.LookFrom.Z = math.Sin(rad) * r
+			}
+			cam = camera.InitCamera(camConf.LookFrom, camConf.LookAt, camConf.Vup, camConf.VFOV, float64(tracerConfig.ImgWidth)/float64(imgHeight), camConf.Aperture, camConf.FocusDist)
+			tracerConfig.FileName = name
+			renderFrame(ctx, tracerConfig, frameScene, integ, smp, cam, hash)
+			lock.release()
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if animRenderer != nil && ctx.Err() == nil {
+			if err := assembleAnimation(animFileName, frameNames, tracerConfig.Animation.Fps, animRenderer); err != nil {
+				log.Fatal(fmt.Sprintf("Unable to write animation: %s\n", err))
+			}
 		}
 
 	} else {
-		renderFrame(tracerConfig, world, cam)
+		renderFrame(ctx, tracerConfig, scene, integ, smp, cam, hash)
 	}
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -113,111 +248,244 @@ func main() {
 	}
 }
 
-func renderFrame(c config, world objects.HittableList, cam *camera.Camera) {
-	imgHeight := utils.MakeEven(int(float64(c.ImgWidth) / c.Aspect))
-	numPixels := (imgHeight * c.ImgWidth)
-	numWorkers := runtime.NumCPU()
-	jobs := make(chan job, numWorkers*10)
-	results := make(chan renderer.Pixel, numWorkers*10)
-	start := time.Now()
+// interruptContext returns a context cancelled by the first SIGINT or SIGTERM so
+// the frame being rendered can be written, a second one quits straight away
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintf(os.Stderr, "\nInterrupted, stopping the workers. Interrupt again to quit without writing anything\n")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+	return ctx
+}
 
-	s := workerState{
-		jobs:     jobs,
-		results:  results,
-		height:   imgHeight,
-		width:    c.ImgWidth,
-		spp:      c.SamplesPerPixel,
-		world:    world,
-		maxDepth: c.MaxDepth,
-		cam:      cam,
+// frameFileNames returns the file every frame is written to, just the one for
+// a still image. Frames of animations written as a whole are PNGs next to it.
+func frameFileNames(c config) []string {
+	if !c.Animation.Enabled {
+		return []string{c.FileName}
+	}
+	numFrames := c.Animation.Fps * c.Animation.Duration
+	fileExt := filepath.Ext(c.FileName)
+	baseFileName := c.FileName[:len(c.FileName)-len(fileExt)]
+	if r, _ := newAnimationRenderer(c.Animation, c.FileName); r != nil {
+		fileExt = ".png"
 	}
-	go fillJobsQueue(imgHeight, c.ImgWidth, jobs)
-	for i := 0; i < numWorkers; i++ {
-		go worker(s)
+	names := make([]string, numFrames+1)
+	for i := range names {
+		// Format specifier hardcoded to number of zero padding, might want to do this more dynamically some other time
+		names[i] = fmt.Sprintf("%s%05d%s", baseFileName, i, fileExt)
 	}
+	return names
+}
 
-	pixels := make([]renderer.Pixel, numPixels)
-	for i := 0; i < numPixels; i++ {
-		if i%1000 == 0 && i > 0 {
-			progress(i, numPixels, start)
+// renderFrame renders the frame written to c.FileName. When resuming, the frame
+// carries on from its checkpoint or is skipped if it was already written. hash
+// identifies the config and world, checkpoints made with others are refused.
+func renderFrame(ctx context.Context, c config, scene *tracer.Scene, integ integrator.Integrator, smp sampler.PixelSampler, cam *camera.Camera, hash string) {
+	path := checkpointPath(c.FileName)
+	var cp *checkpoint
+	if *resume {
+		var err error
+		cp, err = readCheckpoint(path)
+		if os.IsNotExist(err) {
+			if frameDone(c.FileName) {
+				fmt.Fprintf(os.Stderr, "Skipping %s, it's already rendered\n", c.FileName)
+				return
+			}
+		} else if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to resume: %s\n", err))
+		} else if cp.Hash != hash {
+			log.Fatal(fmt.Sprintf("Unable to resume: %s was made with a different config or world\n", path))
 		}
-		pixels[i] = <-results
 	}
-	progress(numPixels, numPixels, start)
-	close(jobs)
 
-	pngRenderer := renderer.PNGRenderer{
-		ImageWidth:      c.ImgWidth,
-		ImageHeight:     imgHeight,
-		ImagePixels:     pixels,
+	// Integrators working on the whole image don't checkpoint, their frames
+	// are only skipped once written
+	_, wholeImage := integ.(integrator.ImageIntegrator)
+	filter, err := newFilter(c.Filter)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up filter: %s\n", err))
+	}
+	display, err := newDisplay(c.Display)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up display: %s\n", err))
+	}
+	imgRenderer, err := newRenderer(*format, c.FileName, c.Output, display)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up output: %s\n", err))
+	}
+	aovs, err := parseAOVs(c.AOVs)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up AOVs: %s\n", err))
+	}
+	// AOVs other than the light are written as they are, without the display
+	dataRenderer, err := newRenderer(*format, c.FileName, c.Output, renderer.Display{})
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Unable to set up output: %s\n", err))
+	}
+	if _, exr := imgRenderer.(renderer.EXRRenderer); c.AOVs.Layers && !exr {
+		log.Fatal("Unable to set up AOVs: only EXR images have layers\n")
+	}
+	out := frameOutput{image: imgRenderer, data: dataRenderer, aovs: aovs, layers: c.AOVs.Layers, keepNoisy: c.Denoise.KeepNoisy}
+	if c.Denoise.Enabled {
+		// The denoiser is guided by AOVs, which these integrators don't render
+		if wholeImage {
+			log.Fatal(fmt.Sprintf("Unable to set up denoiser: %s works on the whole image\n", c.Integrator.Type))
+		}
+		out.denoiser = &c.Denoise.Denoiser
+	}
+	fileExt := filepath.Ext(c.FileName)
+	baseFileName := c.FileName[:len(c.FileName)-len(fileExt)]
+	start := time.Now()
+	lastWrite := time.Now()
+	opts := tracer.Options{
+		Width:           c.ImgWidth,
+		Height:          utils.MakeEven(int(float64(c.ImgWidth) / c.Aspect)),
 		SamplesPerPixel: c.SamplesPerPixel,
+		Integrator:      integ,
+		Sampler:         smp,
+		Adaptive:        c.Adaptive.Adaptive,
+		Progressive:     c.Progressive.Enabled,
+		Tiles:           c.Tiles,
+		Filter:          filter,
+		AOVs:            renderedAOVs(aovs, c.Denoise),
+		Progress: func(done, total int) {
+			progress(done, total, start)
+		},
+		Pass: func(passes int, film *tracer.Film) {
+			// Intermediate images of image integrators go next to the output
+			// with the iteration number
+			var err error
+			if wholeImage {
+				err = out.writeImage(fmt.Sprintf("%s_iter%05d%s", baseFileName, passes, fileExt), film)
+			} else if c.Progressive.due(passes, lastWrite) {
+				err = out.writeImage(c.FileName, film)
+				lastWrite = time.Now()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nUnable to write image: %s\n", err)
+			}
+		},
 	}
-	pngRenderer.Render(c.FileName)
-	fmt.Fprintf(os.Stderr, "\n")
-}
-
-// RayColor returns the ray color
-func RayColor(r ray.Ray, world objects.HittableList, depth int, hitRec *objects.HitRecord) vec3.Color {
-	if depth <= 0 {
-		return vec3.Color{X: 0, Y: 0, Z: 0}
+	if cp != nil {
+		opts.Film = cp.Film
+		fmt.Fprintf(os.Stderr, "Resuming %s from %d samples\n", c.FileName, cp.Film.Samples())
 	}
-
-	tmin := 0.001
-	tmax := math.Inf(1)
-	if world.Hit(r, tmin, tmax, hitRec) {
-		scattered := new(ray.Ray)
-		attenuation := new(vec3.Color)
-		if hitRec.Material.Scatter(r, *hitRec, attenuation, scattered) {
-			return attenuation.Mul(RayColor(*scattered, world, depth-1, hitRec))
+	if c.CheckpointEvery > 0 && !wholeImage {
+		opts.CheckpointEvery = time.Duration(c.CheckpointEvery * float64(time.Second))
+		opts.Checkpoint = func(film *tracer.Film) {
+			if err := writeCheckpoint(path, checkpoint{Hash: hash, Seed: c.Seed, Film: film}); err != nil {
+				fmt.Fprintf(os.Stderr, "\nUnable to write checkpoint: %s\n", err)
+			}
 		}
-		return vec3.Color{X: 0, Y: 0, Z: 0}
 	}
 
-	// If no hits then the color == background
-	unitDirection := r.Direction.Unit()
-	t := 0.5 * (unitDirection.Y + 1.0)
-	return vec3.Color{X: 1, Y: 1, Z: 1}.ScalarMul(1 - t).Add(vec3.Color{X: 0.5, Y: 0.7, Z: 1}.ScalarMul(t))
-}
+	// Whatever was there isn't finished anymore once it's written over
+	if err := os.Remove(donePath(c.FileName)); err != nil && !os.IsNotExist(err) {
+		log.Fatal(fmt.Sprintf("Unable to start frame: %s\n", err))
+	}
+	film, err := tracer.Render(ctx, scene, cam, opts)
+	switch {
+	case err != nil && ctx.Err() == nil:
+		log.Fatal(fmt.Sprintf("Unable to render: %s\n", err))
+	case err != nil && wholeImage:
+		// These integrators can't be resumed, so an interrupted image goes next
+		// to the output where -resume won't take it for a finished one
+		partial := fmt.Sprintf("%s_partial%s", baseFileName, fileExt)
+		if err := out.writeImage(partial, film); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to write image: %s\n", err))
+		}
+		fmt.Fprintf(os.Stderr, "\nWrote what was rendered of %s to %s\n", c.FileName, partial)
+		return
+	case err != nil:
+		// Pixels that didn't get any samples are left black. The checkpoint is
+		// written whether or not they're enabled so -resume can finish the frame.
+		if err := out.writeImage(c.FileName, film); err != nil {
+			fmt.Fprintf(os.Stderr, "\nUnable to write image: %s\n", err)
+		}
+		if err := out.writeExtras(c.FileName, film); err != nil {
+			fmt.Fprintf(os.Stderr, "\nUnable to write image: %s\n", err)
+		}
+		if err := writeCheckpoint(path, checkpoint{Hash: hash, Seed: c.Seed, Film: film}); err != nil {
+			fmt.Fprintf(os.Stderr, "\nUnable to write checkpoint: %s\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\nWrote what was rendered of %s, carry on with -resume\n", c.FileName)
+		return
+	}
 
-type workerState struct {
-	jobs     <-chan job
-	results  chan<- renderer.Pixel
-	height   int
-	width    int
-	spp      int // samples per pixel
-	world    objects.HittableList
-	maxDepth int
-	cam      *camera.Camera
+	// The checkpoint is kept when the image can't be written, -resume then only
+	// has to write it
+	if err := out.writeImage(c.FileName, film); err != nil {
+		log.Fatal(fmt.Sprintf("Unable to write image: %s\n", err))
+	}
+	if err := out.writeExtras(c.FileName, film); err != nil {
+		log.Fatal(fmt.Sprintf("Unable to write image: %s\n", err))
+	}
+	if c.Adaptive.Heatmap && !wholeImage {
+		if err := writeHeatmap(c.FileName, film); err != nil {
+			fmt.Fprintf(os.Stderr, "\nUnable to write heatmap: %s\n", err)
+		}
+	}
+	// The frame is done, it doesn't need its checkpoint anymore
+	if err := ioutil.WriteFile(donePath(c.FileName), nil, 0644); err != nil {
+		log.Fatal(fmt.Sprintf("Unable to mark frame done: %s\n", err))
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "\nUnable to remove checkpoint: %s\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
 }
 
-type job struct {
-	i int
-	j int
+// frameOutput writes the images of a frame
+type frameOutput struct {
+	image     renderer.Renderer  // image renders the image and the light AOVs
+	data      renderer.Renderer  // data renders the other AOVs, without the display
+	aovs      []tracer.AOV       // aovs asked for, the film may hold more for the denoiser
+	layers    bool               // layers whether the AOVs are layers of EXR images rather than files of their own
+	denoiser  *renderer.Denoiser // denoiser nil unless the image is denoised
+	keepNoisy bool               // keepNoisy whether the image is also written as it was rendered
 }
 
-func fillJobsQueue(height, width int, jobs chan<- job) {
-	for j := (height - 1); j >= 0; j-- {
-		for i := 0; i < width; i++ {
-			jobs <- job{i: i, j: j}
-		}
+// writeImage writes the image rendered so far to fileName, denoised when the
+// denoiser is enabled
+func (o frameOutput) writeImage(fileName string, film *tracer.Film) error {
+	img := film.Image()
+	if o.denoiser != nil {
+		img = o.denoiser.Denoise(img, renderer.DenoiseFeatures{
+			Albedo: film.AOV(tracer.Albedo),
+			Normal: film.AOV(tracer.Normal),
+			Depth:  film.AOV(tracer.Depth),
+		})
+	}
+	r := o.image
+	if e, ok := r.(renderer.EXRRenderer); ok && o.layers {
+		e.Layers = aovLayers(film, o.aovs)
+		r = e
 	}
+	return renderer.WriteFile(fileName, r, img)
 }
 
-func worker(state workerState) {
-	hr := new(objects.HitRecord)
-	for job := range state.jobs {
-		pixel := renderer.Pixel{
-			Color:    vec3.Color{X: 0, Y: 0, Z: 0},
-			Position: vec3.Point{X: float64(job.i), Y: float64(state.height - 1 - job.j), Z: 0},
+// writeExtras writes what goes next to the image at fileName, the noisy image
+// and the AOVs that aren't layers of it
+func (o frameOutput) writeExtras(fileName string, film *tracer.Film) error {
+	if o.denoiser != nil && o.keepNoisy {
+		fileExt := filepath.Ext(fileName)
+		noisy := fmt.Sprintf("%s_noisy%s", fileName[:len(fileName)-len(fileExt)], fileExt)
+		if err := (frameOutput{image: o.image, aovs: o.aovs, layers: o.layers}).writeImage(noisy, film); err != nil {
+			return err
 		}
-		for s := 0; s < state.spp; s++ {
-			u := (float64(job.i) + utils.RandomDouble()) / float64(state.width-1)
-			v := (float64(job.j) + utils.RandomDouble()) / float64(state.height-1)
-			ray := state.cam.GetRay(u, v)
-			pixel.Color = pixel.Color.Add(RayColor(ray, state.world, state.maxDepth, hr))
-		}
-		state.results <- pixel
 	}
+	if o.layers {
+		return nil
+	}
+	return writeAOVs(fileName, film, o.aovs, o.image, o.data)
 }
 
 func progress(done, total int, start time.Time) {
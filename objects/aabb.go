@@ -0,0 +1,79 @@
+package objects
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// AABB is an axis aligned bounding box
+type AABB struct {
+	Min vec3.Point // Min corner with the smallest coordinates
+	Max vec3.Point // Max corner with the largest coordinates
+}
+
+// Bounded is implemented by Hittables that know how much space they take up
+type Bounded interface {
+	BoundingBox() AABB
+}
+
+// Union returns the smallest box containing both boxes
+func (b AABB) Union(other AABB) AABB {
+	return AABB{
+		Min: vec3.Point{X: math.Min(b.Min.X, other.Min.X), Y: math.Min(b.Min.Y, other.Min.Y), Z: math.Min(b.Min.Z, other.Min.Z)},
+		Max: vec3.Point{X: math.Max(b.Max.X, other.Max.X), Y: math.Max(b.Max.Y, other.Max.Y), Z: math.Max(b.Max.Z, other.Max.Z)},
+	}
+}
+
+// BoundingSphere returns the center and radius of a sphere containing the box
+func (b AABB) BoundingSphere() (vec3.Point, float64) {
+	center := b.Min.Add(b.Max).ScalarDiv(2)
+	return center, b.Max.Sub(center).Length()
+}
+
+// pointsBox returns the smallest box containing all the points
+func pointsBox(points ...vec3.Point) AABB {
+	box := AABB{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		box = box.Union(AABB{Min: p, Max: p})
+	}
+	return box
+}
+
+// BoundingBox implements `Bounded` for Sphere
+func (s Sphere) BoundingBox() AABB {
+	// Negative radii are used for hollow glass spheres
+	r := math.Abs(s.Radius)
+	extent := vec3.Vec3{X: r, Y: r, Z: r}
+	return AABB{Min: s.Center.Sub(extent), Max: s.Center.Add(extent)}
+}
+
+// BoundingBox implements `Bounded` for Triangle
+func (t Triangle) BoundingBox() AABB {
+	return pointsBox(t.V0, t.V1, t.V2)
+}
+
+// BoundingBox implements `Bounded` for Rectangle
+func (r Rectangle) BoundingBox() AABB {
+	return pointsBox(r.A, r.W, r.A.Add(r.H), r.W.Add(r.H))
+}
+
+// BoundingBox implements `Bounded` for HittableList, objects that aren't
+// Bounded are left out. An empty list has an empty box at the origin.
+func (hl HittableList) BoundingBox() AABB {
+	var box AABB
+	first := true
+	for _, obj := range hl.Data {
+		b, ok := obj.(Bounded)
+		if !ok {
+			continue
+		}
+		if first {
+			box = b.BoundingBox()
+			first = false
+			continue
+		}
+		box = box.Union(b.BoundingBox())
+	}
+	return box
+}
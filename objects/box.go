@@ -0,0 +1,91 @@
+package objects
+
+import (
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Box is a box made of six rectangles, given by a corner and the three edges
+// leaving it. Boxes read from JSON are axis aligned, between "min" and "max".
+type Box struct {
+	Corner vec3.Point   // Corner the edges leave from
+	Edges  [3]vec3.Vec3 // Edges of the box, at right angles to each other
+	Mat    Material     // Mat material the box is made of
+	sides  [6]Rectangle // Internal rectangles making up the faces of the box
+}
+
+// InitBox initializes the internal rectangles used to represent the box
+func (b *Box) InitBox() {
+	center, _ := Center(b)
+	for i := 0; i < 3; i++ {
+		e1, e2, e3 := b.Edges[i], b.Edges[(i+1)%3], b.Edges[(i+2)%3]
+		// A face at the corner and the one across from it
+		for j, a := range []vec3.Point{b.Corner, b.Corner.Add(e3)} {
+			side := Rectangle{A: a, W: a.Add(e1), H: e2, Mat: b.Mat}
+			// Faces look out of the box, which their normal W-A x H decides
+			faceCenter := a.Add(e1.ScalarDiv(2)).Add(e2.ScalarDiv(2))
+			if e1.Cross(e2).Dot(faceCenter.Sub(center)) < 0 {
+				side.W, side.H = a.Add(e2), e1
+			}
+			side.InitRectangle()
+			b.sides[2*i+j] = side
+		}
+	}
+}
+
+func newBox(obj map[string]interface{}) (*Box, error) {
+	b := Box{}
+	var err error
+
+	var min, max vec3.Point
+	if c, ok := obj["min"].(map[string]interface{}); ok {
+		min = vec3FromJSON(c)
+	}
+	if c, ok := obj["max"].(map[string]interface{}); ok {
+		max = vec3FromJSON(c)
+	}
+	b.Corner = min
+	b.Edges = [3]vec3.Vec3{
+		{X: max.X - min.X},
+		{Y: max.Y - min.Y},
+		{Z: max.Z - min.Z},
+	}
+
+	if matInter, ok := obj["mat"].(map[string]interface{}); ok {
+		b.Mat, err = newMaterial(matInter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.InitBox()
+
+	return &b, nil
+}
+
+// Material implements `Made` for Box
+func (b Box) Material() Material {
+	return b.Mat
+}
+
+// Hit checks if a ray intersects with the box
+func (b Box) Hit(ray ray.Ray, tmin float64, tmax float64, rec *HitRecord) bool {
+	hitAnything := false
+	for _, side := range b.sides {
+		if side.Hit(ray, tmin, tmax, rec) {
+			hitAnything = true
+			tmax = rec.T
+		}
+	}
+	return hitAnything
+}
+
+// BoundingBox implements `Bounded` for Box
+func (b Box) BoundingBox() AABB {
+	e0, e1, e2 := b.Edges[0], b.Edges[1], b.Edges[2]
+	c := b.Corner
+	return pointsBox(
+		c, c.Add(e0), c.Add(e1), c.Add(e2),
+		c.Add(e0).Add(e1), c.Add(e1).Add(e2), c.Add(e0).Add(e2), c.Add(e0).Add(e1).Add(e2),
+	)
+}
@@ -0,0 +1,44 @@
+package objects
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestBoxHit(t *testing.T) {
+	var hs Hittables
+	err := json.Unmarshal([]byte(`[
+		{"type": "box", "min": {"x": -1, "y": 0, "z": -2}, "max": {"x": 1, "y": 1, "z": 0},
+		 "transform": {"translate": {"x": 0, "y": 1, "z": 0}}}
+	]`), &hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := hs[0].(*Box)
+	if center, _ := Center(b); !pointsEqual(center, vec3.Point{X: 0, Y: 1.5, Z: -1}) {
+		t.Errorf("box is centered at %v, want [0 1.5 -1]", center)
+	}
+
+	// Every face is hit from outside on its front, nearest face first
+	for _, r := range []struct {
+		origin, direction vec3.Vec3
+		p                 vec3.Point
+	}{
+		{vec3.Vec3{X: 0, Y: 1.5, Z: 5}, vec3.Vec3{X: 0, Y: 0, Z: -1}, vec3.Point{X: 0, Y: 1.5, Z: 0}},
+		{vec3.Vec3{X: 0, Y: 1.5, Z: -5}, vec3.Vec3{X: 0, Y: 0, Z: 1}, vec3.Point{X: 0, Y: 1.5, Z: -2}},
+		{vec3.Vec3{X: 0.5, Y: 9, Z: -1}, vec3.Vec3{X: 0, Y: -1, Z: 0}, vec3.Point{X: 0.5, Y: 2, Z: -1}},
+		{vec3.Vec3{X: -5, Y: 1.2, Z: -0.5}, vec3.Vec3{X: 1, Y: 0, Z: 0}, vec3.Point{X: -1, Y: 1.2, Z: -0.5}},
+	} {
+		var rec HitRecord
+		if !b.Hit(ray.Ray{Origin: r.origin, Direction: r.direction}, 0.001, 100, &rec) {
+			t.Errorf("ray from %v missed the box", r.origin)
+			continue
+		}
+		if !pointsEqual(rec.P, r.p) || !rec.FrontFace || rec.Normal.Dot(r.direction) >= 0 {
+			t.Errorf("ray from %v hit %v facing front %v, want %v facing front", r.origin, rec.P, rec.FrontFace, r.p)
+		}
+	}
+}
@@ -12,6 +12,11 @@ type Hittable interface {
 	Hit(ray.Ray, float64, float64, *HitRecord) bool
 }
 
+// Made is implemented by Hittables made of a single material
+type Made interface {
+	Material() Material
+}
+
 // HitRecord stores information on rays that have hit surfaces
 type HitRecord struct {
 	P         vec3.Point // P point where a surface was hit
@@ -19,6 +24,7 @@ type HitRecord struct {
 	T         float64    // T time at which the ray hit
 	FrontFace bool       // FrontFace whether faces the front
 	Material  Material   // Material that the object is made from
+	Object    int        // Object index of the object hit in the list it's in
 }
 
 // SetFaceNormal determines the normal to the surface
@@ -41,16 +47,34 @@ func (hl HittableList) Hit(r ray.Ray, tmin float64, tmax float64, rec *HitRecord
 	hitAnything := false
 	closest := tmax
 
-	for _, obj := range hl.Data {
+	for i, obj := range hl.Data {
 		if obj.Hit(r, tmin, closest, rec) {
 			hitAnything = true
 			closest = rec.T
+			rec.Object = i
 		}
 	}
 
 	return hitAnything
 }
 
+// MaterialIDs numbers the materials the objects are made of from 1, in the
+// order they're first used. Objects made of equal materials share a number.
+func (hl HittableList) MaterialIDs() map[Material]int {
+	ids := make(map[Material]int)
+	for _, obj := range hl.Data {
+		made, ok := obj.(Made)
+		if !ok {
+			continue
+		}
+		m := made.Material()
+		if _, ok := ids[m]; m != nil && !ok {
+			ids[m] = len(ids) + 1
+		}
+	}
+	return ids
+}
+
 // Add appends an Hittable element to the Data slice
 func (hl *HittableList) Add(elem Hittable) {
 	if hl.Data == nil {
@@ -103,6 +127,14 @@ func (hs *Hittables) UnmarshalJSON(data []byte) error {
 			if err != nil {
 				return err
 			}
+		case "box":
+			actual, err = newBox(obj)
+			if err != nil {
+				return err
+			}
+		}
+		if tr, ok := obj["transform"].(map[string]interface{}); ok && actual != nil {
+			actual = newTransform(tr).Apply(actual)
 		}
 
 		*hs = append(*hs, actual)
@@ -0,0 +1,31 @@
+package objects
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMaterialIDs(t *testing.T) {
+	var hs Hittables
+	err := json.Unmarshal([]byte(`[
+		{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 1, "mat": {"type": "lambertian", "albedo": {"x": 1, "y": 0, "z": 0}}},
+		{"type": "triangle", "v0": {"x": 0, "y": 0, "z": 0}, "v1": {"x": 1, "y": 0, "z": 0}, "v2": {"x": 0, "y": 1, "z": 0}, "mat": {"type": "metal", "albedo": {"x": 1, "y": 1, "z": 1}}},
+		{"type": "rectangle", "a": {"x": 0, "y": 0, "z": 0}, "w": {"x": 1, "y": 0, "z": 0}, "h": {"x": 0, "y": 1, "z": 0}, "mat": {"type": "lambertian", "albedo": {"x": 1, "y": 0, "z": 0}}},
+		{"type": "box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "mat": {"type": "dielectric", "refindex": 1.5}}
+	]`), &hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := HittableList{Data: hs}
+	ids := list.MaterialIDs()
+	// The rectangle's material is the same as the sphere's
+	expected := []int{1, 2, 1, 3}
+	if len(ids) != 3 {
+		t.Errorf("%d materials numbered, want 3", len(ids))
+	}
+	for i, obj := range hs {
+		if id := ids[obj.(Made).Material()]; id != expected[i] {
+			t.Errorf("object %d has material %d, want %d", i, id, expected[i])
+		}
+	}
+}
@@ -6,13 +6,26 @@ import (
 	"strings"
 
 	"github.com/vfrazao-ns1/raytracing1weekend/ray"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
 	"github.com/vfrazao-ns1/raytracing1weekend/utils"
 	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
 )
 
 // A Material is an interface representing any possible material
 type Material interface {
-	Scatter(ray.Ray, HitRecord, *vec3.Color, *ray.Ray) bool
+	Scatter(ray.Ray, HitRecord, *vec3.Color, *ray.Ray, sampler.Sampler) bool
+	// Color is the albedo of the material, the fraction of light it reflects
+	// whichever way it's reflected
+	Color() vec3.Color
+}
+
+// A BRDF is a Material whose reflectance can be evaluated for any incoming direction,
+// which is needed to shade lights that are sampled explicitly. Specular materials
+// (Metal, DiElectric) only reflect in a single direction so they don't implement it.
+type BRDF interface {
+	Eval(rIn ray.Ray, rec HitRecord, wi vec3.Vec3) vec3.Color
+	// PDF is the probability density of Scatter picking direction wi
+	PDF(rIn ray.Ray, rec HitRecord, wi vec3.Vec3) float64
 }
 
 func newMaterial(matInferface map[string]interface{}) (Material, error) {
@@ -62,8 +75,8 @@ type Lambertian struct {
 }
 
 // Scatter calculates the color attenuation and scattering
-func (l Lambertian) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray) bool {
-	scatterDir := rec.Normal.Add(utils.RandomUnitVector())
+func (l Lambertian) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray, s sampler.Sampler) bool {
+	scatterDir := rec.Normal.Add(sampler.UnitVector(s))
 
 	scattered.Origin = rec.P
 	scattered.Direction = scatterDir
@@ -72,6 +85,25 @@ func (l Lambertian) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color,
 	return true
 }
 
+// Color implements `Material` for Lambertian
+func (l Lambertian) Color() vec3.Color {
+	return l.Albedo
+}
+
+// Eval implements `BRDF` for Lambertian, light is scattered equally in all directions
+func (l Lambertian) Eval(rIn ray.Ray, rec HitRecord, wi vec3.Vec3) vec3.Color {
+	return l.Albedo.ScalarDiv(math.Pi)
+}
+
+// PDF implements `BRDF` for Lambertian, Scatter picks cosine weighted directions
+func (l Lambertian) PDF(rIn ray.Ray, rec HitRecord, wi vec3.Vec3) float64 {
+	cosTheta := rec.Normal.Dot(wi.Unit())
+	if cosTheta <= 0 {
+		return 0
+	}
+	return cosTheta / math.Pi
+}
+
 // Metal material type
 type Metal struct {
 	Albedo vec3.Color // Albedo of the material (basically how reflective it is)
@@ -79,23 +111,28 @@ type Metal struct {
 }
 
 // Scatter calculates the color attenuation and scattering
-func (m Metal) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray) bool {
+func (m Metal) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray, s sampler.Sampler) bool {
 	reflected := vec3.Reflect(rIn.Direction.Unit(), rec.Normal)
 
 	scattered.Origin = rec.P
-	scattered.Direction = reflected.Add(utils.RandomVec3InUnitSphere().ScalarMul(m.Fuzz))
+	scattered.Direction = reflected.Add(sampler.InUnitSphere(s).ScalarMul(m.Fuzz))
 
 	*attenuation = m.Albedo
 	return scattered.Direction.Dot(rec.Normal) > 0
 }
 
+// Color implements `Material` for Metal
+func (m Metal) Color() vec3.Color {
+	return m.Albedo
+}
+
 // DiElectric materials like glass and water
 type DiElectric struct {
 	RefIndex float64
 }
 
 // Scatter implements `Material` interface for DiElectric
-func (d DiElectric) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray) bool {
+func (d DiElectric) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color, scattered *ray.Ray, s sampler.Sampler) bool {
 	*attenuation = vec3.Color{X: 1, Y: 1, Z: 1}
 	var etaiOverEtat float64
 
@@ -109,7 +146,7 @@ func (d DiElectric) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color,
 	cosTheta := utils.Fmin(unitDirection.Negate().Dot(rec.Normal), 1.0)
 	sinTheta := math.Sqrt(1.0 - cosTheta*cosTheta)
 
-	if etaiOverEtat*sinTheta > 1.0 || utils.RandomDouble() < d.schlick(cosTheta, etaiOverEtat) {
+	if etaiOverEtat*sinTheta > 1.0 || s.Get1D() < d.schlick(cosTheta, etaiOverEtat) {
 		reflected := vec3.Reflect(unitDirection, rec.Normal)
 		scattered.Origin = rec.P
 		scattered.Direction = reflected
@@ -122,6 +159,11 @@ func (d DiElectric) Scatter(rIn ray.Ray, rec HitRecord, attenuation *vec3.Color,
 	return true
 }
 
+// Color implements `Material` for DiElectric, which lets all light through
+func (d DiElectric) Color() vec3.Color {
+	return vec3.Color{X: 1, Y: 1, Z: 1}
+}
+
 func (d DiElectric) schlick(cosine, refindex float64) float64 {
 	r0 := (1 - refindex) / (1 + refindex)
 	r0 = r0 * r0
@@ -93,6 +93,11 @@ func newRectangle(obj map[string]interface{}) (*Rectangle, error) {
 	return &r, nil
 }
 
+// Material implements `Made` for Rectangle
+func (r Rectangle) Material() Material {
+	return r.Mat
+}
+
 // Hit checks if a ray intersects with the triangle
 func (r Rectangle) Hit(ray ray.Ray, tmin float64, tmax float64, rec *HitRecord) bool {
 	if hit := r.t1.Hit(ray, tmin, tmax, rec); hit {
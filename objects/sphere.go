@@ -41,6 +41,11 @@ func newSphere(obj map[string]interface{}) (*Sphere, error) {
 	return &s, nil
 }
 
+// Material implements `Made` for Sphere
+func (s Sphere) Material() Material {
+	return s.Mat
+}
+
 // Hit checks if a ray intersects with the sphere
 func (s Sphere) Hit(ray ray.Ray, tmin float64, tmax float64, rec *HitRecord) bool {
 	// vector origin -> center
@@ -0,0 +1,119 @@
+package objects
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Transform moves, turns and scales an object about its center. Objects take
+// one from the "transform" of their JSON, which gives every kind of object the
+// same properties to animate.
+type Transform struct {
+	Translate vec3.Vec3 // Translate offset of the object
+	Rotate    vec3.Vec3 // Rotate degrees to turn the object about the X, then the Y, then the Z axis through its center
+	Scale     float64   // Scale factor of the object's size, 0 leaves it alone
+}
+
+func newTransform(obj map[string]interface{}) Transform {
+	t := Transform{}
+	if v, ok := obj["translate"].(map[string]interface{}); ok {
+		t.Translate = vec3FromJSON(v)
+	}
+	if v, ok := obj["rotate"].(map[string]interface{}); ok {
+		t.Rotate = vec3FromJSON(v)
+	}
+	if s, ok := obj["scale"].(float64); ok {
+		t.Scale = s
+	}
+	return t
+}
+
+// vec3FromJSON reads a {"x", "y", "z"} vector, missing components are 0
+func vec3FromJSON(v map[string]interface{}) vec3.Vec3 {
+	x, _ := v["x"].(float64)
+	y, _ := v["y"].(float64)
+	z, _ := v["z"].(float64)
+	return vec3.Vec3{X: x, Y: y, Z: z}
+}
+
+// rotate turns v by the rotation of the transform
+func (t Transform) rotate(v vec3.Vec3) vec3.Vec3 {
+	rx, ry, rz := t.Rotate.X*math.Pi/180, t.Rotate.Y*math.Pi/180, t.Rotate.Z*math.Pi/180
+	v = vec3.Vec3{X: v.X, Y: v.Y*math.Cos(rx) - v.Z*math.Sin(rx), Z: v.Y*math.Sin(rx) + v.Z*math.Cos(rx)}
+	v = vec3.Vec3{X: v.X*math.Cos(ry) + v.Z*math.Sin(ry), Y: v.Y, Z: -v.X*math.Sin(ry) + v.Z*math.Cos(ry)}
+	return vec3.Vec3{X: v.X*math.Cos(rz) - v.Y*math.Sin(rz), Y: v.X*math.Sin(rz) + v.Y*math.Cos(rz), Z: v.Z}
+}
+
+// scale returns the scale factor, 1 when it's left at 0
+func (t Transform) scale() float64 {
+	if t.Scale == 0 {
+		return 1
+	}
+	return t.Scale
+}
+
+// point transforms p, part of an object whose center is center
+func (t Transform) point(p, center vec3.Point) vec3.Point {
+	return center.Add(t.Translate).Add(t.rotate(p.Sub(center).ScalarMul(t.scale())))
+}
+
+// Center returns the center of an object, false for objects other than
+// spheres, triangles, rectangles and boxes
+func Center(h Hittable) (vec3.Point, bool) {
+	switch o := h.(type) {
+	case *Sphere:
+		return o.Center, true
+	case Sphere:
+		return o.Center, true
+	case *Triangle:
+		return o.V0.Add(o.V1).Add(o.V2).ScalarDiv(3), true
+	case Triangle:
+		return o.V0.Add(o.V1).Add(o.V2).ScalarDiv(3), true
+	case *Rectangle:
+		return o.A.Add(o.W).ScalarDiv(2).Add(o.H.ScalarDiv(2)), true
+	case Rectangle:
+		return o.A.Add(o.W).ScalarDiv(2).Add(o.H.ScalarDiv(2)), true
+	case *Box:
+		return o.Corner.Add(o.Edges[0].Add(o.Edges[1]).Add(o.Edges[2]).ScalarDiv(2)), true
+	case Box:
+		return o.Corner.Add(o.Edges[0].Add(o.Edges[1]).Add(o.Edges[2]).ScalarDiv(2)), true
+	}
+	return vec3.Point{}, false
+}
+
+// Apply returns the object transformed. Objects other than spheres, triangles,
+// rectangles and boxes are returned as they are.
+func (t Transform) Apply(h Hittable) Hittable {
+	switch o := h.(type) {
+	case *Sphere:
+		s := *o
+		s.Center = s.Center.Add(t.Translate)
+		s.Radius *= t.scale()
+		return &s
+	case *Triangle:
+		tri := *o
+		center, _ := Center(o)
+		tri.V0, tri.V1, tri.V2 = t.point(tri.V0, center), t.point(tri.V1, center), t.point(tri.V2, center)
+		tri.ComputeEdgesNormal()
+		return &tri
+	case *Rectangle:
+		r := *o
+		center, _ := Center(o)
+		top := t.point(r.A.Add(r.H), center)
+		r.A, r.W = t.point(r.A, center), t.point(r.W, center)
+		r.H = top.Sub(r.A)
+		r.InitRectangle()
+		return &r
+	case *Box:
+		b := *o
+		center, _ := Center(o)
+		b.Corner = t.point(o.Corner, center)
+		for i, e := range o.Edges {
+			b.Edges[i] = t.point(o.Corner.Add(e), center).Sub(b.Corner)
+		}
+		b.InitBox()
+		return &b
+	}
+	return h
+}
@@ -0,0 +1,33 @@
+package objects
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestTransform(t *testing.T) {
+	var hs Hittables
+	err := json.Unmarshal([]byte(`[
+		{"type": "sphere", "center": {"x": 1, "y": 0, "z": 0}, "radius": 0.5,
+		 "transform": {"translate": {"x": 0, "y": 2, "z": 0}, "scale": 2}},
+		{"type": "rectangle", "a": {"x": -1, "y": 0, "z": 0}, "w": {"x": 1, "y": 0, "z": 0}, "h": {"x": 0, "y": 1, "z": 0},
+		 "transform": {"rotate": {"x": 0, "y": 90, "z": 0}, "translate": {"x": 0, "y": 0, "z": 5}}}
+	]`), &hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := hs[0].(*Sphere)
+	if !pointsEqual(s.Center, vec3.Point{X: 1, Y: 2, Z: 0}) || s.Radius != 1 {
+		t.Errorf("sphere is at %v with radius %g, want [1 2 0] and 1", s.Center, s.Radius)
+	}
+	// Turning about Y takes +X to -Z, around the rectangle's center
+	r := hs[1].(*Rectangle)
+	if !pointsEqual(r.A, vec3.Point{X: 0, Y: 0, Z: 6}) || !pointsEqual(r.W, vec3.Point{X: 0, Y: 0, Z: 4}) || !pointsEqual(r.H, vec3.Vec3{X: 0, Y: 1, Z: 0}) {
+		t.Errorf("rectangle is %v %v %v", r.A, r.W, r.H)
+	}
+	if !pointsEqual(r.t2.V2, r.W.Add(r.H)) {
+		t.Errorf("rectangle's triangles weren't moved with it")
+	}
+}
@@ -66,6 +66,11 @@ func (t *Triangle) ComputeEdgesNormal() {
 	t.Normal = t.A.Cross(t.B).Unit()
 }
 
+// Material implements `Made` for Triangle
+func (t Triangle) Material() Material {
+	return t.Mat
+}
+
 // Hit checks if a ray intersects with the triangle
 func (t Triangle) Hit(ray ray.Ray, tmin float64, tmax float64, rec *HitRecord) bool {
 	// Check if ray intersects triangle using the Möller-Trumbore algorithm
@@ -0,0 +1,267 @@
+package physics
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+type shapeKind int
+
+const (
+	sphereShape shapeKind = iota
+	boxShape
+	meshShape // meshShape triangles and rectangles, which never move
+)
+
+// collider is the shape a body collides with
+type collider struct {
+	kind   shapeKind
+	center vec3.Point
+	bound  float64 // bound radius of a sphere around center holding the whole shape
+	// Boxes have unit axes along their edges and half their size along each
+	axes [3]vec3.Vec3
+	half [3]float64
+	tris [][3]vec3.Point // tris of meshes
+}
+
+// newCollider returns the shape of an object, false if it doesn't collide
+func newCollider(h objects.Hittable) (collider, bool) {
+	switch o := h.(type) {
+	case *objects.Sphere:
+		if o.Radius <= 0 {
+			return collider{}, false
+		}
+		return collider{kind: sphereShape, center: o.Center, bound: o.Radius}, true
+	case *objects.Box:
+		c := collider{kind: boxShape}
+		c.center, _ = objects.Center(o)
+		for i, e := range o.Edges {
+			c.axes[i] = e.Unit()
+			c.half[i] = e.Length() / 2
+		}
+		c.bound = math.Sqrt(c.half[0]*c.half[0] + c.half[1]*c.half[1] + c.half[2]*c.half[2])
+		return c, true
+	case *objects.Triangle:
+		return meshCollider([3]vec3.Point{o.V0, o.V1, o.V2}), true
+	case *objects.Rectangle:
+		top := o.A.Add(o.H)
+		return meshCollider([3]vec3.Point{o.A, o.W, top}, [3]vec3.Point{top, o.W, o.W.Add(o.H)}), true
+	}
+	return collider{}, false
+}
+
+func meshCollider(tris ...[3]vec3.Point) collider {
+	c := collider{kind: meshShape, tris: tris}
+	var points []vec3.Point
+	for _, t := range tris {
+		points = append(points, t[:]...)
+	}
+	for _, p := range points {
+		c.center = c.center.Add(p.ScalarDiv(float64(len(points))))
+	}
+	for _, p := range points {
+		c.bound = math.Max(c.bound, p.Sub(c.center).Length())
+	}
+	return c
+}
+
+// volume returns how much space the shape takes up, which makes its mass
+func (c *collider) volume() float64 {
+	if c.kind == sphereShape {
+		return 4 * math.Pi * c.bound * c.bound * c.bound / 3
+	}
+	return 8 * c.half[0] * c.half[1] * c.half[2]
+}
+
+// vertices returns the corners of a box
+func (c *collider) vertices() []vec3.Point {
+	var vs []vec3.Point
+	for _, sx := range []float64{-1, 1} {
+		for _, sy := range []float64{-1, 1} {
+			for _, sz := range []float64{-1, 1} {
+				vs = append(vs, c.center.
+					Add(c.axes[0].ScalarMul(sx*c.half[0])).
+					Add(c.axes[1].ScalarMul(sy*c.half[1])).
+					Add(c.axes[2].ScalarMul(sz*c.half[2])))
+			}
+		}
+	}
+	return vs
+}
+
+// collide tells whether a and b overlap, and if so the direction from b to a
+// that separates them and how deep they are into each other
+func collide(a, b *collider) (n vec3.Vec3, depth float64, ok bool) {
+	if a.center.Sub(b.center).Length() > a.bound+b.bound {
+		return n, 0, false
+	}
+	if a.kind > b.kind {
+		n, depth, ok = collide(b, a)
+		return n.Negate(), depth, ok
+	}
+	switch {
+	case a.kind == sphereShape && b.kind == sphereShape:
+		return sphereSphere(a, b)
+	case a.kind == sphereShape && b.kind == boxShape:
+		return sphereBox(a, b)
+	case a.kind == sphereShape && b.kind == meshShape:
+		return sphereMesh(a, b)
+	case a.kind == boxShape && b.kind == boxShape:
+		return boxBox(a, b)
+	case a.kind == boxShape && b.kind == meshShape:
+		return boxMesh(a, b)
+	}
+	return n, 0, false
+}
+
+func sphereSphere(a, b *collider) (vec3.Vec3, float64, bool) {
+	d := a.center.Sub(b.center)
+	dist := d.Length()
+	if dist >= a.bound+b.bound {
+		return vec3.Vec3{}, 0, false
+	}
+	if dist == 0 {
+		return vec3.Vec3{Y: 1}, a.bound + b.bound, true
+	}
+	return d.ScalarDiv(dist), a.bound + b.bound - dist, true
+}
+
+func sphereBox(s, b *collider) (vec3.Vec3, float64, bool) {
+	// The sphere's center in the box's axes, and the point of the box closest
+	// to it
+	d := s.center.Sub(b.center)
+	var local, closest [3]float64
+	inside := true
+	for i, axis := range b.axes {
+		local[i] = d.Dot(axis)
+		closest[i] = math.Max(-b.half[i], math.Min(b.half[i], local[i]))
+		if closest[i] != local[i] {
+			inside = false
+		}
+	}
+	if inside {
+		// Out through the nearest face
+		best, depth := 0, math.Inf(1)
+		for i := range local {
+			if gap := b.half[i] - math.Abs(local[i]); gap < depth {
+				best, depth = i, gap
+			}
+		}
+		n := b.axes[best]
+		if local[best] < 0 {
+			n = n.Negate()
+		}
+		return n, depth + s.bound, true
+	}
+	q := b.center
+	for i, axis := range b.axes {
+		q = q.Add(axis.ScalarMul(closest[i]))
+	}
+	away := s.center.Sub(q)
+	dist := away.Length()
+	if dist >= s.bound {
+		return vec3.Vec3{}, 0, false
+	}
+	return away.ScalarDiv(dist), s.bound - dist, true
+}
+
+func sphereMesh(s, m *collider) (n vec3.Vec3, depth float64, ok bool) {
+	for _, t := range m.tris {
+		q := closestOnTriangle(s.center, t)
+		away := s.center.Sub(q)
+		dist := away.Length()
+		if dist >= s.bound || s.bound-dist <= depth {
+			continue
+		}
+		n, depth, ok = away.ScalarDiv(dist), s.bound-dist, true
+		if dist == 0 {
+			// Right on the face, pushed out the side it's facing
+			n = t[1].Sub(t[0]).Cross(t[2].Sub(t[0])).Unit()
+		}
+	}
+	return n, depth, ok
+}
+
+// boxBox separates boxes along whichever of their face directions they
+// overlap least on. Edges running into each other are left out.
+func boxBox(a, b *collider) (n vec3.Vec3, depth float64, ok bool) {
+	d := a.center.Sub(b.center)
+	depth = math.Inf(1)
+	for _, axis := range append(a.axes[:], b.axes[:]...) {
+		var ra, rb float64
+		for i := 0; i < 3; i++ {
+			ra += a.half[i] * math.Abs(a.axes[i].Dot(axis))
+			rb += b.half[i] * math.Abs(b.axes[i].Dot(axis))
+		}
+		gap := d.Dot(axis)
+		overlap := ra + rb - math.Abs(gap)
+		if overlap <= 0 {
+			return vec3.Vec3{}, 0, false
+		}
+		if overlap < depth {
+			depth, n = overlap, axis
+			if gap < 0 {
+				n = axis.Negate()
+			}
+		}
+	}
+	return n, depth, true
+}
+
+// boxMesh pushes a box out of the faces its corners went through
+func boxMesh(b, m *collider) (n vec3.Vec3, depth float64, ok bool) {
+	for _, t := range m.tris {
+		normal := t[1].Sub(t[0]).Cross(t[2].Sub(t[0])).Unit()
+		// The box is on the side its center is
+		if b.center.Sub(t[0]).Dot(normal) < 0 {
+			normal = normal.Negate()
+		}
+		for _, v := range b.vertices() {
+			below := -v.Sub(t[0]).Dot(normal)
+			if below <= depth || below > 2*b.bound {
+				continue
+			}
+			// Only corners over the face itself
+			if q := closestOnTriangle(v, t); math.Abs(v.Sub(q).Length()-below) > 1e-6*b.bound {
+				continue
+			}
+			n, depth, ok = normal, below, true
+		}
+	}
+	return n, depth, ok
+}
+
+// closestOnTriangle returns the point of triangle t closest to p (from Ericson's
+// Real-Time Collision Detection)
+func closestOnTriangle(p vec3.Point, t [3]vec3.Point) vec3.Point {
+	a, b, c := t[0], t[1], t[2]
+	ab, ac, ap := b.Sub(a), c.Sub(a), p.Sub(a)
+	d1, d2 := ab.Dot(ap), ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+	bp := p.Sub(b)
+	d3, d4 := ab.Dot(bp), ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+	if vc := d1*d4 - d3*d2; vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.ScalarMul(d1 / (d1 - d3)))
+	}
+	cp := p.Sub(c)
+	d5, d6 := ab.Dot(cp), ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+	if vb := d5*d2 - d1*d6; vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.ScalarMul(d2 / (d2 - d6)))
+	}
+	if va := d3*d6 - d5*d4; va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return b.Add(c.Sub(b).ScalarMul((d4 - d3) / ((d4 - d3) + (d5 - d6))))
+	}
+	va, vb, vc := d3*d6-d5*d4, d5*d2-d1*d6, d1*d4-d3*d2
+	denom := 1 / (va + vb + vc)
+	return a.Add(ab.ScalarMul(vb * denom)).Add(ac.ScalarMul(vc * denom))
+}
@@ -0,0 +1,163 @@
+// Package physics moves the objects of animated worlds as rigid bodies. Bodies
+// fall under gravity and bounce off each other and the objects that don't
+// move, but don't spin.
+package physics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Body is an object of the world in the simulation
+type Body struct {
+	Object   objects.Hittable // Object as it is at the start
+	Velocity vec3.Vec3        // Velocity in units per second
+	Mass     float64          // Mass 0 is worked out from the size of the object
+	Static   bool             // Static bodies stay where they are, the others bounce off them
+	shape    collider
+	collides bool // collides false for objects that everything goes through
+	start    vec3.Point
+}
+
+// Moved returns how far the body has gone from where it started
+func (b *Body) Moved() vec3.Vec3 {
+	return b.shape.center.Sub(b.start)
+}
+
+// inverseMass returns 1 over the mass, 0 for bodies that don't move
+func (b *Body) inverseMass() float64 {
+	if b.Static {
+		return 0
+	}
+	return 1 / b.Mass
+}
+
+// World steps its bodies forward in time
+type World struct {
+	Gravity     vec3.Vec3 // Gravity acceleration of every moving body
+	Restitution float64   // Restitution share of the speed bodies bounce back with, from 0 to 1
+	TimeStep    float64   // TimeStep seconds the simulation moves on by at a time
+	Bodies      []*Body
+	steps       int
+}
+
+const (
+	// passes is how many times a step goes over the contacts, bodies pushed
+	// out of one can end up in another
+	passes = 4
+	// slop is how deep bodies can sink into each other before being pushed out,
+	// which keeps resting bodies from jittering
+	slop = 1e-4
+)
+
+// NewWorld sets up a simulation of bodies. Spheres and boxes can move, and
+// hollow spheres, with a negative radius, are left out of collisions. Objects
+// other than spheres, boxes, triangles and rectangles go through everything.
+func NewWorld(bodies []Body, gravity vec3.Vec3, restitution, timeStep float64) (*World, error) {
+	if timeStep <= 0 {
+		return nil, fmt.Errorf("time step must be positive, not %g", timeStep)
+	}
+	w := &World{Gravity: gravity, Restitution: restitution, TimeStep: timeStep}
+	for i := range bodies {
+		b := bodies[i]
+		shape, ok := newCollider(b.Object)
+		if !b.Static {
+			if !ok || shape.kind == meshShape {
+				return nil, fmt.Errorf("object %d can't move, only spheres and boxes can", i)
+			}
+			if b.Mass == 0 {
+				b.Mass = shape.volume()
+			}
+			if b.Mass <= 0 {
+				return nil, fmt.Errorf("object %d has a mass of %g", i, b.Mass)
+			}
+		}
+		b.shape, b.collides, b.start = shape, ok, shape.center
+		w.Bodies = append(w.Bodies, &b)
+	}
+	return w, nil
+}
+
+// Time returns how many seconds have been simulated
+func (w *World) Time() float64 {
+	return float64(w.steps) * w.TimeStep
+}
+
+// Advance steps the world to time t. Worlds don't go back in time, and the
+// same time is always reached with the same steps.
+func (w *World) Advance(t float64) {
+	for target := int(math.Round(t / w.TimeStep)); w.steps < target; w.steps++ {
+		w.step(w.TimeStep)
+	}
+}
+
+// step moves the bodies on by dt seconds and pushes apart the ones that ran
+// into each other
+func (w *World) step(dt float64) {
+	for _, b := range w.Bodies {
+		if b.Static {
+			continue
+		}
+		b.Velocity = b.Velocity.Add(w.Gravity.ScalarMul(dt))
+		b.shape.center = b.shape.center.Add(b.Velocity.ScalarMul(dt))
+	}
+	// Bodies coming together slower than gravity alone makes them in a few
+	// steps are resting on each other, bouncing them would never let them
+	// settle
+	resting := 2 * w.Gravity.Length() * dt
+	for pass := 0; pass < passes; pass++ {
+		for i, a := range w.Bodies {
+			if !a.collides {
+				continue
+			}
+			for _, b := range w.Bodies[i+1:] {
+				if !b.collides || a.Static && b.Static {
+					continue
+				}
+				if n, depth, ok := collide(&a.shape, &b.shape); ok {
+					w.resolve(a, b, n, depth, resting)
+				}
+			}
+		}
+	}
+}
+
+// resolve separates a and b, which overlap by depth along n pointing from b to
+// a, and bounces them off each other if they're coming together
+func (w *World) resolve(a, b *Body, n vec3.Vec3, depth, resting float64) {
+	ia, ib := a.inverseMass(), b.inverseMass()
+	sum := ia + ib
+	if sum == 0 {
+		return
+	}
+	if push := math.Max(depth-slop, 0) * 0.8 / sum; push > 0 {
+		a.shape.center = a.shape.center.Add(n.ScalarMul(push * ia))
+		b.shape.center = b.shape.center.Sub(n.ScalarMul(push * ib))
+	}
+	closing := a.Velocity.Sub(b.Velocity).Dot(n)
+	if closing >= 0 {
+		return
+	}
+	e := w.Restitution
+	if -closing < resting {
+		e = 0
+	}
+	j := -(1 + e) * closing / sum
+	a.Velocity = a.Velocity.Add(n.ScalarMul(j * ia))
+	b.Velocity = b.Velocity.Sub(n.ScalarMul(j * ib))
+}
+
+// Place puts the bodies that moved where they are now. hs are the objects of
+// the world, in the order of the bodies, and can be changed since the start
+// by anything but their position.
+func (w *World) Place(hs []objects.Hittable) {
+	for i, b := range w.Bodies {
+		if i >= len(hs) || b.Static {
+			continue
+		}
+		hs[i] = objects.Transform{Translate: b.Moved()}.Apply(hs[i])
+	}
+}
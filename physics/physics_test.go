@@ -0,0 +1,155 @@
+package physics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+var gravity = vec3.Vec3{Y: -9.81}
+
+// ground is a static floor at y = 0
+func ground() Body {
+	r := &objects.Rectangle{A: vec3.Point{X: -10, Z: 10}, W: vec3.Point{X: 10, Z: 10}, H: vec3.Vec3{Z: -20}}
+	return Body{Object: r, Static: true}
+}
+
+func ball(center vec3.Point, radius float64, velocity vec3.Vec3) Body {
+	return Body{Object: &objects.Sphere{Center: center, Radius: radius}, Velocity: velocity}
+}
+
+func box(min, max vec3.Point) Body {
+	b := &objects.Box{Corner: min, Edges: [3]vec3.Vec3{{X: max.X - min.X}, {Y: max.Y - min.Y}, {Z: max.Z - min.Z}}}
+	b.InitBox()
+	return Body{Object: b}
+}
+
+func center(b *Body) vec3.Point {
+	return b.shape.center
+}
+
+func TestRest(t *testing.T) {
+	w, err := NewWorld([]Body{
+		ground(),
+		ball(vec3.Point{X: -2, Y: 3}, 0.5, vec3.Vec3{}),
+		box(vec3.Point{X: 1, Y: 2, Z: -1}, vec3.Point{X: 3, Y: 3, Z: 1}),
+		// Stacked on the box
+		ball(vec3.Point{X: 2, Y: 5}, 0.25, vec3.Vec3{}),
+	}, gravity, 0.5, 1.0/240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Advance(4)
+	for i, want := range map[int]float64{1: 0.5, 2: 0.5, 3: 1.25} {
+		b := w.Bodies[i]
+		if y := center(b).Y; math.Abs(y-want) > 0.01 {
+			t.Errorf("body %d rests at %g, want %g", i, y, want)
+		}
+		if v := b.Velocity.Length(); v > 0.05 {
+			t.Errorf("body %d still moves at %g", i, v)
+		}
+	}
+}
+
+func TestBounce(t *testing.T) {
+	// Without losing speed the ball comes back up to where it fell from
+	w, err := NewWorld([]Body{ground(), ball(vec3.Point{Y: 2}, 0.5, vec3.Vec3{})}, gravity, 1, 1.0/1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, bounced := 0.0, false
+	for i := 1; i <= 1500; i++ {
+		w.Advance(float64(i) / 1000)
+		b := w.Bodies[1]
+		bounced = bounced || b.Velocity.Y > 0
+		if bounced {
+			top = math.Max(top, center(b).Y)
+		}
+	}
+	if math.Abs(top-2) > 0.05 {
+		t.Errorf("ball bounces up to %g, want 2", top)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// Balls hitting head on keep their momentum, equal ones trade velocities
+	for _, c := range []struct {
+		mass        float64
+		va, vb      float64
+		restitution float64
+	}{
+		{1, -1, 1, 1},
+		{3, 0, 2, 1},
+		{1, 0, 0, 0},
+	} {
+		a := ball(vec3.Point{X: -1}, 0.5, vec3.Vec3{X: 1})
+		a.Mass = c.mass
+		b := ball(vec3.Point{X: 1}, 0.5, vec3.Vec3{X: -1})
+		b.Mass = 1
+		w, err := NewWorld([]Body{a, b}, vec3.Vec3{}, c.restitution, 1.0/240)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Advance(2)
+		va, vb := w.Bodies[0].Velocity.X, w.Bodies[1].Velocity.X
+		if math.Abs(va-c.va) > 1e-9 || math.Abs(vb-c.vb) > 1e-9 {
+			t.Errorf("mass %g, restitution %g: velocities are %g and %g, want %g and %g", c.mass, c.restitution, va, vb, c.va, c.vb)
+		}
+		if p := va*c.mass + vb; math.Abs(p-(c.mass-1)) > 1e-9 {
+			t.Errorf("mass %g, restitution %g: momentum went from %g to %g", c.mass, c.restitution, c.mass-1, p)
+		}
+	}
+}
+
+func TestGoThrough(t *testing.T) {
+	// A hollow sphere and a list of objects don't collide, the ball flies
+	// through the origin and out of the hollow sphere
+	w, err := NewWorld([]Body{
+		{Object: &objects.Sphere{Center: vec3.Point{X: 5}, Radius: -1}, Static: true},
+		{Object: objects.HittableList{}, Static: true},
+		ball(vec3.Point{X: -3}, 0.5, vec3.Vec3{X: 4}),
+	}, vec3.Vec3{}, 0.5, 1.0/240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Advance(2)
+	if c := center(w.Bodies[2]); c.Sub(vec3.Point{X: 5}).Length() > 1e-6 {
+		t.Errorf("ball ended up at %v, want [5 0 0]", c)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	bodies := func() []Body {
+		return []Body{ground(), ball(vec3.Point{Y: 3}, 0.5, vec3.Vec3{X: 1}), box(vec3.Point{X: 0.5, Y: 5}, vec3.Point{X: 1, Y: 5.5, Z: 0.5})}
+	}
+	// A world advanced frame by frame ends up where one advanced at once does
+	a, _ := NewWorld(bodies(), gravity, 0.7, 1.0/240)
+	b, _ := NewWorld(bodies(), gravity, 0.7, 1.0/240)
+	for i := 1; i <= 48; i++ {
+		a.Advance(float64(i) / 24)
+	}
+	b.Advance(2)
+	for i := range a.Bodies {
+		if center(a.Bodies[i]) != center(b.Bodies[i]) {
+			t.Errorf("body %d is at %v and %v", i, center(a.Bodies[i]), center(b.Bodies[i]))
+		}
+	}
+
+	hs := []objects.Hittable{a.Bodies[0].Object, a.Bodies[1].Object, a.Bodies[2].Object}
+	a.Place(hs)
+	if hs[0] != a.Bodies[0].Object {
+		t.Errorf("the ground was moved")
+	}
+	if s := hs[1].(*objects.Sphere); s.Center.Sub(center(a.Bodies[1])).Length() > 1e-9 {
+		t.Errorf("ball is placed at %v, want %v", s.Center, center(a.Bodies[1]))
+	}
+	if c, _ := objects.Center(hs[2]); c.Sub(center(a.Bodies[2])).Length() > 1e-9 {
+		t.Errorf("box is placed at %v, want %v", c, center(a.Bodies[2]))
+	}
+
+	if _, err := NewWorld([]Body{{Object: ground().Object}}, gravity, 0, 1.0/240); err == nil {
+		t.Errorf("a rectangle was let move")
+	}
+}
@@ -20,6 +20,6 @@ func (p PPM) PrintFile() {
 	fmt.Printf("%d %d\n", p.Width, p.Height)
 	fmt.Printf("%d\n", p.MaxColor)
 	for _, pixel := range p.Pixels {
-		fmt.Printf("%s\n", pixel.ColorString())
+		fmt.Printf("%s\n", pixel.ColorString(1))
 	}
 }
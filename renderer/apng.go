@@ -0,0 +1,136 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// APNGRenderer writes frames as an animated PNG looping forever. The frames are
+// lossless, unlike GIF's, and viewers that don't know APNG show the first.
+type APNGRenderer struct{}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngChunk is a chunk of a PNG file
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// readPNGChunks splits a PNG file into its chunks
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) >= 12 {
+		n := int(binary.BigEndian.Uint32(data))
+		if len(data) < 12+n {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{string(data[4:8]), data[8 : 8+n]})
+		data = data[12+n:]
+	}
+	return chunks, nil
+}
+
+// writePNGChunk writes a chunk with its length and CRC
+func writePNGChunk(w io.Writer, kind string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	copy(header[4:], kind)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+	for _, b := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderAnimation implements `AnimationRenderer` for APNGRenderer. Every frame
+// is encoded as a PNG of its own whose image data is moved into frame chunks,
+// so they all have to come out with the same header.
+func (APNGRenderer) RenderAnimation(w io.Writer, frames []image.Image, fps int) error {
+	if len(frames) == 0 {
+		return errors.New("no frames to animate")
+	}
+	if fps <= 0 || fps > 0xffff {
+		return errors.New("frames per second must be between 1 and 65535")
+	}
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+	var ihdr []byte
+	seq := uint32(0)
+	for i, frame := range frames {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, frame); err != nil {
+			return err
+		}
+		chunks, err := readPNGChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if chunks[0].kind != "IHDR" {
+			return errors.New("PNG doesn't start with its header")
+		}
+		if i == 0 {
+			ihdr = chunks[0].data
+			if err := writePNGChunk(w, "IHDR", ihdr); err != nil {
+				return err
+			}
+			// Frames and plays, 0 for forever
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+			if err := writePNGChunk(w, "acTL", actl); err != nil {
+				return err
+			}
+		} else if !bytes.Equal(chunks[0].data, ihdr) {
+			return fmt.Errorf("frame %d has a different size or color type than the first", i)
+		}
+
+		// Sequence number, size, offset, delay as a fraction of a second,
+		// dispose and blend operations, both left at none and source
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl, seq)
+		copy(fctl[4:12], ihdr[:8])
+		binary.BigEndian.PutUint16(fctl[20:], 1)
+		binary.BigEndian.PutUint16(fctl[22:], uint16(fps))
+		seq++
+		if err := writePNGChunk(w, "fcTL", fctl); err != nil {
+			return err
+		}
+		for _, c := range chunks {
+			if c.kind != "IDAT" {
+				continue
+			}
+			// The first frame is the image shown by viewers that don't know
+			// APNG, the others go in frame data chunks that also count
+			if i == 0 {
+				err = writePNGChunk(w, "IDAT", c.data)
+			} else {
+				fdat := make([]byte, 4, 4+len(c.data))
+				binary.BigEndian.PutUint32(fdat, seq)
+				seq++
+				err = writePNGChunk(w, "fdAT", append(fdat, c.data...))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return writePNGChunk(w, "IEND", nil)
+}
@@ -0,0 +1,154 @@
+package renderer
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Denoiser smooths the noise of an image rendered with few samples with an
+// edge-avoiding à-trous wavelet filter (Dammertz et al. 2010). Every iteration
+// blurs with a 5x5 B3 spline whose taps spread twice as far as the last's,
+// weighting them down where the colors or the features differ. The image is
+// divided by the albedo first so textures come out as sharp as they went in.
+type Denoiser struct {
+	Iterations  int     // Iterations of the filter, defaults to 5 for a 61 pixel wide kernel
+	SigmaColor  float64 // SigmaColor tolerance to color differences, halved every iteration, defaults to 0.5
+	SigmaNormal float64 // SigmaNormal tolerance to normal differences, defaults to 0.3
+	SigmaAlbedo float64 // SigmaAlbedo tolerance to albedo differences, defaults to 0.1
+	SigmaDepth  float64 // SigmaDepth tolerance to depth differences relative to the depth, per pixel, defaults to 0.05
+}
+
+// DenoiseFeatures are what the camera saw in every pixel, which guides the
+// denoiser along the edges of things. Any of them can be nil.
+type DenoiseFeatures struct {
+	Albedo *Film
+	Normal *Film
+	Depth  *Film
+}
+
+// withDefaults fills in the settings left at 0
+func (d Denoiser) withDefaults() Denoiser {
+	if d.Iterations == 0 {
+		d.Iterations = 5
+	}
+	if d.SigmaColor == 0 {
+		d.SigmaColor = 0.5
+	}
+	if d.SigmaNormal == 0 {
+		d.SigmaNormal = 0.3
+	}
+	if d.SigmaAlbedo == 0 {
+		d.SigmaAlbedo = 0.1
+	}
+	if d.SigmaDepth == 0 {
+		d.SigmaDepth = 0.05
+	}
+	return d
+}
+
+// the B3 spline the filter spreads out
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// pixels returns the colors of a film, nil for a nil film
+func pixels(f *Film) []vec3.Vec3 {
+	if f == nil {
+		return nil
+	}
+	px := make([]vec3.Vec3, f.Width*f.Height)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			px[y*f.Width+x] = f.At(x, y)
+		}
+	}
+	return px
+}
+
+// Denoise returns a denoised copy of img
+func (d Denoiser) Denoise(img *Film, features DenoiseFeatures) *Film {
+	d = d.withDefaults()
+	width, height := img.Width, img.Height
+	color := pixels(img)
+	albedo := pixels(features.Albedo)
+	normal := pixels(features.Normal)
+	depth := pixels(features.Depth)
+
+	// Lighting varies less than the textures it falls on
+	const minAlbedo = 1e-3
+	floorAlbedo := func(a vec3.Color) vec3.Color {
+		return vec3.Color{X: math.Max(a.X, minAlbedo), Y: math.Max(a.Y, minAlbedo), Z: math.Max(a.Z, minAlbedo)}
+	}
+	if albedo != nil {
+		for i, c := range color {
+			a := floorAlbedo(albedo[i])
+			color[i] = vec3.Color{X: c.X / a.X, Y: c.Y / a.Y, Z: c.Z / a.Z}
+		}
+	}
+
+	next := make([]vec3.Vec3, len(color))
+	for it := 0; it < d.Iterations; it++ {
+		step := 1 << uint(it)
+		sigmaColor := d.SigmaColor / float64(step)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				p := y*width + x
+				// Colors are compared squashed into [0, 1) so a few very bright
+				// samples don't decide what's an edge
+				cp := squash(color[p])
+				var sum vec3.Color
+				var weights float64
+				for ky := -2; ky <= 2; ky++ {
+					qy := y + ky*step
+					if qy < 0 || qy >= height {
+						continue
+					}
+					for kx := -2; kx <= 2; kx++ {
+						qx := x + kx*step
+						if qx < 0 || qx >= width {
+							continue
+						}
+						q := qy*width + qx
+						w := atrousKernel[kx+2] * atrousKernel[ky+2]
+						e := squash(color[q]).Sub(cp).LengthSquared() / (sigmaColor * sigmaColor)
+						if normal != nil {
+							e += normal[q].Sub(normal[p]).LengthSquared() / (d.SigmaNormal * d.SigmaNormal)
+						}
+						if albedo != nil {
+							e += albedo[q].Sub(albedo[p]).LengthSquared() / (d.SigmaAlbedo * d.SigmaAlbedo)
+						}
+						if depth != nil {
+							// How far apart things may be grows with their
+							// distance and the distance between the pixels
+							dp, dq := depth[p].X, depth[q].X
+							rel := math.Abs(dp-dq) / math.Max(math.Max(dp, dq), 1e-6)
+							dist := d.SigmaDepth * float64(step) * math.Sqrt(float64(kx*kx+ky*ky))
+							if dist > 0 {
+								e += rel * rel / (dist * dist)
+							}
+						}
+						w *= math.Exp(-e)
+						sum = sum.Add(color[q].ScalarMul(w))
+						weights += w
+					}
+				}
+				next[p] = sum.ScalarMul(1 / weights)
+			}
+		}
+		color, next = next, color
+	}
+
+	out := NewFilm(width, height, nil)
+	for i, c := range color {
+		if albedo != nil {
+			a := floorAlbedo(albedo[i])
+			c = c.Mul(a)
+		}
+		out.Set(i%width, i/width, c)
+	}
+	return out
+}
+
+// squash maps colors into [0, 1) like Reinhard's tone mapping
+func squash(c vec3.Color) vec3.Color {
+	return vec3.Color{X: c.X / (1 + c.X), Y: c.Y / (1 + c.Y), Z: c.Z / (1 + c.Z)}
+}
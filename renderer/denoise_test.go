@@ -0,0 +1,66 @@
+package renderer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestDenoise(t *testing.T) {
+	// Noise on two halves of different albedos under different light, which
+	// the denoiser must smooth without blurring one half into the other
+	width, height := 40, 30
+	rng := rand.New(rand.NewSource(1))
+	img := NewFilm(width, height, nil)
+	albedo := NewFilm(width, height, nil)
+	normal := NewFilm(width, height, nil)
+	depth := NewFilm(width, height, nil)
+	albedoAt := func(x int) vec3.Color {
+		if x < width/2 {
+			return vec3.Color{X: 0.8, Y: 0.2, Z: 0.2}
+		}
+		return vec3.Color{X: 0.2, Y: 0.2, Z: 0.8}
+	}
+	irradianceAt := func(x int) float64 {
+		if x < width/2 {
+			return 1
+		}
+		return 3
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := albedoAt(x)
+			img.Set(x, y, a.ScalarMul(irradianceAt(x)*(0.5+rng.Float64())))
+			albedo.Set(x, y, a)
+			normal.Set(x, y, vec3.Vec3{X: 0, Y: 0, Z: 1})
+			depth.Set(x, y, vec3.Vec3{X: 2, Y: 2, Z: 2})
+		}
+	}
+	out := Denoiser{}.Denoise(img, DenoiseFeatures{Albedo: albedo, Normal: normal, Depth: depth})
+
+	// The noise was uniform around the light of each half, its variance is
+	// 1/12 of it. Every column keeps the light of its own half, the columns
+	// along the edge too.
+	var variance float64
+	for x := 0; x < width; x++ {
+		a, e := albedoAt(x), irradianceAt(x)
+		var mean float64
+		for y := 0; y < height; y++ {
+			c := out.At(x, y)
+			for _, l := range []float64{c.X / a.X, c.Y / a.Y, c.Z / a.Z} {
+				variance += (l/e - 1) * (l/e - 1)
+				mean += l / e
+			}
+		}
+		mean /= float64(3 * height)
+		if math.Abs(mean-1) > 0.05 {
+			t.Errorf("column %d has %.3f of the light of its half, the other half bled into it", x, mean)
+		}
+	}
+	variance /= float64(3 * width * height)
+	if variance > 1.0/12/10 {
+		t.Errorf("variance went from %f to %f", 1.0/12, variance)
+	}
+}
@@ -0,0 +1,281 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// EXR compression methods
+const (
+	exrNoCompression  = 0
+	exrZIPCompression = 3 // exrZIPCompression zlib over blocks of 16 scanlines
+)
+
+// EXR pixel types, as numbered in the files
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// EXRRenderer writes the film as an OpenEXR image. Unlike PNG it keeps the
+// colors as they are, linear and unclamped.
+type EXRRenderer struct {
+	Compression string     // Compression one of "zip" (default) or "none"
+	Float       bool       // Float write 32 bit floats rather than 16 bit halves
+	Layers      []EXRLayer // Layers written next to the colors
+}
+
+// An EXRLayer is an extra image in an EXR file, its channels are named after
+// the layer as in "normal.X"
+type EXRLayer struct {
+	Name     string
+	Channels []string // Channels names of the first components of the film's pixels, up to three
+	Film     *Film
+	Float    bool // Float write 32 bit floats even when the colors are halves
+	Uint     bool // Uint write the values as unsigned integers, for IDs and counts
+}
+
+// exrChannel is a channel of an EXR file, component of the film's pixels
+type exrChannel struct {
+	name      string
+	film      *Film
+	component int
+	pixelType int32
+}
+
+// Render implements `Renderer` for EXRRenderer, writing a single part scanline
+// image with B, G and R channels
+func (e EXRRenderer) Render(w io.Writer, film *Film) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	compression := byte(exrZIPCompression)
+	linesPerBlock := 16
+	if strings.ToLower(e.Compression) == "none" {
+		compression = exrNoCompression
+		linesPerBlock = 1
+	}
+	pixelType := int32(exrHalf)
+	if e.Float {
+		pixelType = exrFloat
+	}
+	width, height := film.Width, film.Height
+	channels := []exrChannel{{"R", film, 0, pixelType}, {"G", film, 1, pixelType}, {"B", film, 2, pixelType}}
+	for _, l := range e.Layers {
+		if l.Film.Width != width || l.Film.Height != height {
+			return fmt.Errorf("layer %s is %dx%d, the image %dx%d", l.Name, l.Film.Width, l.Film.Height, width, height)
+		}
+		t := pixelType
+		switch {
+		case l.Uint:
+			t = exrUint
+		case l.Float:
+			t = exrFloat
+		}
+		for i, name := range l.Channels {
+			channels = append(channels, exrChannel{l.Name + "." + name, l.Film, i, t})
+		}
+	}
+	// Channels are listed, and stored, in alphabetical order
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+	lineSize := 0
+	for _, ch := range channels {
+		lineSize += width * exrPixelSize(ch.pixelType)
+	}
+
+	var header bytes.Buffer
+	le := binary.LittleEndian
+	// Magic number and version 2, single part scanline, long names allowed
+	// for the layers
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 4, 0, 0})
+	attribute := func(name, kind string, value []byte) {
+		header.WriteString(name)
+		header.WriteByte(0)
+		header.WriteString(kind)
+		header.WriteByte(0)
+		binary.Write(&header, le, int32(len(value)))
+		header.Write(value)
+	}
+	var chlist bytes.Buffer
+	for _, ch := range channels {
+		chlist.WriteString(ch.name)
+		chlist.WriteByte(0)
+		binary.Write(&chlist, le, []int32{ch.pixelType, 0, 1, 1}) // type, pLinear and reserved, x and y sampling
+	}
+	chlist.WriteByte(0)
+	window := make([]byte, 16)
+	le.PutUint32(window[8:], uint32(width-1))
+	le.PutUint32(window[12:], uint32(height-1))
+	attribute("channels", "chlist", chlist.Bytes())
+	attribute("compression", "compression", []byte{compression})
+	attribute("dataWindow", "box2i", window)
+	attribute("displayWindow", "box2i", window)
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", float32Bytes(1))
+	attribute("screenWindowCenter", "v2f", append(float32Bytes(0), float32Bytes(0)...))
+	attribute("screenWindowWidth", "float", float32Bytes(1))
+	header.WriteByte(0)
+
+	// Every block of scanlines is compressed before the offset table in front
+	// of them can be written
+	numBlocks := (height + linesPerBlock - 1) / linesPerBlock
+	blocks := make([][]byte, numBlocks)
+	for b := range blocks {
+		y0 := b * linesPerBlock
+		y1 := y0 + linesPerBlock
+		if y1 > height {
+			y1 = height
+		}
+		raw := make([]byte, 0, (y1-y0)*lineSize)
+		for y := y0; y < y1; y++ {
+			for _, ch := range channels {
+				for x := 0; x < width; x++ {
+					v := ch.film.At(x, y)
+					value := [3]float64{v.X, v.Y, v.Z}[ch.component]
+					switch ch.pixelType {
+					case exrUint:
+						raw = appendUint32(raw, uint32(math.Max(0, math.Min(value, math.MaxUint32))))
+					case exrHalf:
+						raw = appendUint16(raw, halfFromFloat32(float32(value)))
+					default:
+						raw = appendUint32(raw, math.Float32bits(float32(value)))
+					}
+				}
+			}
+		}
+		if compression == exrZIPCompression {
+			data, err := exrZIP(raw)
+			if err != nil {
+				return err
+			}
+			// Blocks that don't get any smaller are stored as they are
+			if len(data) < len(raw) {
+				raw = data
+			}
+		}
+		chunk := make([]byte, 8, 8+len(raw))
+		le.PutUint32(chunk, uint32(y0))
+		le.PutUint32(chunk[4:], uint32(len(raw)))
+		blocks[b] = append(chunk, raw...)
+	}
+
+	offset := uint64(header.Len() + 8*numBlocks)
+	for _, block := range blocks {
+		binary.Write(&header, le, offset)
+		offset += uint64(len(block))
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate implements `Renderer` for EXRRenderer. The sizes of the layers are
+// checked against the film when it's rendered.
+func (e EXRRenderer) Validate() error {
+	switch strings.ToLower(e.Compression) {
+	case "", "zip", "none":
+	default:
+		return fmt.Errorf("unknown EXR compression %q", e.Compression)
+	}
+	for _, l := range e.Layers {
+		if len(l.Channels) > 3 {
+			return fmt.Errorf("layer %s has more than three channels", l.Name)
+		}
+	}
+	return nil
+}
+
+// exrZIP compresses a block of scanlines the way OpenEXR does: the bytes are
+// split into the even and the odd ones, replaced by the difference with the
+// previous byte, then deflated
+func exrZIP(raw []byte) ([]byte, error) {
+	n := len(raw)
+	split := make([]byte, n)
+	half := (n + 1) / 2
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			split[i/2] = raw[i]
+		} else {
+			split[half+i/2] = raw[i]
+		}
+	}
+	for i := n - 1; i > 0; i-- {
+		split[i] = byte(int(split[i]) - int(split[i-1]) + 128)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(split); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func exrPixelSize(pixelType int32) int {
+	if pixelType == exrHalf {
+		return 2
+	}
+	return 4
+}
+
+func float32Bytes(f float32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, math.Float32bits(f))
+	return b
+}
+
+// halfFromFloat32 converts f to the bits of the nearest 16 bit float, rounding
+// halfway cases to even. Numbers too large for a half become infinity.
+func halfFromFloat32(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		// Infinity stays infinity and NaN stays NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		return sign | 0x7c00
+	case exp-127 >= -14:
+		// Normal half, the rounding may carry into the exponent which is fine
+		h := uint32(exp-127+15)<<10 | mant>>13
+		round := mant & 0x1fff
+		if round > 0x1000 || (round == 0x1000 && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	case exp-127 >= -25:
+		// Subnormal half, the implicit leading 1 becomes explicit
+		mant |= 0x800000
+		shift := uint(-14-(exp-127)) + 13
+		h := mant >> shift
+		round := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if round > halfway || (round == halfway && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	return sign
+}
@@ -0,0 +1,235 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestHalfFromFloat32(t *testing.T) {
+	for _, tc := range []struct {
+		f    float32
+		want uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{65520, 0x7c00}, // halfway to the next power of two rounds up to infinity
+		{1e6, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{6.103515625e-05, 0x0400}, // smallest normal
+		{5.960464477539063e-08, 0x0001},
+		{2.9802322387695312e-08, 0x0000}, // halfway to the smallest subnormal rounds to even
+		{1 + 1.0/2048, 0x3c00},           // halfway rounds to even
+		{1 + 3.0/2048, 0x3c02},
+	} {
+		if got := halfFromFloat32(tc.f); got != tc.want {
+			t.Errorf("halfFromFloat32(%g) = %#04x, want %#04x", tc.f, got, tc.want)
+		}
+	}
+}
+
+// decodeEXR reads back the channels of an image written by EXRRenderer, layers
+// included, as float32 whatever type they were written as
+func decodeEXR(data []byte) (map[string][]float32, error) {
+	le := binary.LittleEndian
+	if le.Uint32(data) != 20000630 {
+		return nil, fmt.Errorf("bad magic number")
+	}
+	r := bytes.NewReader(data[8:])
+	readString := func() string {
+		var s []byte
+		for b, _ := r.ReadByte(); b != 0; b, _ = r.ReadByte() {
+			s = append(s, b)
+		}
+		return string(s)
+	}
+	attrs := map[string][]byte{}
+	for name := readString(); name != ""; name = readString() {
+		readString()
+		var size int32
+		binary.Read(r, le, &size)
+		value := make([]byte, size)
+		r.Read(value)
+		attrs[name] = value
+	}
+	window := attrs["dataWindow"]
+	width := int(int32(le.Uint32(window[8:]))) + 1
+	height := int(int32(le.Uint32(window[12:]))) + 1
+	linesPerBlock := map[byte]int{0: 1, 3: 16}[attrs["compression"][0]]
+
+	var names []string
+	var types, sizes []int
+	chlist := bytes.NewReader(attrs["channels"])
+	for {
+		var s []byte
+		for b, _ := chlist.ReadByte(); b != 0; b, _ = chlist.ReadByte() {
+			s = append(s, b)
+		}
+		if len(s) == 0 {
+			break
+		}
+		var desc [4]int32
+		binary.Read(chlist, le, &desc)
+		names = append(names, string(s))
+		types = append(types, int(desc[0]))
+		sizes = append(sizes, map[int32]int{0: 4, 1: 2, 2: 4}[desc[0]])
+	}
+
+	channels := map[string][]float32{}
+	for _, name := range names {
+		channels[name] = make([]float32, width*height)
+	}
+	numBlocks := (height + linesPerBlock - 1) / linesPerBlock
+	for b := 0; b < numBlocks; b++ {
+		var offset uint64
+		binary.Read(r, le, &offset)
+		y0 := int(int32(le.Uint32(data[offset:])))
+		size := int(le.Uint32(data[offset+4:]))
+		block := data[offset+8 : offset+8+uint64(size)]
+		lines := linesPerBlock
+		if y0+lines > height {
+			lines = height - y0
+		}
+		rawSize := 0
+		for _, s := range sizes {
+			rawSize += s * width * lines
+		}
+		if size < rawSize {
+			zr, err := zlib.NewReader(bytes.NewReader(block))
+			if err != nil {
+				return nil, err
+			}
+			split, err := ioutil.ReadAll(zr)
+			if err != nil {
+				return nil, err
+			}
+			for i := 1; i < len(split); i++ {
+				split[i] = byte(int(split[i-1]) + int(split[i]) - 128)
+			}
+			block = make([]byte, len(split))
+			half := (len(split) + 1) / 2
+			for i := range block {
+				if i%2 == 0 {
+					block[i] = split[i/2]
+				} else {
+					block[i] = split[half+i/2]
+				}
+			}
+		}
+		for y := y0; y < y0+lines; y++ {
+			for c, name := range names {
+				for x := 0; x < width; x++ {
+					switch types[c] {
+					case exrUint:
+						channels[name][y*width+x] = float32(le.Uint32(block))
+					case exrHalf:
+						channels[name][y*width+x] = float32FromHalf(le.Uint16(block))
+					default:
+						channels[name][y*width+x] = math.Float32frombits(le.Uint32(block))
+					}
+					block = block[sizes[c]:]
+				}
+			}
+		}
+	}
+	return channels, nil
+}
+
+func float32FromHalf(h uint16) float32 {
+	exp := int(h>>10) & 0x1f
+	v := math.Ldexp(float64(h&0x3ff), -24)
+	if exp > 0 {
+		v = math.Ldexp(float64(h&0x3ff|0x400), exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return float32(v)
+}
+
+func TestEXRRoundTrip(t *testing.T) {
+	film := testImage(24, 37)
+	for _, compression := range []string{"none", "zip"} {
+		for _, float := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := (EXRRenderer{Compression: compression, Float: float}).Render(&buf, film); err != nil {
+				t.Fatal(err)
+			}
+			channels, err := decodeEXR(buf.Bytes())
+			if err != nil {
+				t.Fatalf("%s, float %t: %s", compression, float, err)
+			}
+			for y := 0; y < film.Height; y++ {
+				for x := 0; x < film.Width; x++ {
+					want := film.At(x, y)
+					for name, w := range map[string]float64{"R": want.X, "G": want.Y, "B": want.Z} {
+						tolerance := 1e-7 * w
+						if !float {
+							tolerance = w / 1024
+						}
+						if got := float64(channels[name][y*film.Width+x]); math.Abs(got-w) > tolerance {
+							t.Fatalf("%s, float %t: %s of pixel (%d, %d) is %g, want %g", compression, float, name, x, y, got, w)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEXRLayers(t *testing.T) {
+	film := testImage(13, 21)
+	ids := NewFilm(film.Width, film.Height, nil)
+	depth := NewFilm(film.Width, film.Height, nil)
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			id := float64(70000 + y*film.Width + x)
+			ids.Set(x, y, vec3.Color{X: id, Y: id, Z: id})
+			depth.Set(x, y, vec3.Color{X: 1000 + float64(x)/3})
+		}
+	}
+	e := EXRRenderer{Layers: []EXRLayer{
+		{Name: "objectid", Channels: []string{"id"}, Film: ids, Uint: true},
+		{Name: "depth", Channels: []string{"Z"}, Film: depth, Float: true},
+		{Name: "albedo", Channels: []string{"R", "G", "B"}, Film: film},
+	}}
+	var buf bytes.Buffer
+	if err := e.Render(&buf, film); err != nil {
+		t.Fatal(err)
+	}
+	channels, err := decodeEXR(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 8 {
+		t.Fatalf("got %d channels, want 8", len(channels))
+	}
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			i := y*film.Width + x
+			if got, want := channels["objectid.id"][i], float32(ids.At(x, y).X); got != want {
+				t.Fatalf("objectid.id of pixel (%d, %d) is %g, want %g", x, y, got, want)
+			}
+			if got, want := channels["depth.Z"][i], float32(depth.At(x, y).X); got != want {
+				t.Fatalf("depth.Z of pixel (%d, %d) is %g, want %g", x, y, got, want)
+			}
+			if got, want := channels["albedo.G"][i], channels["G"][i]; got != want {
+				t.Fatalf("albedo.G of pixel (%d, %d) is %g, want %g", x, y, got, want)
+			}
+		}
+	}
+
+	e.Layers = append(e.Layers, EXRLayer{Name: "small", Channels: []string{"Y"}, Film: NewFilm(1, 1, nil)})
+	if err := e.Render(&bytes.Buffer{}, film); err == nil {
+		t.Error("a layer of another size didn't fail")
+	}
+}
@@ -0,0 +1,238 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Film is an image in the making. Every pixel holds the sum of the samples
+// around it weighted by the filter, and the sum of their weights, in float32 to
+// keep it small. A film can also be a tile of a larger image, holding just the
+// pixels the samples taken in the tile reach.
+type Film struct {
+	Width  int // Width of the whole image
+	Height int
+	bounds image.Rectangle // bounds pixels the film holds
+	filter Filter
+	rgb    []float32 // rgb weighted sums of the r, g and b of the samples
+	weight []float32
+}
+
+// NewFilm creates an empty film, a nil filter is a box filter of half a pixel
+// so every sample only counts towards its own pixel
+func NewFilm(width, height int, filter Filter) *Film {
+	return newFilm(width, height, image.Rect(0, 0, width, height), filter)
+}
+
+// NewTileFilm creates an empty film for the samples taken in the pixels from
+// (x0, y0) to (x1, y1), exclusive, of a width by height image. It holds all the
+// pixels the filter lets those samples reach, Merge adds it to the image.
+func NewTileFilm(width, height int, filter Filter, x0, y0, x1, y1 int) *Film {
+	if filter == nil {
+		filter = Box{R: 0.5}
+	}
+	m := int(math.Ceil(filter.Radius()))
+	bounds := image.Rect(x0-m, y0-m, x1+m, y1+m).Intersect(image.Rect(0, 0, width, height))
+	return newFilm(width, height, bounds, filter)
+}
+
+func newFilm(width, height int, bounds image.Rectangle, filter Filter) *Film {
+	if filter == nil {
+		filter = Box{R: 0.5}
+	}
+	n := bounds.Dx() * bounds.Dy()
+	return &Film{
+		Width:  width,
+		Height: height,
+		bounds: bounds,
+		filter: filter,
+		rgb:    make([]float32, 3*n),
+		weight: make([]float32, n),
+	}
+}
+
+// index returns where pixel (x, y) of the image is kept
+func (f *Film) index(x, y int) int {
+	return (y-f.bounds.Min.Y)*f.bounds.Dx() + x - f.bounds.Min.X
+}
+
+// AddSample adds c, sampled at (x, y), to every pixel the filter reaches. The
+// coordinates are in pixels from the top left corner of the image, so the
+// center of pixel (0, 0) is at (0.5, 0.5). NaNs and infinities are dropped.
+func (f *Film) AddSample(x, y float64, c vec3.Color) {
+	if math.IsNaN(c.X+c.Y+c.Z) || math.IsInf(c.X+c.Y+c.Z, 0) {
+		return
+	}
+	r := f.filter.Radius()
+	x0 := maxInt(int(math.Ceil(x-0.5-r)), f.bounds.Min.X)
+	x1 := minInt(int(math.Floor(x-0.5+r)), f.bounds.Max.X-1)
+	y0 := maxInt(int(math.Ceil(y-0.5-r)), f.bounds.Min.Y)
+	y1 := minInt(int(math.Floor(y-0.5+r)), f.bounds.Max.Y-1)
+	if x1 < x0 || y1 < y0 {
+		return
+	}
+	// The filter is separable so a row of weights does for every row of pixels
+	var buf [16]float64
+	wx := buf[:0]
+	for px := x0; px <= x1; px++ {
+		wx = append(wx, f.filter.Evaluate(x-float64(px)-0.5))
+	}
+	for py := y0; py <= y1; py++ {
+		wy := f.filter.Evaluate(y - float64(py) - 0.5)
+		if wy == 0 {
+			continue
+		}
+		idx := f.index(x0, py)
+		for k, w := range wx {
+			w *= wy
+			f.rgb[3*(idx+k)] += float32(w * c.X)
+			f.rgb[3*(idx+k)+1] += float32(w * c.Y)
+			f.rgb[3*(idx+k)+2] += float32(w * c.Z)
+			f.weight[idx+k] += float32(w)
+		}
+	}
+}
+
+// Set makes pixel (x, y) the color c, for images that weren't made of samples
+func (f *Film) Set(x, y int, c vec3.Color) {
+	idx := f.index(x, y)
+	f.rgb[3*idx] = float32(c.X)
+	f.rgb[3*idx+1] = float32(c.Y)
+	f.rgb[3*idx+2] = float32(c.Z)
+	f.weight[idx] = 1
+}
+
+// At returns the color of pixel (x, y), y goes down like in images. Pixels no
+// sample reached are black.
+func (f *Film) At(x, y int) vec3.Color {
+	idx := f.index(x, y)
+	w := float64(f.weight[idx])
+	if w == 0 {
+		return vec3.Color{X: 0, Y: 0, Z: 0}
+	}
+	return vec3.Color{
+		X: float64(f.rgb[3*idx]) / w,
+		Y: float64(f.rgb[3*idx+1]) / w,
+		Z: float64(f.rgb[3*idx+2]) / w,
+	}
+}
+
+// Merge adds the samples of a tile film to f
+func (f *Film) Merge(tile *Film) {
+	b := tile.bounds.Intersect(f.bounds)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst, src := f.index(x, y), tile.index(x, y)
+			f.rgb[3*dst] += tile.rgb[3*src]
+			f.rgb[3*dst+1] += tile.rgb[3*src+1]
+			f.rgb[3*dst+2] += tile.rgb[3*src+2]
+			f.weight[dst] += tile.weight[src]
+		}
+	}
+}
+
+// Sums returns copies of the weighted sums and weights of the film, to be
+// restored later with LoadSums
+func (f *Film) Sums() (rgb, weight []float32) {
+	return append([]float32(nil), f.rgb...), append([]float32(nil), f.weight...)
+}
+
+// LoadSums replaces the sums of the film with ones returned by Sums
+func (f *Film) LoadSums(rgb, weight []float32) error {
+	if len(rgb) != len(f.rgb) || len(weight) != len(f.weight) {
+		return fmt.Errorf("film has %d pixels, got %d", len(f.weight), len(weight))
+	}
+	copy(f.rgb, rgb)
+	copy(f.weight, weight)
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// splatScale is the resolution of the fixed point sums in SplatFilm, 2^-30 keeps
+// plenty of precision while leaving room for sums in the billions
+const splatScale = 1 << 30
+
+// SplatFilm collects light that lands on arbitrary pixels rather than the pixel
+// being sampled, like the contributions from light tracing. Any number of
+// workers can splat at the same time. The sums are kept in fixed point, which
+// unlike floating point adds up to the same result whatever order the splats
+// arrive in, so renders stay reproducible.
+type SplatFilm struct {
+	Width  int
+	Height int
+	pixels []int64 // fixed point r, g, b sums of each pixel
+}
+
+// NewSplatFilm creates an empty film
+func NewSplatFilm(width, height int) *SplatFilm {
+	return &SplatFilm{
+		Width:  width,
+		Height: height,
+		pixels: make([]int64, 3*width*height),
+	}
+}
+
+// Splat adds c to the pixel containing the film coordinates (s, t) as passed
+// to camera.GetRay, anything landing outside of the image is dropped
+func (f *SplatFilm) Splat(s, t float64, c vec3.Color) {
+	i := int(math.Floor(s * float64(f.Width-1)))
+	j := int(math.Floor(t * float64(f.Height-1)))
+	if i < 0 || i >= f.Width || j < 0 || j >= f.Height {
+		return
+	}
+	idx := 3 * ((f.Height-1-j)*f.Width + i)
+	atomicAdd(&f.pixels[idx], c.X)
+	atomicAdd(&f.pixels[idx+1], c.Y)
+	atomicAdd(&f.pixels[idx+2], c.Z)
+}
+
+// At returns the sum of everything splatted onto pixel (x, y), y goes down like in images
+func (f *SplatFilm) At(x, y int) vec3.Color {
+	idx := 3 * (y*f.Width + x)
+	return vec3.Color{
+		X: float64(atomic.LoadInt64(&f.pixels[idx])) / splatScale,
+		Y: float64(atomic.LoadInt64(&f.pixels[idx+1])) / splatScale,
+		Z: float64(atomic.LoadInt64(&f.pixels[idx+2])) / splatScale,
+	}
+}
+
+// Sums returns a copy of the fixed point sums of the film, to be restored later
+// with LoadSums. Nothing should be splatting while it's copied.
+func (f *SplatFilm) Sums() []int64 {
+	return append([]int64(nil), f.pixels...)
+}
+
+// LoadSums replaces the sums of the film with ones returned by Sums
+func (f *SplatFilm) LoadSums(sums []int64) error {
+	if len(sums) != len(f.pixels) {
+		return fmt.Errorf("film has %d sums, got %d", len(f.pixels), len(sums))
+	}
+	copy(f.pixels, sums)
+	return nil
+}
+
+// atomicAdd adds v to the fixed point number stored in addr, NaNs and infinities
+// have no fixed point value so they are dropped
+func atomicAdd(addr *int64, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	atomic.AddInt64(addr, int64(math.Round(v*splatScale)))
+}
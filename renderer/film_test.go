@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+var filters = map[string]Filter{
+	"box":      Box{R: 0.5},
+	"tent":     Tent{R: 1},
+	"gaussian": Gaussian{R: 1.5, Sigma: 0.5},
+	"mitchell": Mitchell{R: 2, B: 1.0 / 3, C: 1.0 / 3},
+	"lanczos":  Lanczos{R: 3, Tau: 3},
+}
+
+func TestFiltersKeepFlatImagesFlat(t *testing.T) {
+	width, height := 16, 12
+	c := vec3.Color{X: 0.25, Y: 0.5, Z: 1}
+	for name, filter := range filters {
+		// A grid of samples per pixel, added tile by tile like the workers do
+		film := NewFilm(width, height, filter)
+		for ty := 0; ty < height; ty += 4 {
+			for tx := 0; tx < width; tx += 4 {
+				tile := NewTileFilm(width, height, filter, tx, ty, tx+4, ty+4)
+				for y := ty; y < ty+4; y++ {
+					for x := tx; x < tx+4; x++ {
+						for s := 0; s < 16; s++ {
+							tile.AddSample(float64(x)+(float64(s%4)+0.5)/4, float64(y)+(float64(s/4)+0.5)/4, c)
+						}
+					}
+				}
+				film.Merge(tile)
+			}
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				got := film.At(x, y)
+				if math.Abs(got.X-c.X) > 1e-5 || math.Abs(got.Y-c.Y) > 1e-5 || math.Abs(got.Z-c.Z) > 1e-5 {
+					t.Fatalf("%s filter made pixel (%d, %d) of a flat image %v, want %v", name, x, y, got, c)
+				}
+			}
+		}
+	}
+}
+
+func TestBoxFilterKeepsSamplesInTheirPixel(t *testing.T) {
+	film := NewFilm(4, 4, Box{R: 0.5})
+	// Samples on the left and top edges of pixel (1, 2)
+	film.AddSample(1, 2.5, vec3.Color{X: 1, Y: 1, Z: 1})
+	film.AddSample(1.5, 2, vec3.Color{X: 1, Y: 1, Z: 1})
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := 0.0
+			if x == 1 && y == 2 {
+				want = 1
+			}
+			if got := film.At(x, y).X; got != want {
+				t.Errorf("pixel (%d, %d) is %f, want %f", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package renderer
+
+import (
+	"math"
+)
+
+// A Filter weighs how much a sample counts towards a pixel by how far the sample
+// is from the pixel's center. All the filters here are separable, the weight of
+// a sample (dx, dy) away is Evaluate(dx) * Evaluate(dy).
+type Filter interface {
+	// Radius is how far from the pixel center, in pixels, samples still count
+	Radius() float64
+	// Evaluate returns the weight of a sample x pixels from the center
+	Evaluate(x float64) float64
+}
+
+// Box gives every sample within its radius the same weight. With a radius of
+// half a pixel every sample counts towards its own pixel only.
+type Box struct {
+	R float64 // R radius in pixels
+}
+
+// Radius implements `Filter` for Box
+func (b Box) Radius() float64 {
+	return b.R
+}
+
+// Evaluate implements `Filter` for Box, the ranges are half open so a sample on
+// the border between two pixels only counts towards one of them
+func (b Box) Evaluate(x float64) float64 {
+	if x >= -b.R && x < b.R {
+		return 1
+	}
+	return 0
+}
+
+// Tent weighs samples less the further they are, down to 0 at its radius
+type Tent struct {
+	R float64 // R radius in pixels
+}
+
+// Radius implements `Filter` for Tent
+func (t Tent) Radius() float64 {
+	return t.R
+}
+
+// Evaluate implements `Filter` for Tent
+func (t Tent) Evaluate(x float64) float64 {
+	return math.Max(0, t.R-math.Abs(x))
+}
+
+// Gaussian weighs samples by a bell curve, shifted down so it reaches 0 at its
+// radius rather than being cut off
+type Gaussian struct {
+	R     float64 // R radius in pixels
+	Sigma float64 // Sigma standard deviation in pixels
+}
+
+// Radius implements `Filter` for Gaussian
+func (g Gaussian) Radius() float64 {
+	return g.R
+}
+
+// Evaluate implements `Filter` for Gaussian
+func (g Gaussian) Evaluate(x float64) float64 {
+	return math.Max(0, gaussian(x, g.Sigma)-gaussian(g.R, g.Sigma))
+}
+
+func gaussian(x, sigma float64) float64 {
+	return math.Exp(-x * x / (2 * sigma * sigma))
+}
+
+// Mitchell is the Mitchell-Netravali cubic. Its negative lobes sharpen the image
+// a little where the Gaussian blurs it, B and C trade blurring against ringing,
+// B = C = 1/3 being what Mitchell and Netravali recommend.
+type Mitchell struct {
+	R float64 // R radius in pixels
+	B float64
+	C float64
+}
+
+// Radius implements `Filter` for Mitchell
+func (m Mitchell) Radius() float64 {
+	return m.R
+}
+
+// Evaluate implements `Filter` for Mitchell, the cubic is defined over [-2, 2]
+// so it's stretched to the radius
+func (m Mitchell) Evaluate(x float64) float64 {
+	x = math.Abs(2 * x / m.R)
+	b, c := m.B, m.C
+	switch {
+	case x < 1:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	case x < 2:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return 0
+}
+
+// Lanczos is a sinc, the ideal low pass filter, windowed by a wider sinc so it
+// reaches 0 at its radius. Tau is how many lobes of the sinc the window spans.
+type Lanczos struct {
+	R   float64 // R radius in pixels
+	Tau float64
+}
+
+// Radius implements `Filter` for Lanczos
+func (l Lanczos) Radius() float64 {
+	return l.R
+}
+
+// Evaluate implements `Filter` for Lanczos
+func (l Lanczos) Evaluate(x float64) float64 {
+	if math.Abs(x) > l.R {
+		return 0
+	}
+	return sinc(x) * sinc(x/l.Tau)
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,65 @@
+package renderer
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+)
+
+// An AnimationRenderer encodes frames as an animation. The frames are images
+// already, their colors displayed.
+type AnimationRenderer interface {
+	RenderAnimation(w io.Writer, frames []image.Image, fps int) error
+}
+
+// GIFRenderer writes frames as an animated GIF looping forever. Every frame has
+// the same palette, picked from the colors of all of them so they don't flicker.
+type GIFRenderer struct {
+	Quantizer Quantizer // Quantizer picks the palette, defaults to MedianCut
+	Colors    int       // Colors in the palette up to 256, the default
+	Dither    bool      // Dither spread the error of every pixel's color over its neighbours (Floyd-Steinberg)
+}
+
+// RenderAnimation implements `AnimationRenderer` for GIFRenderer
+func (g GIFRenderer) RenderAnimation(w io.Writer, frames []image.Image, fps int) error {
+	if len(frames) == 0 {
+		return errors.New("no frames to animate")
+	}
+	if fps <= 0 {
+		return errors.New("frames per second must be positive")
+	}
+	colors := g.Colors
+	if colors == 0 {
+		colors = 256
+	}
+	if colors < 2 || colors > 256 {
+		return errors.New("GIF palettes have between 2 and 256 colors")
+	}
+	quantizer := g.Quantizer
+	if quantizer == nil {
+		quantizer = MedianCut{}
+	}
+	palette := quantizer.Palette(frames, colors)
+	if len(palette) == 0 {
+		return errors.New("frames have no colors")
+	}
+
+	// GIF delays are in hundredths of a second
+	delay := int(math.Round(100 / float64(fps)))
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		b := frame.Bounds()
+		img := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette)
+		if g.Dither {
+			draw.FloydSteinberg.Draw(img, img.Bounds(), frame, b.Min)
+		} else {
+			draw.Draw(img, img.Bounds(), frame, b.Min, draw.Src)
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
@@ -0,0 +1,108 @@
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// HDRRenderer writes the film as a Radiance RGBE image. Like EXR it keeps the
+// colors linear and unclamped, although negative ones become black.
+type HDRRenderer struct{}
+
+// Render implements `Renderer` for HDRRenderer, writing the image top to bottom
+// and run length encoding the scanlines when they're of a width the format
+// allows it for
+func (h HDRRenderer) Render(w io.Writer, film *Film) error {
+	width, height := film.Width, film.Height
+	if _, err := fmt.Fprintf(w, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width); err != nil {
+		return err
+	}
+	rle := width >= 8 && width <= 0x7fff
+	line := make([]byte, 4*width)
+	var out []byte
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := film.At(x, y)
+			copy(line[4*x:], rgbe(c.X, c.Y, c.Z))
+		}
+		if !rle {
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			continue
+		}
+		// Every component of the scanline is encoded on its own
+		out = append(out[:0], 2, 2, byte(width>>8), byte(width))
+		component := make([]byte, width)
+		for c := 0; c < 4; c++ {
+			for x := range component {
+				component[x] = line[4*x+c]
+			}
+			out = appendRLE(out, component)
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate implements `Renderer` for HDRRenderer, which has nothing to get wrong
+func (h HDRRenderer) Validate() error {
+	return nil
+}
+
+// appendRLE appends data to out as runs of a repeated byte, a count over 128
+// followed by the byte, and literals, a count followed by the bytes
+func appendRLE(out, data []byte) []byte {
+	const minRun, maxRun, maxLiteral = 4, 127, 128
+	for i := 0; i < len(data); {
+		// Find the next run long enough to be worth it
+		run, runLen := i, 0
+		for run < len(data) {
+			runLen = 1
+			for run+runLen < len(data) && runLen < maxRun && data[run+runLen] == data[run] {
+				runLen++
+			}
+			if runLen >= minRun {
+				break
+			}
+			run += runLen
+		}
+		if run >= len(data) {
+			run, runLen = len(data), 0
+		}
+		for i < run {
+			n := run - i
+			if n > maxLiteral {
+				n = maxLiteral
+			}
+			out = append(out, byte(n))
+			out = append(out, data[i:i+n]...)
+			i += n
+		}
+		if runLen > 0 {
+			out = append(out, byte(128+runLen), data[run])
+			i += runLen
+		}
+	}
+	return out
+}
+
+// rgbe encodes a color as three mantissas sharing the exponent of the largest
+// component
+func rgbe(r, g, b float64) []byte {
+	r, g, b = math.Max(r, 0), math.Max(g, 0), math.Max(b, 0)
+	m := math.Max(r, math.Max(g, b))
+	if m < 1e-32 || math.IsNaN(m) {
+		return []byte{0, 0, 0, 0}
+	}
+	frac, exp := math.Frexp(m)
+	if exp > 127 || math.IsInf(m, 1) {
+		// Too bright for the exponent, the brightest color there is will do
+		return []byte{255, 255, 255, 255}
+	}
+	scale := frac * 256 / m
+	return []byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exp + 128)}
+}
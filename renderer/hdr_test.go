@@ -0,0 +1,113 @@
+package renderer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// testImage is a gradient with flat patches, so both the literals and the runs
+// of the HDR encoding get used, and values the PNG would clamp
+func testImage(width, height int) *Film {
+	film := NewFilm(width, height, nil)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := vec3.Color{X: float64(x) / 3, Y: float64(y) / 7, Z: 0.5}
+			if x > width/2 {
+				c = vec3.Color{X: 20, Y: 0.001, Z: 0}
+			}
+			film.Set(x, y, c)
+		}
+	}
+	return film
+}
+
+// decodeHDR reads back an image written by HDRRenderer
+func decodeHDR(data []byte) ([][3]float64, int, int, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if line == "\n" {
+			break
+		}
+	}
+	var width, height int
+	if _, err := fmt.Fscanf(r, "-Y %d +X %d\n", &height, &width); err != nil {
+		return nil, 0, 0, err
+	}
+	pixels := make([][3]float64, 0, width*height)
+	line := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		var start [4]byte
+		if _, err := r.Read(start[:]); err != nil {
+			return nil, 0, 0, err
+		}
+		if start[0] != 2 || start[1] != 2 || int(start[2])<<8|int(start[3]) != width {
+			return nil, 0, 0, fmt.Errorf("scanline %d isn't run length encoded", y)
+		}
+		for c := 0; c < 4; c++ {
+			for x := 0; x < width; {
+				n, err := r.ReadByte()
+				if err != nil {
+					return nil, 0, 0, err
+				}
+				if n > 128 {
+					v, _ := r.ReadByte()
+					for i := 0; i < int(n)-128; i++ {
+						line[4*x+c] = v
+						x++
+					}
+					continue
+				}
+				for i := 0; i < int(n); i++ {
+					line[4*x+c], _ = r.ReadByte()
+					x++
+				}
+			}
+		}
+		for x := 0; x < width; x++ {
+			e := line[4*x:]
+			scale := math.Ldexp(1, int(e[3])-136)
+			pixels = append(pixels, [3]float64{(float64(e[0]) + 0.5) * scale, (float64(e[1]) + 0.5) * scale, (float64(e[2]) + 0.5) * scale})
+		}
+	}
+	if _, err := r.ReadByte(); err == nil {
+		return nil, 0, 0, fmt.Errorf("data after the last scanline")
+	}
+	return pixels, width, height, nil
+}
+
+func TestHDRRoundTrip(t *testing.T) {
+	film := testImage(40, 6)
+	var buf bytes.Buffer
+	if err := (HDRRenderer{}).Render(&buf, film); err != nil {
+		t.Fatal(err)
+	}
+	pixels, width, height, err := decodeHDR(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != film.Width || height != film.Height {
+		t.Fatalf("image is %dx%d, want %dx%d", width, height, film.Width, film.Height)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			want := film.At(x, y)
+			got := pixels[y*width+x]
+			// Components share the exponent of the largest, which sets the precision
+			tolerance := math.Max(want.X, math.Max(want.Y, want.Z)) / 128
+			for c, w := range []float64{want.X, want.Y, want.Z} {
+				if math.Abs(got[c]-w) > tolerance {
+					t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+				}
+			}
+		}
+	}
+}
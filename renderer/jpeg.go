@@ -0,0 +1,33 @@
+package renderer
+
+import (
+	"fmt"
+	"image/jpeg"
+	"io"
+)
+
+// JPEGRenderer writes the film as a JPEG image
+type JPEGRenderer struct {
+	Display Display // Display how the linear colors of the film are encoded
+	Quality int     // Quality from 1 to 100, defaults to 90
+}
+
+// Render implements `Renderer` for JPEGRenderer
+func (j JPEGRenderer) Render(w io.Writer, film *Film) error {
+	if err := j.Validate(); err != nil {
+		return err
+	}
+	quality := j.Quality
+	if quality == 0 {
+		quality = 90
+	}
+	return jpeg.Encode(w, displayImage(film, j.Display), &jpeg.Options{Quality: quality})
+}
+
+// Validate implements `Renderer` for JPEGRenderer
+func (j JPEGRenderer) Validate() error {
+	if j.Quality < 0 || j.Quality > 100 {
+		return fmt.Errorf("invalid JPEG quality %d", j.Quality)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package renderer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// LUT is a 3D color lookup table, the colors in between its entries are
+// interpolated trilinearly
+type LUT struct {
+	Size      int // Size entries along each axis
+	DomainMin vec3.Color
+	DomainMax vec3.Color
+	table     []vec3.Color // table entries with red changing fastest, then green, then blue
+}
+
+// ReadCubeLUT reads a 3D LUT in the .cube format
+func ReadCubeLUT(r io.Reader) (*LUT, error) {
+	lut := &LUT{DomainMax: vec3.Color{X: 1, Y: 1, Z: 1}}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "TITLE":
+			continue
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("line %d: 1D LUTs aren't supported", line)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE takes one number", line)
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > 256 {
+				return nil, fmt.Errorf("line %d: invalid LUT_3D_SIZE %q", line, fields[1])
+			}
+			lut.Size = size
+			continue
+		}
+		var c vec3.Color
+		values := fields
+		if fields[0] == "DOMAIN_MIN" || fields[0] == "DOMAIN_MAX" {
+			values = fields[1:]
+		}
+		if len(values) != 3 {
+			return nil, fmt.Errorf("line %d: expected three numbers", line)
+		}
+		for i, v := range []*float64{&c.X, &c.Y, &c.Z} {
+			f, err := strconv.ParseFloat(values[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			*v = f
+		}
+		switch fields[0] {
+		case "DOMAIN_MIN":
+			lut.DomainMin = c
+		case "DOMAIN_MAX":
+			lut.DomainMax = c
+		default:
+			if lut.Size == 0 {
+				return nil, fmt.Errorf("line %d: entry before LUT_3D_SIZE", line)
+			}
+			lut.table = append(lut.table, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lut.Size == 0 {
+		return nil, fmt.Errorf("no LUT_3D_SIZE")
+	}
+	if want := lut.Size * lut.Size * lut.Size; len(lut.table) != want {
+		return nil, fmt.Errorf("LUT has %d entries, want %d", len(lut.table), want)
+	}
+	if lut.DomainMin.X >= lut.DomainMax.X || lut.DomainMin.Y >= lut.DomainMax.Y || lut.DomainMin.Z >= lut.DomainMax.Z {
+		return nil, fmt.Errorf("empty domain from %v to %v", lut.DomainMin, lut.DomainMax)
+	}
+	return lut, nil
+}
+
+// Apply looks c up in the table, colors outside the domain are clamped to it
+func (l *LUT) Apply(c vec3.Color) vec3.Color {
+	var idx [3]int
+	var frac [3]float64
+	n := float64(l.Size - 1)
+	for i, v := range [3][3]float64{
+		{c.X, l.DomainMin.X, l.DomainMax.X},
+		{c.Y, l.DomainMin.Y, l.DomainMax.Y},
+		{c.Z, l.DomainMin.Z, l.DomainMax.Z},
+	} {
+		t := (v[0] - v[1]) / (v[2] - v[1]) * n
+		if !(t > 0) {
+			t = 0
+		}
+		t = math.Min(t, n)
+		idx[i] = int(math.Min(t, n-1))
+		frac[i] = t - float64(idx[i])
+	}
+
+	var out vec3.Color
+	for corner := 0; corner < 8; corner++ {
+		w := 1.0
+		entry := 0
+		stride := 1
+		for i := 0; i < 3; i++ {
+			j := idx[i]
+			if corner&(1<<i) != 0 {
+				j++
+				w *= frac[i]
+			} else {
+				w *= 1 - frac[i]
+			}
+			entry += j * stride
+			stride *= l.Size
+		}
+		if w != 0 {
+			out = out.Add(l.table[entry].ScalarMul(w))
+		}
+	}
+	return out
+}
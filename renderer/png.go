@@ -5,37 +5,54 @@ import (
 	"image"
 	"image/color"
 	"image/png"
-	"os"
-
-	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"io"
 )
 
+// PNGRenderer writes the film as a PNG image
 type PNGRenderer struct {
-	ImageWidth      int
-	ImageHeight     int
-	ImagePixels     []Pixel
-	SamplesPerPixel int
+	Display  Display // Display how the linear colors of the film are encoded
+	BitDepth int     // BitDepth bits per component, 8 (default) or 16
 }
 
-func (p PNGRenderer) Render(fname string) {
-	renderFile, err := os.Create(fname)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to create file, %s, for rendering: %v\n", fname, err)
-		os.Exit(1)
+// Render implements `Renderer` for PNGRenderer
+func (p PNGRenderer) Render(w io.Writer, film *Film) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.BitDepth == 16 {
+		return png.Encode(w, displayImage16(film, p.Display))
 	}
-	defer renderFile.Close()
+	return png.Encode(w, displayImage(film, p.Display))
+}
 
-	img := image.NewNRGBA(image.Rect(0, 0, p.ImageWidth, p.ImageHeight))
+// Validate implements `Renderer` for PNGRenderer
+func (p PNGRenderer) Validate() error {
+	if p.BitDepth != 0 && p.BitDepth != 8 && p.BitDepth != 16 {
+		return fmt.Errorf("invalid PNG bit depth %d", p.BitDepth)
+	}
+	return nil
+}
 
-	for _, pixel := range p.ImagePixels {
-		r, g, b, _ := pixel.Color.RGBA(p.SamplesPerPixel)
-		img.Set(int(pixel.Position.X), int(pixel.Position.Y), color.NRGBA{
-			R: uint8(255 * utils.Clamp(r, 0, 0.999)),
-			G: uint8(255 * utils.Clamp(g, 0, 0.999)),
-			B: uint8(255 * utils.Clamp(b, 0, 0.999)),
-			A: 255,
-		})
+// displayImage returns the film as displayed, 8 bits per component
+func displayImage(film *Film, display Display) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, film.Width, film.Height))
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			c := display.Color(film.At(x, y))
+			img.SetNRGBA(x, y, color.NRGBA{R: to8(c.X), G: to8(c.Y), B: to8(c.Z), A: 255})
+		}
 	}
+	return img
+}
 
-	png.Encode(renderFile, img)
+// displayImage16 returns the film as displayed, 16 bits per component
+func displayImage16(film *Film, display Display) *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, film.Width, film.Height))
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			c := display.Color(film.At(x, y))
+			img.SetNRGBA64(x, y, color.NRGBA64{R: to16(c.X), G: to16(c.Y), B: to16(c.Z), A: 65535})
+		}
+	}
+	return img
 }
@@ -0,0 +1,39 @@
+package renderer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// PPMRenderer writes the film as a PPM image, 8 bits per component
+type PPMRenderer struct {
+	Display Display // Display how the linear colors of the film are encoded
+	ASCII   bool    // ASCII write the plain text variant rather than binary
+}
+
+// Render implements `Renderer` for PPMRenderer
+func (p PPMRenderer) Render(w io.Writer, film *Film) error {
+	magic := "P6"
+	if p.ASCII {
+		magic = "P3"
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n%d %d\n255\n", magic, film.Width, film.Height)
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			c := p.Display.Color(film.At(x, y))
+			if p.ASCII {
+				fmt.Fprintf(bw, "%d %d %d\n", to8(c.X), to8(c.Y), to8(c.Z))
+			} else {
+				bw.Write([]byte{to8(c.X), to8(c.Y), to8(c.Z)})
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Validate implements `Renderer` for PPMRenderer, which has nothing to get wrong
+func (p PPMRenderer) Validate() error {
+	return nil
+}
@@ -0,0 +1,257 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// A Quantizer picks a palette of at most n colors that stands for the colors of
+// the images
+type Quantizer interface {
+	Palette(images []image.Image, n int) color.Palette
+}
+
+// NewQuantizer returns the quantizer called name, one of "median-cut" (the
+// default) or "octree"
+func NewQuantizer(name string) (Quantizer, error) {
+	switch strings.ToLower(name) {
+	case "", "median-cut":
+		return MedianCut{}, nil
+	case "octree":
+		return Octree{}, nil
+	}
+	return nil, fmt.Errorf("unknown quantizer %q", name)
+}
+
+// histogram counts the 8 bit colors of the images, keyed by 0xRRGGBB
+func histogram(images []image.Image) map[uint32]int {
+	counts := make(map[uint32]int)
+	for _, img := range images {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				counts[uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B)]++
+			}
+		}
+	}
+	return counts
+}
+
+// weightedColor is a color of the histogram and how many pixels have it
+type weightedColor struct {
+	rgb   [3]uint8
+	count int
+}
+
+// MedianCut splits the colors into boxes, always halving the box spanning the
+// widest range along that range at the median pixel, and takes the mean of
+// every box (Heckbert 1982)
+type MedianCut struct{}
+
+// Palette implements `Quantizer` for MedianCut
+func (MedianCut) Palette(images []image.Image, n int) color.Palette {
+	var colors []weightedColor
+	for c, count := range histogram(images) {
+		colors = append(colors, weightedColor{[3]uint8{uint8(c >> 16), uint8(c >> 8), uint8(c)}, count})
+	}
+	// The histogram comes in random order, the palette shouldn't
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].rgb, colors[j].rgb
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+	boxes := [][]weightedColor{colors}
+	for len(boxes) < n {
+		// The box with the widest range along any axis is split along it
+		best, bestAxis, bestRange := -1, 0, 0
+		for i, box := range boxes {
+			axis, r := widestAxis(box)
+			if r > bestRange {
+				best, bestAxis, bestRange = i, axis, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].rgb[bestAxis] < box[j].rgb[bestAxis] })
+		total := 0
+		for _, c := range box {
+			total += c.count
+		}
+		// Split where half the pixels are on either side, keeping both halves
+		// non-empty
+		split, seen := 1, box[0].count
+		for split < len(box)-1 && 2*seen < total {
+			seen += box[split].count
+			split++
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [3]int
+		total := 0
+		for _, c := range box {
+			for i := range sum {
+				sum[i] += int(c.rgb[i]) * c.count
+			}
+			total += c.count
+		}
+		if total == 0 {
+			continue
+		}
+		palette = append(palette, color.RGBA{
+			R: uint8((sum[0] + total/2) / total),
+			G: uint8((sum[1] + total/2) / total),
+			B: uint8((sum[2] + total/2) / total),
+			A: 255,
+		})
+	}
+	return palette
+}
+
+// widestAxis returns the component the colors spread furthest along, and how
+// far
+func widestAxis(colors []weightedColor) (axis, spread int) {
+	if len(colors) < 2 {
+		return 0, 0
+	}
+	lo, hi := [3]int{255, 255, 255}, [3]int{}
+	for _, c := range colors {
+		for i, v := range c.rgb {
+			if int(v) < lo[i] {
+				lo[i] = int(v)
+			}
+			if int(v) > hi[i] {
+				hi[i] = int(v)
+			}
+		}
+	}
+	for i := range lo {
+		if hi[i]-lo[i] > spread {
+			axis, spread = i, hi[i]-lo[i]
+		}
+	}
+	// Boxes of a single color can't be split, even when they hold many
+	if spread == 0 {
+		return 0, 0
+	}
+	return axis, spread
+}
+
+// Octree sorts the colors into a tree whose every level halves the range of
+// the components, then merges the leaves deepest first until there are few
+// enough (Gervautz and Purgathofer 1988)
+type Octree struct{}
+
+// octreeNode is a cube of colors, leaves hold the sum of their colors
+type octreeNode struct {
+	children [8]*octreeNode
+	sum      [3]int
+	count    int
+	leaf     bool
+}
+
+// Palette implements `Quantizer` for Octree
+func (Octree) Palette(images []image.Image, n int) color.Palette {
+	const depth = 8
+	root := &octreeNode{}
+	// levels holds the inner nodes of every level, in the order they were made
+	var levels [depth][]*octreeNode
+	leaves := 0
+
+	counts := histogram(images)
+	keys := make([]uint32, 0, len(counts))
+	for c := range counts {
+		keys = append(keys, c)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, c := range keys {
+		rgb := [3]int{int(c >> 16 & 0xff), int(c >> 8 & 0xff), int(c & 0xff)}
+		node := root
+		for level := 0; level < depth; level++ {
+			shift := uint(7 - level)
+			i := (rgb[0]>>shift&1)<<2 | (rgb[1]>>shift&1)<<1 | rgb[2]>>shift&1
+			if node.children[i] == nil {
+				node.children[i] = &octreeNode{leaf: level == depth-1}
+				if level < depth-1 {
+					levels[level+1] = append(levels[level+1], node.children[i])
+				} else {
+					leaves++
+				}
+			}
+			node = node.children[i]
+		}
+		for i := range rgb {
+			node.sum[i] += rgb[i] * counts[c]
+		}
+		node.count += counts[c]
+	}
+	levels[0] = []*octreeNode{root}
+
+	// Merge the children of the deepest nodes into them, the ones standing for
+	// the fewest pixels first so the common colors keep their detail
+	for level := depth - 1; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		sort.SliceStable(nodes, func(i, j int) bool { return subtreeCount(nodes[i]) < subtreeCount(nodes[j]) })
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			merged := 0
+			for i, child := range node.children {
+				if child == nil {
+					continue
+				}
+				for k := range node.sum {
+					node.sum[k] += child.sum[k]
+				}
+				node.count += child.count
+				node.children[i] = nil
+				merged++
+			}
+			node.leaf = true
+			leaves -= merged - 1
+		}
+	}
+
+	var palette color.Palette
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			if node.count > 0 {
+				palette = append(palette, color.RGBA{
+					R: uint8((node.sum[0] + node.count/2) / node.count),
+					G: uint8((node.sum[1] + node.count/2) / node.count),
+					B: uint8((node.sum[2] + node.count/2) / node.count),
+					A: 255,
+				})
+			}
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	return palette
+}
+
+// subtreeCount returns how many pixels the colors below node stand for
+func subtreeCount(node *octreeNode) int {
+	count := node.count
+	for _, child := range node.children {
+		if child != nil {
+			count += subtreeCount(child)
+		}
+	}
+	return count
+}
@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantizers(t *testing.T) {
+	// Few enough colors keep them all, more are kept close to
+	few := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	many := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < len(few.Pix); i += 4 {
+		v := uint8(i / 16 * 80)
+		few.Pix[i], few.Pix[i+1], few.Pix[i+2], few.Pix[i+3] = v, 255-v, v/2, 255
+	}
+	for i := 0; i < len(many.Pix); i += 4 {
+		many.Pix[i], many.Pix[i+1], many.Pix[i+2], many.Pix[i+3] = uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255
+	}
+	for _, q := range []Quantizer{MedianCut{}, Octree{}} {
+		palette := q.Palette([]image.Image{few}, 16)
+		if len(palette) != 4 {
+			t.Errorf("%T made %d colors of 4", q, len(palette))
+		}
+		for i := 0; i < len(few.Pix); i += 4 {
+			c := color.NRGBA{few.Pix[i], few.Pix[i+1], few.Pix[i+2], 255}
+			if r1, g1, b1, _ := palette.Convert(c).RGBA(); r1>>8 != uint32(c.R) || g1>>8 != uint32(c.G) || b1>>8 != uint32(c.B) {
+				t.Errorf("%T lost the color %v", q, c)
+			}
+		}
+
+		palette = q.Palette([]image.Image{many}, 64)
+		if len(palette) > 64 || len(palette) < 32 {
+			t.Errorf("%T made %d colors, want up to 64", q, len(palette))
+		}
+		// 64 colors split every component of random colors in 4, which leaves
+		// them 16 off on average
+		total := 0.0
+		for i := 0; i < len(many.Pix); i += 4 {
+			c := color.NRGBA{many.Pix[i], many.Pix[i+1], many.Pix[i+2], 255}
+			p := palette.Convert(c).(color.RGBA)
+			total += abs(int(p.R)-int(c.R)) + abs(int(p.G)-int(c.G)) + abs(int(p.B)-int(c.B))
+		}
+		if mean := total / float64(3*64*64); mean > 20 {
+			t.Errorf("%T palette is %f off on average", q, mean)
+		}
+	}
+}
+
+func abs(v int) float64 {
+	if v < 0 {
+		return float64(-v)
+	}
+	return float64(v)
+}
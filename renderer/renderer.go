@@ -1,14 +1,69 @@
 package renderer
 
 import (
-	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
-type Pixel struct {
-	Color    vec3.Color
-	Position vec3.Point
+// A Renderer encodes a film as an image
+type Renderer interface {
+	Render(w io.Writer, film *Film) error
+	// Validate checks the settings of the renderer, so that they're caught
+	// before anything is rendered
+	Validate() error
 }
 
-type Renderer interface {
-	Render([]Pixel)
+// WriteFile renders the film to fname
+func WriteFile(fname string, r Renderer, film *Film) error {
+	return writeFile(fname, func(w io.Writer) error { return r.Render(w, film) })
+}
+
+// WriteAnimation renders the frames to fname as an animation
+func WriteAnimation(fname string, r AnimationRenderer, frames []image.Image, fps int) error {
+	return writeFile(fname, func(w io.Writer) error { return r.RenderAnimation(w, frames, fps) })
+}
+
+// writeFile writes fname with render. It goes to a temporary file first so
+// fname is never seen half written, and a failed write leaves what was there.
+func writeFile(fname string, render func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := render(w); err != nil {
+		return fail(fmt.Errorf("writing %s: %w", filepath.Base(fname), err))
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	// Temporary files are only readable by their owner, images are for anyone
+	if err := tmp.Chmod(0644); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fname)
+}
+
+// to8 quantizes a displayed component in [0, 1] to 8 bits
+func to8(v float64) uint8 {
+	return uint8(255*v + 0.5)
+}
+
+// to16 quantizes a displayed component in [0, 1] to 16 bits
+func to16(v float64) uint16 {
+	return uint16(65535*v + 0.5)
 }
@@ -0,0 +1,293 @@
+package renderer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodePPM reads back an image written by PPMRenderer
+func decodePPM(data []byte) (image.Image, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var magic string
+	var width, height, max int
+	if _, err := fmt.Fscan(r, &magic, &width, &height, &max); err != nil {
+		return nil, err
+	}
+	r.ReadByte()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	for i := 0; i < width*height*3; i++ {
+		if magic == "P3" {
+			if _, err := fmt.Fscan(r, &img.Pix[i/3*4+i%3]); err != nil {
+				return nil, err
+			}
+		} else {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			img.Pix[i/3*4+i%3] = b
+		}
+	}
+	return img, nil
+}
+
+// decodeTIFF reads back an image written by TIFFRenderer, going by the offsets
+// in its directory
+func decodeTIFF(data []byte) (image.Image, error) {
+	le := binary.LittleEndian
+	if string(data[:4]) != "II*\x00" {
+		return nil, fmt.Errorf("not a little endian TIFF")
+	}
+	ifd := data[le.Uint32(data[4:]):]
+	tags := map[uint16]uint32{}
+	for i := 0; i < int(le.Uint16(ifd)); i++ {
+		e := ifd[2+12*i:]
+		tags[le.Uint16(e)] = le.Uint32(e[8:])
+	}
+	width, height := int(tags[tiffImageWidth]), int(tags[tiffImageLength])
+	bits := le.Uint16(data[tags[tiffBitsPerSample]:])
+	strip := data[tags[tiffStripOffsets]:]
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	for i := 6; i < len(img.Pix); i += 8 {
+		img.Pix[i], img.Pix[i+1] = 255, 255
+	}
+	for i := 0; i < width*height*3; i++ {
+		v := uint16(strip[i]) * 0x101
+		if bits == 16 {
+			v = le.Uint16(strip[2*i:])
+		}
+		img.Pix[i/3*8+i%3*2] = uint8(v >> 8)
+		img.Pix[i/3*8+i%3*2+1] = uint8(v)
+	}
+	return img, nil
+}
+
+func TestRenderers(t *testing.T) {
+	film := testImage(20, 9)
+	display := Display{ToneMapper: Reinhard{}}
+	decodePNG := func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) }
+	decodeJPEG := func(data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) }
+	for _, tc := range []struct {
+		name      string
+		r         Renderer
+		decode    func([]byte) (image.Image, error)
+		tolerance float64 // tolerance of every component, or on average for lossy formats
+		lossy     bool
+	}{
+		{"png", PNGRenderer{Display: display}, decodePNG, 0.5 / 255, false},
+		{"png16", PNGRenderer{Display: display, BitDepth: 16}, decodePNG, 0.5 / 65535, false},
+		{"ppm", PPMRenderer{Display: display}, decodePPM, 0.5 / 255, false},
+		{"ppm ascii", PPMRenderer{Display: display, ASCII: true}, decodePPM, 0.5 / 255, false},
+		{"jpeg", JPEGRenderer{Display: display, Quality: 100}, decodeJPEG, 0.05, true},
+		{"tiff", TIFFRenderer{Display: display}, decodeTIFF, 0.5 / 255, false},
+		{"tiff16", TIFFRenderer{Display: display, BitDepth: 16}, decodeTIFF, 0.5 / 65535, false},
+	} {
+		var buf bytes.Buffer
+		if err := tc.r.Render(&buf, film); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		img, err := tc.decode(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if size := img.Bounds().Size(); size.X != film.Width || size.Y != film.Height {
+			t.Fatalf("%s: image is %v, want %dx%d", tc.name, size, film.Width, film.Height)
+		}
+		total := 0.0
+		for y := 0; y < film.Height; y++ {
+			for x := 0; x < film.Width; x++ {
+				want := display.Color(film.At(x, y))
+				r, g, b, _ := img.At(x, y).RGBA()
+				for i, got := range []uint32{r, g, b} {
+					diff := math.Abs(float64(got)/65535 - []float64{want.X, want.Y, want.Z}[i])
+					if !tc.lossy && diff > tc.tolerance+1e-9 {
+						t.Fatalf("%s: pixel (%d, %d) is %d %d %d, want %v", tc.name, x, y, r, g, b, want)
+					}
+					total += diff
+				}
+			}
+		}
+		if mean := total / float64(3*film.Width*film.Height); tc.lossy && mean > tc.tolerance {
+			t.Errorf("%s: components are off by %f on average", tc.name, mean)
+		}
+	}
+
+	for _, r := range []Renderer{PNGRenderer{BitDepth: 12}, JPEGRenderer{Quality: 101}, TIFFRenderer{BitDepth: 32}, EXRRenderer{Compression: "rle"}} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%#v is valid", r)
+		}
+		if err := r.Render(&bytes.Buffer{}, film); err == nil {
+			t.Errorf("%#v didn't fail", r)
+		}
+	}
+	for _, r := range []Renderer{PNGRenderer{}, PPMRenderer{}, JPEGRenderer{}, TIFFRenderer{BitDepth: 16}, EXRRenderer{Compression: "none"}, HDRRenderer{}} {
+		if err := r.Validate(); err != nil {
+			t.Errorf("%#v: %s", r, err)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renderer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "image.png")
+	film := testImage(4, 3)
+	if err := WriteFile(fname, PNGRenderer{}, film); err != nil {
+		t.Fatal(err)
+	}
+	before, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A write that fails leaves the image that was there
+	if err := WriteFile(fname, PNGRenderer{BitDepth: 12}, film); err == nil {
+		t.Fatal("writing with an invalid bit depth didn't fail")
+	}
+	if after, err := ioutil.ReadFile(fname); err != nil || !bytes.Equal(before, after) {
+		t.Errorf("failed write changed the image: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("writes left %d files behind", len(files))
+	}
+}
+
+// decodeAPNG reads back the frames of an animation written by APNGRenderer,
+// putting each frame's data in a PNG of its own
+func decodeAPNG(data []byte) (frames []image.Image, fps int, err error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ihdr []byte
+	var idat [][]byte
+	numFrames, seq := -1, uint32(0)
+	flush := func() error {
+		if idat == nil {
+			return nil
+		}
+		var buf bytes.Buffer
+		buf.Write(pngSignature)
+		writePNGChunk(&buf, "IHDR", ihdr)
+		for _, d := range idat {
+			writePNGChunk(&buf, "IDAT", d)
+		}
+		writePNGChunk(&buf, "IEND", nil)
+		img, err := png.Decode(&buf)
+		frames = append(frames, img)
+		idat = nil
+		return err
+	}
+	for _, c := range chunks {
+		switch c.kind {
+		case "IHDR":
+			ihdr = c.data
+		case "acTL":
+			numFrames = int(binary.BigEndian.Uint32(c.data))
+		case "fcTL", "fdAT":
+			if got := binary.BigEndian.Uint32(c.data); got != seq {
+				return nil, 0, fmt.Errorf("%s has sequence number %d, want %d", c.kind, got, seq)
+			}
+			seq++
+			if c.kind == "fdAT" {
+				idat = append(idat, c.data[4:])
+				continue
+			}
+			if err := flush(); err != nil {
+				return nil, 0, err
+			}
+			fps = int(binary.BigEndian.Uint16(c.data[22:]))
+		case "IDAT":
+			idat = append(idat, c.data)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, 0, err
+	}
+	if numFrames != len(frames) {
+		return nil, 0, fmt.Errorf("acTL says %d frames, found %d", numFrames, len(frames))
+	}
+	return frames, fps, nil
+}
+
+func TestAnimationRenderers(t *testing.T) {
+	var frames []image.Image
+	for i := 0; i < 5; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 17, 11))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = uint8(40*i), uint8(p/4%10*25), 200, 255
+		}
+		frames = append(frames, img)
+	}
+	same := func(a, b image.Image) bool {
+		for y := 0; y < 11; y++ {
+			for x := 0; x < 17; x++ {
+				r1, g1, b1, _ := a.At(x, y).RGBA()
+				r2, g2, b2, _ := b.At(x, y).RGBA()
+				if r1 != r2 || g1 != g2 || b1 != b2 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	var buf bytes.Buffer
+	if err := (APNGRenderer{}).RenderAnimation(&buf, frames, 12); err != nil {
+		t.Fatal(err)
+	}
+	// Viewers that don't know APNG see the first frame
+	if first, err := png.Decode(bytes.NewReader(buf.Bytes())); err != nil || !same(first, frames[0]) {
+		t.Fatalf("APNG doesn't decode as its first frame: %v", err)
+	}
+	got, fps, err := decodeAPNG(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(frames) || fps != 12 {
+		t.Fatalf("APNG has %d frames at %d fps, want %d at 12", len(got), fps, len(frames))
+	}
+	for i := range frames {
+		if !same(got[i], frames[i]) {
+			t.Fatalf("APNG frame %d differs", i)
+		}
+	}
+
+	for _, dither := range []bool{false, true} {
+		buf.Reset()
+		if err := (GIFRenderer{Dither: dither}).RenderAnimation(&buf, frames, 12); err != nil {
+			t.Fatal(err)
+		}
+		anim, err := gif.DecodeAll(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anim.Image) != len(frames) || anim.Delay[0] != 8 {
+			t.Fatalf("GIF has %d frames %d hundredths apart, want %d 8 apart", len(anim.Image), anim.Delay[0], len(frames))
+		}
+		// Less than 256 colors fit in the palette as they are
+		if !dither {
+			for i := range frames {
+				if !same(anim.Image[i], frames[i]) {
+					t.Fatalf("GIF frame %d differs", i)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package renderer
+
+import (
+	"fmt"
+	"io"
+)
+
+// TIFF tags and field types
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffPlanarConfig    = 284
+	tiffResolutionUnit  = 296
+
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+// TIFFRenderer writes the film as an uncompressed baseline RGB TIFF image
+type TIFFRenderer struct {
+	Display  Display // Display how the linear colors of the film are encoded
+	BitDepth int     // BitDepth bits per component, 8 (default) or 16
+}
+
+// Render implements `Renderer` for TIFFRenderer. The image is a single strip
+// following the header, its one directory and the values that don't fit in it.
+func (t TIFFRenderer) Render(w io.Writer, film *Film) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	bitDepth := t.BitDepth
+	if bitDepth == 0 {
+		bitDepth = 8
+	}
+	width, height := film.Width, film.Height
+	stripSize := width * height * 3 * bitDepth / 8
+
+	type entry struct {
+		tag, kind uint16
+		value     uint32 // value or the offset of the values when they don't fit
+	}
+	const numEntries = 13
+	const directorySize = 2 + numEntries*12 + 4
+	// The bits per sample and the resolutions come after the directory
+	bitsOffset := uint32(8 + directorySize)
+	resolutionOffset := bitsOffset + 6
+	stripOffset := resolutionOffset + 8
+	entries := [numEntries]entry{
+		{tiffImageWidth, tiffLong, uint32(width)},
+		{tiffImageLength, tiffLong, uint32(height)},
+		{tiffBitsPerSample, tiffShort, bitsOffset},
+		{tiffCompression, tiffShort, 1},
+		{tiffPhotometric, tiffShort, 2},
+		{tiffStripOffsets, tiffLong, stripOffset},
+		{tiffSamplesPerPixel, tiffShort, 3},
+		{tiffRowsPerStrip, tiffLong, uint32(height)},
+		{tiffStripByteCounts, tiffLong, uint32(stripSize)},
+		{tiffXResolution, tiffRational, resolutionOffset},
+		{tiffYResolution, tiffRational, resolutionOffset},
+		{tiffPlanarConfig, tiffShort, 1},
+		{tiffResolutionUnit, tiffShort, 2},
+	}
+
+	buf := make([]byte, 0, int(stripOffset)+stripSize)
+	buf = append(buf, 'I', 'I', 42, 0)
+	buf = appendUint32(buf, 8)
+	buf = appendUint16(buf, numEntries)
+	for _, e := range entries {
+		count := uint32(1)
+		if e.tag == tiffBitsPerSample {
+			count = 3
+		}
+		buf = appendUint16(buf, e.tag)
+		buf = appendUint16(buf, e.kind)
+		buf = appendUint32(buf, count)
+		// Shorts are left justified in the value field
+		buf = appendUint32(buf, e.value)
+	}
+	buf = appendUint32(buf, 0)
+	for i := 0; i < 3; i++ {
+		buf = appendUint16(buf, uint16(bitDepth))
+	}
+	// 72 pixels per inch
+	buf = appendUint32(buf, 72)
+	buf = appendUint32(buf, 1)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := t.Display.Color(film.At(x, y))
+			if bitDepth == 8 {
+				buf = append(buf, to8(c.X), to8(c.Y), to8(c.Z))
+			} else {
+				buf = appendUint16(buf, to16(c.X))
+				buf = appendUint16(buf, to16(c.Y))
+				buf = appendUint16(buf, to16(c.Z))
+			}
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Validate implements `Renderer` for TIFFRenderer
+func (t TIFFRenderer) Validate() error {
+	if t.BitDepth != 0 && t.BitDepth != 8 && t.BitDepth != 16 {
+		return fmt.Errorf("invalid TIFF bit depth %d", t.BitDepth)
+	}
+	return nil
+}
+
+// appendUint16 appends v to b, little endian
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+// appendUint32 appends v to b, little endian
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
@@ -0,0 +1,139 @@
+package renderer
+
+import (
+	"math"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Display turns the linear colors of a film into what's written to 8 bit
+// images: the exposure is applied, the tone mapper brings the colors into
+// [0, 1], the sRGB transfer function encodes them and the LUT, if any, grades
+// them. The zero value only encodes the colors, clamping anything too bright.
+type Display struct {
+	Exposure   float64    // Exposure in stops, every stop doubles the brightness
+	ToneMapper ToneMapper // ToneMapper nil clamps colors to [0, 1]
+	LUT        *LUT       // LUT applied to the sRGB encoded colors, nil leaves them as they are
+}
+
+// Color returns c as it should be displayed, each component in [0, 1]
+func (d Display) Color(c vec3.Color) vec3.Color {
+	c = c.ScalarMul(math.Exp2(d.Exposure))
+	if d.ToneMapper != nil {
+		c = d.ToneMapper.Map(c)
+	}
+	c = vec3.Color{X: EncodeSRGB(c.X), Y: EncodeSRGB(c.Y), Z: EncodeSRGB(c.Z)}
+	if d.LUT != nil {
+		c = d.LUT.Apply(c)
+	}
+	return vec3.Color{X: utils.Clamp(c.X, 0, 1), Y: utils.Clamp(c.Y, 0, 1), Z: utils.Clamp(c.Z, 0, 1)}
+}
+
+// EncodeSRGB applies the sRGB transfer function to a linear value in [0, 1]
+func EncodeSRGB(v float64) float64 {
+	v = utils.Clamp(v, 0, 1)
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// DecodeSRGB is the inverse of EncodeSRGB
+func DecodeSRGB(v float64) float64 {
+	v = utils.Clamp(v, 0, 1)
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// A ToneMapper compresses linear colors of any brightness into [0, 1]
+type ToneMapper interface {
+	Map(c vec3.Color) vec3.Color
+}
+
+// Reinhard maps the luminance L to L / (1 + L), keeping the hue. Nothing quite
+// reaches white.
+type Reinhard struct{}
+
+// Map implements `ToneMapper` for Reinhard
+func (Reinhard) Map(c vec3.Color) vec3.Color {
+	return scaleLuminance(c, func(l float64) float64 {
+		return l / (1 + l)
+	})
+}
+
+// ExtendedReinhard is Reinhard stretched so that luminance White maps to white
+type ExtendedReinhard struct {
+	White float64 // White luminance that becomes white
+}
+
+// Map implements `ToneMapper` for ExtendedReinhard
+func (r ExtendedReinhard) Map(c vec3.Color) vec3.Color {
+	white2 := r.White * r.White
+	return scaleLuminance(c, func(l float64) float64 {
+		return l * (1 + l/white2) / (1 + l)
+	})
+}
+
+// scaleLuminance scales c so its luminance becomes f of what it was
+func scaleLuminance(c vec3.Color, f func(l float64) float64) vec3.Color {
+	l := 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+	if l <= 0 {
+		return vec3.Color{}
+	}
+	return c.ScalarMul(f(l) / l)
+}
+
+// Hable is John Hable's filmic curve from Uncharted 2, applied to each
+// component. It has a toe darkening the shadows and a shoulder rolling off
+// towards White.
+type Hable struct {
+	White float64 // White linear value that becomes white, Hable used 11.2
+}
+
+// Map implements `ToneMapper` for Hable. Colors are doubled first, as in the
+// original, so mid grey stays about where it was. Unlike the original White is
+// doubled as well so it's the value that becomes white.
+func (h Hable) Map(c vec3.Color) vec3.Color {
+	white := hable(2 * h.White)
+	return vec3.Color{X: hable(2*c.X) / white, Y: hable(2*c.Y) / white, Z: hable(2*c.Z) / white}
+}
+
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// ACES is Stephen Hill's fit of the ACES reference rendering and sRGB output
+// transforms. The colors are converted to and back from the space the fit
+// was made in, which desaturates the brightest ones like film does.
+type ACES struct{}
+
+var (
+	acesInput = [3]vec3.Vec3{
+		{X: 0.59719, Y: 0.35458, Z: 0.04823},
+		{X: 0.07600, Y: 0.90834, Z: 0.01566},
+		{X: 0.02840, Y: 0.13383, Z: 0.83777},
+	}
+	acesOutput = [3]vec3.Vec3{
+		{X: 1.60475, Y: -0.53108, Z: -0.07367},
+		{X: -0.10208, Y: 1.10813, Z: -0.00605},
+		{X: -0.00327, Y: -0.07276, Z: 1.07602},
+	}
+)
+
+// Map implements `ToneMapper` for ACES, the fit overshoots white a little so
+// it's clamped like in the original
+func (ACES) Map(c vec3.Color) vec3.Color {
+	c = vec3.Color{X: acesInput[0].Dot(c), Y: acesInput[1].Dot(c), Z: acesInput[2].Dot(c)}
+	c = vec3.Color{X: acesFit(c.X), Y: acesFit(c.Y), Z: acesFit(c.Z)}
+	c = vec3.Color{X: acesOutput[0].Dot(c), Y: acesOutput[1].Dot(c), Z: acesOutput[2].Dot(c)}
+	return vec3.Color{X: utils.Clamp(c.X, 0, 1), Y: utils.Clamp(c.Y, 0, 1), Z: utils.Clamp(c.Z, 0, 1)}
+}
+
+// acesFit approximates the reference rendering and output transforms
+func acesFit(v float64) float64 {
+	return (v*(v+0.0245786) - 0.000090537) / (v*(0.983729*v+0.4329510) + 0.238081)
+}
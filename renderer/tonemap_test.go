@@ -0,0 +1,102 @@
+package renderer
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestSRGB(t *testing.T) {
+	for _, tc := range []struct{ linear, encoded float64 }{
+		{0, 0},
+		{0.001, 0.01292},
+		{0.18, 0.46135612950044164},
+		{0.5, 0.7353569830524495},
+		{1, 1},
+	} {
+		if got := EncodeSRGB(tc.linear); math.Abs(got-tc.encoded) > 1e-9 {
+			t.Errorf("EncodeSRGB(%g) = %g, want %g", tc.linear, got, tc.encoded)
+		}
+		if got := DecodeSRGB(tc.encoded); math.Abs(got-tc.linear) > 1e-9 {
+			t.Errorf("DecodeSRGB(%g) = %g, want %g", tc.encoded, got, tc.linear)
+		}
+	}
+}
+
+func TestToneMappers(t *testing.T) {
+	for name, tc := range map[string]struct {
+		tm    ToneMapper
+		white float64 // white gray level that becomes white, 0 when only approached
+	}{
+		"reinhard":          {Reinhard{}, 0},
+		"extended-reinhard": {ExtendedReinhard{White: 4}, 4},
+		"hable":             {Hable{White: 11.2}, 11.2},
+		"aces":              {ACES{}, 0},
+	} {
+		if got := tc.tm.Map(vec3.Color{}); got.Length() > 1e-3 {
+			t.Errorf("%s maps black to %v", name, got)
+		}
+		if tc.white > 0 {
+			if got := tc.tm.Map(vec3.Color{X: tc.white, Y: tc.white, Z: tc.white}); math.Abs(got.X-1) > 1e-3 || math.Abs(got.Y-1) > 1e-3 || math.Abs(got.Z-1) > 1e-3 {
+				t.Errorf("%s maps %g to %v, want white", name, tc.white, got)
+			}
+		}
+		// Brighter grays never come out darker, or past white before the white point
+		prev := -1.0
+		for v := 0.01; v < 1000; v *= 1.5 {
+			got := tc.tm.Map(vec3.Color{X: v, Y: v, Z: v})
+			if got.Y < prev {
+				t.Fatalf("%s maps %g to %v, darker than %g", name, v, got, prev)
+			}
+			if (tc.white == 0 || v < tc.white) && got.Y > 1+1e-3 {
+				t.Fatalf("%s maps %g to %v, brighter than white", name, v, got)
+			}
+			prev = got.Y
+		}
+	}
+}
+
+func TestCubeLUT(t *testing.T) {
+	// Swaps red and blue and halves green
+	cube := `# comment
+TITLE "swap"
+LUT_3D_SIZE 2
+DOMAIN_MIN 0 0 0
+DOMAIN_MAX 1 1 1
+0 0 0
+0 0 1
+0 0.5 0
+0 0.5 1
+1 0 0
+1 0 1
+1 0.5 0
+1 0.5 1
+`
+	lut, err := ReadCubeLUT(strings.NewReader(cube))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []vec3.Color{{X: 0.2, Y: 0.4, Z: 0.9}, {X: 1, Y: 1, Z: 1}, {X: 0, Y: 0.75, Z: 0.5}} {
+		want := vec3.Color{X: c.Z, Y: c.Y / 2, Z: c.X}
+		if got := lut.Apply(c); got.Sub(want).Length() > 1e-12 {
+			t.Errorf("LUT maps %v to %v, want %v", c, got, want)
+		}
+	}
+	// Outside the domain
+	if got := lut.Apply(vec3.Color{X: -1, Y: 2, Z: 0.5}); got.Sub(vec3.Color{X: 0.5, Y: 0.5, Z: 0}).Length() > 1e-12 {
+		t.Errorf("LUT maps a color outside the domain to %v", got)
+	}
+
+	for _, bad := range []string{
+		"LUT_1D_SIZE 2\n",
+		"LUT_3D_SIZE 2\n0 0 0\n",
+		"0 0 0\n",
+		"LUT_3D_SIZE 2\nDOMAIN_MIN 1 0 0\n" + strings.Repeat("0 0 0\n", 8),
+	} {
+		if _, err := ReadCubeLUT(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadCubeLUT(%q) didn't fail", bad)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sampler
+
+// primes are the bases of the Halton sequence, one per dimension
+var primes = []int{
+	2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53,
+	59, 61, 67, 71, 73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131,
+	137, 139, 149, 151, 157, 163, 167, 173, 179, 181, 191, 193, 197, 199, 211, 223,
+	227, 229, 233, 239, 241, 251, 257, 263, 269, 271, 277, 281, 283, 293, 307, 311,
+}
+
+// Halton uses the Halton sequence, dimension d being the radical inverse of the
+// sample index in base primes[d]. The digits are randomly permuted per pixel and
+// dimension, otherwise every pixel would get the same samples and the higher
+// dimensions, whose first samples all sit near 0, would be badly correlated.
+// Dimensions past the end of primes fall back to independent numbers.
+type Halton struct {
+	seed  uint64 // seed picks the digit permutations
+	pixel uint64 // pixel hash of the current pixel
+	index int    // index of the current sample in the pixel
+	dim   int    // dim next dimension handed out
+}
+
+// NewHalton creates a Halton sampler
+func NewHalton(seed uint64) *Halton {
+	return &Halton{seed: seed}
+}
+
+// StartPixelSample implements `PixelSampler` for Halton
+func (h *Halton) StartPixelSample(x, y, index int) {
+	h.pixel = hash(uint64(x), uint64(y), h.seed)
+	h.index = index
+	h.dim = 0
+}
+
+// Clone implements `PixelSampler` for Halton
+func (h *Halton) Clone() PixelSampler {
+	c := *h
+	return &c
+}
+
+// Get1D implements `Sampler` for Halton
+func (h *Halton) Get1D() float64 {
+	d := h.dim
+	h.dim++
+	dimHash := hash(h.pixel, uint64(d))
+	if d >= len(primes) {
+		return toFloat(hash(dimHash, uint64(h.index)))
+	}
+	return scrambledRadicalInverse(primes[d], uint64(h.index), dimHash)
+}
+
+// Get2D implements `Sampler` for Halton
+func (h *Halton) Get2D() (float64, float64) {
+	return h.Get1D(), h.Get1D()
+}
+
+// scrambledRadicalInverse mirrors the digits of a in the given base around the
+// decimal point, each digit going through its own permutation picked by seed
+func scrambledRadicalInverse(base int, a uint64, seed uint64) float64 {
+	b := uint64(base)
+	invBase := 1 / float64(base)
+	invBaseM := 1.0
+	result := 0.0
+	// Keep going past the last digit of a, the zeros are permuted too
+	for digit := uint64(0); invBaseM > 1e-15; digit++ {
+		d := a % b
+		a /= b
+		invBaseM *= invBase
+		p := permutationElement(uint32(d), uint32(base), uint32(hash(seed, digit)))
+		result += float64(p) * invBaseM
+	}
+	if result > oneMinusEpsilon {
+		return oneMinusEpsilon
+	}
+	return result
+}
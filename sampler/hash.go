@@ -0,0 +1,88 @@
+package sampler
+
+import "math/bits"
+
+// oneMinusEpsilon is the largest float64 below 1
+const oneMinusEpsilon = 0x1.fffffffffffffp-1
+
+// mix is the splitmix64 finalizer, it turns similar inputs into unrelated outputs
+func mix(v uint64) uint64 {
+	v ^= v >> 30
+	v *= 0xbf58476d1ce4e5b9
+	v ^= v >> 27
+	v *= 0x94d049bb133111eb
+	v ^= v >> 31
+	return v
+}
+
+// hash combines any number of values into a single well mixed one
+func hash(values ...uint64) uint64 {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, v := range values {
+		h = mix(h ^ mix(v))
+	}
+	return h
+}
+
+// toFloat maps a hash to [0, 1)
+func toFloat(h uint64) float64 {
+	return float64(h>>11) * 0x1p-53
+}
+
+// toFloat32 maps the 32 bit fixed point fraction x to [0, 1)
+func toFloat32(x uint32) float64 {
+	f := float64(x) * 0x1p-32
+	if f > oneMinusEpsilon {
+		return oneMinusEpsilon
+	}
+	return f
+}
+
+// permutationElement returns where i lands in a random permutation of [0, l)
+// picked by p, without having to build the permutation. From Kensler's
+// "Correlated Multi-Jittered Sampling".
+func permutationElement(i, l, p uint32) uint32 {
+	w := l - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < l {
+			break
+		}
+	}
+	return (i + p) % l
+}
+
+// owenScramble randomly permutes the digits of x the way Owen scrambling does,
+// every digit is flipped depending on the digits above it. This is the hash
+// based version from Burley's "Practical Hash-based Owen Scrambling".
+func owenScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return bits.Reverse32(x)
+}
@@ -0,0 +1,148 @@
+package sampler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/utils"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// Sampler supplies every random number used while rendering a sample. Going
+// through a Sampler rather than utils.RandomDouble lets integrators control
+// (and replay) the exact numbers a path consumes.
+type Sampler interface {
+	// Get1D returns the next number in [0, 1)
+	Get1D() float64
+	// Get2D returns the next pair of numbers in [0, 1), samplers that stratify
+	// do it over both numbers together
+	Get2D() (float64, float64)
+}
+
+// A PixelSampler knows which sample of which pixel is being taken, which is what
+// lets it spread the samples of a pixel evenly rather than leave it to chance.
+// Every call to Get1D or Get2D moves on to the next dimension of the sample.
+type PixelSampler interface {
+	Sampler
+	// StartPixelSample starts sample index of pixel (x, y) at the first dimension
+	StartPixelSample(x, y, index int)
+	// Clone returns a copy that can be used by another worker
+	Clone() PixelSampler
+}
+
+// New creates the sampler called name, the stratified ones are laid out for
+// samplesPerPixel samples. Two samplers with the same seed give the same samples.
+func New(name string, samplesPerPixel int, seed uint64) (PixelSampler, error) {
+	switch strings.ToLower(name) {
+	case "", "independent":
+		return NewRandom(seed), nil
+	case "stratified":
+		return NewStratified(samplesPerPixel, seed), nil
+	case "halton":
+		return NewHalton(seed), nil
+	case "sobol":
+		return NewSobol(seed), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", name)
+}
+
+// Independent is plain white noise from the global random number generator. It
+// is different every run, use Random for renders that can be reproduced.
+type Independent struct{}
+
+// Get1D implements `Sampler` for Independent
+func (Independent) Get1D() float64 {
+	return utils.RandomDouble()
+}
+
+// Get2D implements `Sampler` for Independent
+func (Independent) Get2D() (float64, float64) {
+	return utils.RandomDouble(), utils.RandomDouble()
+}
+
+// StartPixelSample implements `PixelSampler` for Independent, every sample is independent
+func (Independent) StartPixelSample(x, y, index int) {}
+
+// Clone implements `PixelSampler` for Independent
+func (i Independent) Clone() PixelSampler {
+	return i
+}
+
+// Random is white noise like Independent, but every number is a hash of the
+// seed, the pixel, the sample and the dimension. So a pixel gets the same
+// samples no matter which worker renders it or in which order.
+type Random struct {
+	seed  uint64 // seed every number is derived from
+	pixel uint64 // pixel hash of the current pixel sample
+	dim   uint64 // dim next dimension handed out
+}
+
+// NewRandom creates a reproducible white noise sampler
+func NewRandom(seed uint64) *Random {
+	return &Random{seed: seed}
+}
+
+// StartPixelSample implements `PixelSampler` for Random
+func (r *Random) StartPixelSample(x, y, index int) {
+	r.pixel = hash(uint64(x), uint64(y), uint64(index), r.seed)
+	r.dim = 0
+}
+
+// Clone implements `PixelSampler` for Random
+func (r *Random) Clone() PixelSampler {
+	c := *r
+	return &c
+}
+
+// Get1D implements `Sampler` for Random
+func (r *Random) Get1D() float64 {
+	v := toFloat(hash(r.pixel, r.dim))
+	r.dim++
+	return v
+}
+
+// Get2D implements `Sampler` for Random
+func (r *Random) Get2D() (float64, float64) {
+	return r.Get1D(), r.Get1D()
+}
+
+// The functions below turn uniform numbers into the distributions used by the
+// materials, camera and lights. Unlike the utils versions they don't use
+// rejection sampling so they always consume the same count of numbers, which
+// keeps replayed sequences lined up.
+
+// UnitVector returns a direction uniformly distributed on the unit sphere
+func UnitVector(s Sampler) vec3.Vec3 {
+	u1, u2 := s.Get2D()
+	a := 2 * math.Pi * u1
+	z := 2*u2 - 1
+	r := math.Sqrt(1 - z*z)
+	return vec3.Vec3{X: r * math.Cos(a), Y: r * math.Sin(a), Z: z}
+}
+
+// InUnitSphere returns a point uniformly distributed inside the unit sphere
+func InUnitSphere(s Sampler) vec3.Vec3 {
+	return UnitVector(s).ScalarMul(math.Cbrt(s.Get1D()))
+}
+
+// InUnitDisk returns a point uniformly distributed on the unit disk in the XY
+// plane. It uses Shirley's concentric mapping, which keeps well spread samples
+// well spread on the disk.
+func InUnitDisk(s Sampler) vec3.Vec3 {
+	u1, u2 := s.Get2D()
+	a := 2*u1 - 1
+	b := 2*u2 - 1
+	if a == 0 && b == 0 {
+		return vec3.Vec3{X: 0, Y: 0, Z: 0}
+	}
+	var r, theta float64
+	if math.Abs(a) > math.Abs(b) {
+		r = a
+		theta = math.Pi / 4 * (b / a)
+	} else {
+		r = b
+		theta = math.Pi/2 - math.Pi/4*(a/b)
+	}
+	return vec3.Vec3{X: r * math.Cos(theta), Y: r * math.Sin(theta), Z: 0}
+}
@@ -0,0 +1,129 @@
+package sampler
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testPixels = 4096
+	testSPP    = 16
+)
+
+// integrand is a function of the next few numbers of a sample with a known mean
+type integrand struct {
+	name     string
+	expected float64
+	f        func(s Sampler) float64
+}
+
+var integrands = []integrand{
+	{
+		// A disk's edge crossing the pixel, like a silhouette seen by the pixel jitter
+		name:     "disk",
+		expected: math.Pi / 4,
+		f: func(s Sampler) float64 {
+			x, y := s.Get2D()
+			if x*x+y*y < 1 {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		// Smooth in 4 dimensions, like the lens and a bounce direction
+		name:     "smooth4D",
+		expected: 4 / (math.Pi * math.Pi) / 4,
+		f: func(s Sampler) float64 {
+			u1, u2 := s.Get2D()
+			u3, u4 := s.Get2D()
+			return math.Sin(math.Pi*u1) * math.Sin(math.Pi*u2) * u3 * u4
+		},
+	},
+	{
+		// One number at a time, like Russian roulette or picking a light
+		name:     "product1D",
+		expected: 1,
+		f: func(s Sampler) float64 {
+			v := 1.0
+			for i := 0; i < 6; i++ {
+				v *= 2 * s.Get1D()
+			}
+			return v
+		},
+	},
+}
+
+// pixelRMSE estimates the integrand in many pixels with spp samples each and
+// returns the root mean square error of the pixels
+func pixelRMSE(smp PixelSampler, it integrand, spp int) float64 {
+	sumSq := 0.0
+	for p := 0; p < testPixels; p++ {
+		sum := 0.0
+		for i := 0; i < spp; i++ {
+			smp.StartPixelSample(p%64, p/64, i)
+			sum += it.f(smp)
+		}
+		diff := sum/float64(spp) - it.expected
+		sumSq += diff * diff
+	}
+	return math.Sqrt(sumSq / testPixels)
+}
+
+func TestSamplersBeatIndependent(t *testing.T) {
+	for _, it := range integrands {
+		independent := pixelRMSE(Independent{}, it, testSPP)
+		for _, name := range []string{"stratified", "halton", "sobol"} {
+			smp, err := New(name, testSPP, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rmse := pixelRMSE(smp, it, testSPP)
+			t.Logf("%-10s %-10s rmse=%f independent=%f", it.name, name, rmse, independent)
+			if rmse >= independent {
+				t.Errorf("%s sampler is no better than independent on %s: rmse=%f independent=%f", name, it.name, rmse, independent)
+			}
+		}
+	}
+}
+
+func TestSamplersInRange(t *testing.T) {
+	for _, name := range []string{"stratified", "halton", "sobol"} {
+		smp, _ := New(name, testSPP, 7)
+		for i := 0; i < 4*testSPP; i++ {
+			smp.StartPixelSample(3, 5, i)
+			for d := 0; d < 80; d++ {
+				if v := smp.Get1D(); v < 0 || v >= 1 {
+					t.Fatalf("%s sampler returned %f for sample %d dimension %d", name, v, i, d)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSobolGet2D(b *testing.B) {
+	smp := NewSobol(1)
+	for i := 0; i < b.N; i++ {
+		smp.StartPixelSample(i&63, i>>6&63, i)
+		smp.Get2D()
+	}
+}
+
+func TestSamplersReproducible(t *testing.T) {
+	for _, name := range []string{"independent", "stratified", "halton", "sobol"} {
+		a, _ := New(name, testSPP, 42)
+		b, _ := New(name, testSPP, 42)
+		// b visits the pixel samples in the opposite order, like another worker would
+		var first []float64
+		for i := 0; i < testSPP; i++ {
+			a.StartPixelSample(1, 2, i)
+			first = append(first, a.Get1D(), a.Get1D())
+		}
+		for i := testSPP - 1; i >= 0; i-- {
+			b.StartPixelSample(1, 2, i)
+			if x, y := b.Get1D(), b.Get1D(); x != first[2*i] || y != first[2*i+1] {
+				t.Errorf("%s sampler gave different numbers for the same seed and sample %d", name, i)
+			}
+		}
+	}
+}
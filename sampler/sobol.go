@@ -0,0 +1,70 @@
+package sampler
+
+import "math/bits"
+
+// Sobol uses the first two dimensions of the Sobol sequence with Owen
+// scrambling. Every Get1D or Get2D is a new, independently scrambled copy of
+// them whose samples are also handed out in a shuffled order (padding), so
+// consecutive dimensions don't line up. This keeps the great stratification of
+// Sobol within each pair of dimensions without needing tables for the higher ones.
+type Sobol struct {
+	seed  uint64 // seed picks the scrambles and the shuffles
+	pixel uint64 // pixel hash of the current pixel
+	index int    // index of the current sample in the pixel
+	dim   int    // dim next dimension handed out
+}
+
+// NewSobol creates an Owen-scrambled Sobol sampler
+func NewSobol(seed uint64) *Sobol {
+	return &Sobol{seed: seed}
+}
+
+// StartPixelSample implements `PixelSampler` for Sobol
+func (s *Sobol) StartPixelSample(x, y, index int) {
+	s.pixel = hash(uint64(x), uint64(y), s.seed)
+	s.index = index
+	s.dim = 0
+}
+
+// Clone implements `PixelSampler` for Sobol
+func (s *Sobol) Clone() PixelSampler {
+	c := *s
+	return &c
+}
+
+// Get1D implements `Sampler` for Sobol
+func (s *Sobol) Get1D() float64 {
+	h := s.next()
+	i := owenScramble(uint32(s.index), uint32(h))
+	return toFloat32(owenScramble(bits.Reverse32(i), uint32(h>>32)))
+}
+
+// Get2D implements `Sampler` for Sobol
+func (s *Sobol) Get2D() (float64, float64) {
+	h := s.next()
+	i := owenScramble(uint32(s.index), uint32(h))
+	h2 := mix(h)
+	x := owenScramble(bits.Reverse32(i), uint32(h2))
+	y := owenScramble(sobol2(i), uint32(h2>>32))
+	return toFloat32(x), toFloat32(y)
+}
+
+// next moves on to the next dimension and returns its hash
+func (s *Sobol) next() uint64 {
+	h := hash(s.pixel, uint64(s.dim))
+	s.dim++
+	return h
+}
+
+// sobol2 is the second dimension of the Sobol sequence (the first is just the
+// bits of the index reversed)
+func sobol2(i uint32) uint32 {
+	r := uint32(0)
+	for v := uint32(1) << 31; i != 0; i >>= 1 {
+		if i&1 != 0 {
+			r ^= v
+		}
+		v ^= v >> 1
+	}
+	return r
+}
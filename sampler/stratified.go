@@ -0,0 +1,74 @@
+package sampler
+
+import "math"
+
+// Stratified splits every dimension into as many strata as there are samples
+// per pixel (a grid of them for Get2D) and puts each sample of a pixel in a
+// different one, jittered inside it. Which sample gets which stratum is shuffled
+// per pixel and per dimension so the dimensions don't line up with each other.
+type Stratified struct {
+	spp    int    // spp samples per pixel the strata are laid out for
+	nx, ny int    // nx, ny size of the grid of strata used by Get2D
+	seed   uint64 // seed picks the shuffles and the jitter
+	pixel  uint64 // pixel hash of the current pixel
+	index  int    // index of the current sample in the pixel
+	dim    int    // dim next dimension handed out
+}
+
+// NewStratified creates a sampler laid out for samplesPerPixel samples
+func NewStratified(samplesPerPixel int, seed uint64) *Stratified {
+	if samplesPerPixel < 1 {
+		samplesPerPixel = 1
+	}
+	nx := int(math.Sqrt(float64(samplesPerPixel)))
+	ny := (samplesPerPixel + nx - 1) / nx
+	return &Stratified{spp: samplesPerPixel, nx: nx, ny: ny, seed: seed}
+}
+
+// StartPixelSample implements `PixelSampler` for Stratified
+func (s *Stratified) StartPixelSample(x, y, index int) {
+	s.pixel = hash(uint64(x), uint64(y), s.seed)
+	s.index = index
+	s.dim = 0
+}
+
+// Clone implements `PixelSampler` for Stratified
+func (s *Stratified) Clone() PixelSampler {
+	c := *s
+	return &c
+}
+
+// Get1D implements `Sampler` for Stratified
+func (s *Stratified) Get1D() float64 {
+	h := s.next()
+	stratum := s.stratum(s.spp, h)
+	return (float64(stratum) + toFloat(hash(h, uint64(s.index)))) / float64(s.spp)
+}
+
+// Get2D implements `Sampler` for Stratified. When the samples per pixel aren't a
+// rectangle some cells of the grid are left empty.
+func (s *Stratified) Get2D() (float64, float64) {
+	h := s.next()
+	stratum := s.stratum(s.nx*s.ny, h)
+	jx := toFloat(hash(h, uint64(s.index), 0))
+	jy := toFloat(hash(h, uint64(s.index), 1))
+	x := (float64(stratum%s.nx) + jx) / float64(s.nx)
+	y := (float64(stratum/s.nx) + jy) / float64(s.ny)
+	return x, y
+}
+
+// next moves on to the next dimension and returns its hash
+func (s *Stratified) next() uint64 {
+	h := hash(s.pixel, uint64(s.dim))
+	s.dim++
+	return h
+}
+
+// stratum returns the stratum out of n the current sample falls in. Samples past
+// spp (which happens when a pixel gets more samples than planned) go around
+// the strata again with a different shuffle.
+func (s *Stratified) stratum(n int, h uint64) int {
+	round := uint64(s.index / s.spp)
+	p := uint32(hash(h, round))
+	return int(permutationElement(uint32(s.index%s.spp), uint32(n), p))
+}
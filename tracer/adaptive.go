@@ -0,0 +1,128 @@
+package tracer
+
+import (
+	"math"
+	"sort"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+const (
+	defaultThreshold = 0.01 // defaultThreshold relative error at which pixels stop getting samples
+	// darkLuminance is the brightness errors of darker pixels are measured
+	// against, otherwise nearly black pixels would never look converged
+	darkLuminance = 0.05
+)
+
+// Adaptive sampling spends more samples on the pixels that are still noisy
+type Adaptive struct {
+	Enabled    bool    // Whether to spend more samples on noisy pixels, samplesPerPixel is then the average budget
+	MinSamples int     // Samples every pixel gets before its noise is measured, also added per pass, defaults to half of samplesPerPixel
+	MaxSamples int     // Most samples a single pixel can get, defaults to 4 times samplesPerPixel
+	Threshold  float64 // Relative error of a pixel's brightness at which it stops getting samples
+}
+
+// pixelStats accumulates the brightness of the samples taken in a pixel, the
+// sums of the luminance and its square give the variance. The colors go to the
+// film, which spreads them over the neighbouring pixels too.
+type pixelStats struct {
+	lum     float64
+	lumSq   float64
+	samples int
+}
+
+// add adds one sample
+func (st *pixelStats) add(c vec3.Color) {
+	l := luminance(c)
+	st.lum += l
+	st.lumSq += l * l
+	st.samples++
+}
+
+// relativeError estimates how far the mean brightness of the pixel is from the
+// converged one, relative to that brightness
+func (st pixelStats) relativeError() float64 {
+	if st.samples < 2 {
+		return math.Inf(1)
+	}
+	n := float64(st.samples)
+	mean := st.lum / n
+	variance := math.Max(0, (st.lumSq-st.lum*mean)/(n-1))
+	return math.Sqrt(variance/n) / math.Max(mean, darkLuminance)
+}
+
+// withDefaults fills in any setting left at its zero value
+func (a Adaptive) withDefaults(spp int) Adaptive {
+	// Fewer base samples leave too many pixels whose few samples happen to agree
+	if a.MinSamples <= 0 {
+		a.MinSamples = spp / 2
+	}
+	if a.MinSamples < 2 {
+		a.MinSamples = 2
+	}
+	if a.MaxSamples <= 0 {
+		a.MaxSamples = 4 * spp
+	}
+	if a.Threshold <= 0 {
+		a.Threshold = defaultThreshold
+	}
+	return a
+}
+
+// baseSamples is how many samples every pixel gets in the first pass
+func (a Adaptive) baseSamples(spp int) int {
+	if !a.Enabled || a.MinSamples > spp {
+		return spp
+	}
+	return a.MinSamples
+}
+
+// nextPass picks the pixels that are still above the error threshold and gives
+// each another MinSamples, noisiest first until the budget runs out. It returns
+// how many samples each pixel gets, or nil when no pixel needs any more.
+func (a Adaptive) nextPass(stats []pixelStats, budget int) []int {
+	type noisy struct {
+		idx int
+		err float64
+	}
+	var candidates []noisy
+	for idx, st := range stats {
+		if st.samples >= a.MaxSamples {
+			continue
+		}
+		if err := st.relativeError(); err > a.Threshold {
+			candidates = append(candidates, noisy{idx: idx, err: err})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].err != candidates[j].err {
+			return candidates[i].err > candidates[j].err
+		}
+		return candidates[i].idx < candidates[j].idx
+	})
+
+	var pass []int
+	for _, c := range candidates {
+		samples := a.MinSamples
+		if left := a.MaxSamples - stats[c.idx].samples; samples > left {
+			samples = left
+		}
+		if samples > budget {
+			samples = budget
+		}
+		if samples <= 0 {
+			break
+		}
+		if pass == nil {
+			pass = make([]int, len(stats))
+		}
+		budget -= samples
+		pass[c.idx] = samples
+	}
+	return pass
+}
+
+// luminance is the brightness of c as perceived by the eye
+func luminance(c vec3.Color) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
@@ -0,0 +1,149 @@
+package tracer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+// AOV is an arbitrary output variable, an image of something other than the
+// light reaching the camera for compositing and debugging. They're the mean of
+// the pixel's samples without any filtering, apart from the IDs which come from
+// the first sample of every pixel.
+type AOV string
+
+// AOVs that can be rendered
+const (
+	Depth       AOV = "depth"      // Distance to what the camera sees, 0 for the sky
+	Normal      AOV = "normal"     // World space normal of what the camera sees, facing the camera
+	Albedo      AOV = "albedo"     // Color of the material the camera sees, the sky's color where it sees nothing
+	Position    AOV = "position"   // World space position of what the camera sees
+	ObjectID    AOV = "objectid"   // Objects numbered from 1 in the order of the world, 0 for the sky
+	MaterialID  AOV = "materialid" // Materials numbered from 1 like objects.HittableList.MaterialIDs does, 0 for the sky
+	Direct      AOV = "direct"     // Light that hit at most one surface on its way to the camera
+	Indirect    AOV = "indirect"   // Light that hit more surfaces than that
+	SampleCount AOV = "samples"    // Samples taken in every pixel
+)
+
+var allAOVs = []AOV{Depth, Normal, Albedo, Position, ObjectID, MaterialID, Direct, Indirect, SampleCount}
+
+// ParseAOV returns the AOV called name
+func ParseAOV(name string) (AOV, error) {
+	for _, a := range allAOVs {
+		if strings.ToLower(name) == string(a) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown AOV %q", name)
+}
+
+// IsID tells whether the AOV numbers things rather than measuring them
+func (a AOV) IsID() bool {
+	return a == ObjectID || a == MaterialID || a == SampleCount
+}
+
+// splitsLight tells whether the AOV needs the integrator to split the light
+func (a AOV) splitsLight() bool {
+	return a == Direct || a == Indirect
+}
+
+// value returns the AOV of a sample, scalars are in every component
+func (a AOV) value(s *integrator.AOVSample, materialIDs map[objects.Material]int) vec3.Vec3 {
+	switch a {
+	case Direct:
+		return s.Direct
+	case Indirect:
+		return s.Indirect
+	case Albedo:
+		return s.Albedo
+	}
+	if !s.Hit {
+		return vec3.Vec3{}
+	}
+	var v float64
+	switch a {
+	case Normal:
+		return s.Normal
+	case Position:
+		return s.Position
+	case Depth:
+		v = s.Depth
+	case ObjectID:
+		v = float64(s.Object + 1)
+	case MaterialID:
+		v = float64(materialIDs[s.Material])
+	}
+	return vec3.Vec3{X: v, Y: v, Z: v}
+}
+
+// aovBuffer holds an AOV of every pixel, three values per pixel. They're the
+// sums of the samples, or the first sample for the IDs.
+type aovBuffer struct {
+	aov    AOV
+	values []float32 // values nil for the sample count, which the film keeps anyway
+}
+
+// setAOVs makes room for the given AOVs in a film that doesn't have any
+func (f *Film) setAOVs(aovs []AOV) {
+	f.aovs = make([]aovBuffer, len(aovs))
+	for i, a := range aovs {
+		f.aovs[i].aov = a
+		if a != SampleCount {
+			f.aovs[i].values = make([]float32, 3*f.Width*f.Height)
+		}
+	}
+}
+
+// addAOVs adds a sample to the AOVs of pixel idx, first tells whether it's the
+// first sample the pixel gets
+func (f *Film) addAOVs(idx int, first bool, s *integrator.AOVSample, materialIDs map[objects.Material]int) {
+	for _, b := range f.aovs {
+		if b.values == nil || (b.aov.IsID() && !first) {
+			continue
+		}
+		v := b.aov.value(s, materialIDs)
+		b.values[3*idx] += float32(v.X)
+		b.values[3*idx+1] += float32(v.Y)
+		b.values[3*idx+2] += float32(v.Z)
+	}
+}
+
+// AOVs returns the AOVs rendered to the film
+func (f *Film) AOVs() []AOV {
+	aovs := make([]AOV, len(f.aovs))
+	for i, b := range f.aovs {
+		aovs[i] = b.aov
+	}
+	return aovs
+}
+
+// AOV returns an image of the AOV a, nil when it wasn't rendered. Scalars are in
+// every component.
+func (f *Film) AOV(a AOV) *renderer.Film {
+	for _, b := range f.aovs {
+		if b.aov != a {
+			continue
+		}
+		img := renderer.NewFilm(f.Width, f.Height, nil)
+		for i, st := range f.pixels {
+			var v vec3.Vec3
+			switch {
+			case a == SampleCount:
+				n := float64(st.samples)
+				v = vec3.Vec3{X: n, Y: n, Z: n}
+			case a.IsID():
+				v = vec3.Vec3{X: float64(b.values[3*i]), Y: float64(b.values[3*i+1]), Z: float64(b.values[3*i+2])}
+			case st.samples > 0:
+				n := float64(st.samples)
+				v = vec3.Vec3{X: float64(b.values[3*i]) / n, Y: float64(b.values[3*i+1]) / n, Z: float64(b.values[3*i+2]) / n}
+			}
+			img.Set(i%f.Width, i/f.Width, v)
+		}
+		return img
+	}
+	return nil
+}
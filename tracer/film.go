@@ -0,0 +1,175 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+)
+
+// Film is an image being rendered. It keeps the sums of the samples rather than
+// the colors of the pixels, so rendering can carry on where it left off.
+type Film struct {
+	Width   int
+	Height  int
+	pixels  []pixelStats // pixels stats of every pixel, in image order
+	image   *renderer.Film
+	splats  *renderer.SplatFilm
+	samples int // samples taken so far
+	aovs    []aovBuffer
+	// pending is what's left of the pass that was interrupted, it's finished
+	// first so a film carried on from takes the same samples
+	pending []int
+}
+
+// NewFilm creates an empty film
+func NewFilm(width, height int) *Film {
+	return &Film{
+		Width:  width,
+		Height: height,
+		pixels: make([]pixelStats, width*height),
+		image:  renderer.NewFilm(width, height, nil),
+		splats: renderer.NewSplatFilm(width, height),
+	}
+}
+
+// filmFromImage creates a film holding an image rendered by an image integrator
+func filmFromImage(img *renderer.Film) *Film {
+	f := NewFilm(img.Width, img.Height)
+	f.image = img
+	return f
+}
+
+// Image returns the image rendered so far
+func (f *Film) Image() *renderer.Film {
+	if f.samples == 0 {
+		return f.image
+	}
+	// Light that integrators splatted onto other pixels. Every sample traced one
+	// light path so the splats are averaged over the mean samples per pixel.
+	meanSamples := float64(f.samples) / float64(f.Width*f.Height)
+	img := renderer.NewFilm(f.Width, f.Height, nil)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			img.Set(x, y, f.image.At(x, y).Add(f.splats.At(x, y).ScalarDiv(meanSamples)))
+		}
+	}
+	return img
+}
+
+// Samples returns how many samples were taken so far
+func (f *Film) Samples() int {
+	return f.samples
+}
+
+// SamplesAt returns how many samples were taken in pixel (x, y)
+func (f *Film) SamplesAt(x, y int) int {
+	return f.pixels[y*f.Width+x].samples
+}
+
+// topUp returns a pass bringing every pixel up to the given number of samples
+func (f *Film) topUp(samples int) []int {
+	pass := make([]int, len(f.pixels))
+	for i, st := range f.pixels {
+		if st.samples < samples {
+			pass[i] = samples - st.samples
+		}
+	}
+	return pass
+}
+
+// left returns the samples of pass not taken yet, before holds how many samples
+// every pixel had when the pass started
+func (f *Film) left(pass, before []int) []int {
+	left := make([]int, len(pass))
+	for i, st := range f.pixels {
+		if n := before[i] + pass[i] - st.samples; n > 0 {
+			left[i] = n
+		}
+	}
+	return left
+}
+
+// filmState is what's saved of a film. The sums are kept exactly, a film
+// carried on from only differs from one that was never stopped by how the
+// samples of the interrupted pass were rounded when added up.
+type filmState struct {
+	Width   int
+	Height  int
+	Samples int
+	RGB     []float32 // RGB weighted sums of the image
+	Weight  []float32
+	Lum     []float64
+	LumSq   []float64
+	Counts  []int
+	Splats  []int64 // Splats fixed point sums of the splat film
+	Pending []int   // Pending samples left of the interrupted pass
+	AOVs    []AOV
+	AOVSums [][]float32 // AOVSums sums of every AOV, nil for the sample count
+}
+
+// MarshalBinary implements `encoding.BinaryMarshaler` for Film, nothing should
+// be rendering to the film while it's marshalled
+func (f *Film) MarshalBinary() ([]byte, error) {
+	st := filmState{
+		Width:   f.Width,
+		Height:  f.Height,
+		Samples: f.samples,
+		Lum:     make([]float64, len(f.pixels)),
+		LumSq:   make([]float64, len(f.pixels)),
+		Counts:  make([]int, len(f.pixels)),
+		Splats:  f.splats.Sums(),
+		Pending: f.pending,
+	}
+	st.RGB, st.Weight = f.image.Sums()
+	for _, b := range f.aovs {
+		st.AOVs = append(st.AOVs, b.aov)
+		st.AOVSums = append(st.AOVSums, b.values)
+	}
+	for i, px := range f.pixels {
+		st.Lum[i] = px.lum
+		st.LumSq[i] = px.lumSq
+		st.Counts[i] = px.samples
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements `encoding.BinaryUnmarshaler` for Film
+func (f *Film) UnmarshalBinary(data []byte) error {
+	var st filmState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	n := st.Width * st.Height
+	if len(st.Lum) != n || len(st.LumSq) != n || len(st.Counts) != n {
+		return fmt.Errorf("film is %dx%d but has %d pixels", st.Width, st.Height, len(st.Counts))
+	}
+	*f = *NewFilm(st.Width, st.Height)
+	if err := f.image.LoadSums(st.RGB, st.Weight); err != nil {
+		return err
+	}
+	if err := f.splats.LoadSums(st.Splats); err != nil {
+		return err
+	}
+	for i := range f.pixels {
+		f.pixels[i] = pixelStats{lum: st.Lum[i], lumSq: st.LumSq[i], samples: st.Counts[i]}
+	}
+	if len(st.AOVSums) != len(st.AOVs) {
+		return fmt.Errorf("film has %d AOVs but %d sums", len(st.AOVs), len(st.AOVSums))
+	}
+	f.setAOVs(st.AOVs)
+	for i, b := range f.aovs {
+		if len(st.AOVSums[i]) != len(b.values) {
+			return fmt.Errorf("%s AOV has %d values, want %d", b.aov, len(st.AOVSums[i]), len(b.values))
+		}
+		copy(b.values, st.AOVSums[i])
+	}
+	f.samples = st.Samples
+	f.pending = st.Pending
+	return nil
+}
@@ -0,0 +1,115 @@
+package tracer
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const defaultTileSize = 32 // defaultTileSize width and height of the tiles in pixels
+
+// Tiles is how the image is split between the workers
+type Tiles struct {
+	Size  int    // Width and height of the tiles in pixels, defaults to 32
+	Order string // One of "spiral" (default, from the center out), "hilbert" or "scanline"
+}
+
+// tile is a rectangle of the image, rows y0 to y1 and columns x0 to x1 (exclusive)
+// with y going down like in images
+type tile struct {
+	x0, y0 int
+	x1, y1 int
+}
+
+// makeTiles splits the image into tiles, in the order they should be rendered.
+// Neighbouring tiles render one after the other in every order, which keeps the
+// parts of the scene they hit in the cache.
+func makeTiles(width, height int, c Tiles) []tile {
+	size := c.Size
+	if size <= 0 {
+		size = defaultTileSize
+	}
+	nx := (width + size - 1) / size
+	ny := (height + size - 1) / size
+	tiles := make([]tile, 0, nx*ny)
+	keys := make([]float64, 0, nx*ny)
+	for ty := 0; ty < ny; ty++ {
+		for tx := 0; tx < nx; tx++ {
+			tiles = append(tiles, tile{
+				x0: tx * size,
+				y0: ty * size,
+				x1: minInt((tx+1)*size, width),
+				y1: minInt((ty+1)*size, height),
+			})
+			keys = append(keys, tileKey(tx, ty, nx, ny, c.Order))
+		}
+	}
+	sort.Sort(byKey{tiles: tiles, keys: keys})
+	return tiles
+}
+
+// tileKey is where tile (tx, ty) of an nx by ny grid comes in the given order
+func tileKey(tx, ty, nx, ny int, order string) float64 {
+	switch strings.ToLower(order) {
+	case "scanline":
+		return float64(ty*nx + tx)
+	case "hilbert":
+		n := 1
+		for n < nx || n < ny {
+			n *= 2
+		}
+		return float64(hilbertIndex(n, tx, ty))
+	}
+	// Spiral: rings of tiles around the center, each ring going around once,
+	// so the middle of the image where the subject usually is shows up first
+	dx := float64(tx) - float64(nx-1)/2
+	dy := float64(ty) - float64(ny-1)/2
+	ring := math.Ceil(math.Max(math.Abs(dx), math.Abs(dy)))
+	angle := math.Atan2(dy, dx) + math.Pi
+	return ring*4*math.Pi + angle
+}
+
+// hilbertIndex returns how far along the Hilbert curve filling an n by n grid
+// (n a power of 2) cell (x, y) is
+func hilbertIndex(n, x, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		// Rotate the quadrant so the curve inside it lines up
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// byKey sorts tiles by their keys
+type byKey struct {
+	tiles []tile
+	keys  []float64
+}
+
+func (b byKey) Len() int           { return len(b.tiles) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.tiles[i], b.tiles[j] = b.tiles[j], b.tiles[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
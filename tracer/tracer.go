@@ -0,0 +1,350 @@
+// Package tracer renders scenes. Render hands the image out to a pool of
+// workers tile by tile and gives back the film, what is done with it (and where
+// the scene, camera and options come from) is up to the caller.
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+const defaultMaxDepth = 50 // defaultMaxDepth bounces of the default path tracer
+
+// Scene is the world and the lights sampled explicitly
+type Scene = integrator.Scene
+
+// Options control how Render renders a scene. Only the size and samples per
+// pixel have to be set.
+type Options struct {
+	Width           int
+	Height          int
+	SamplesPerPixel int                   // Samples per pixel, the average when sampling adaptively
+	Integrator      integrator.Integrator // Computes the color of each sample, defaults to a path tracer
+	Sampler         sampler.PixelSampler  // Numbers every sample is made of, defaults to white noise with seed 0
+	Adaptive        Adaptive              // Whether to spend more samples on noisy pixels
+	Progressive     bool                  // Whether to take the samples one per pixel at a time, so every pass covers the whole image
+	Tiles           Tiles                 // How the image is split between the workers
+	Filter          renderer.Filter       // Spreads every sample over the pixels around it, defaults to a box of half a pixel
+	Workers         int                   // Tiles rendered at the same time, defaults to the number of CPUs
+	AOVs            []AOV                 // Images to render next to the colors, see Film.AOV
+	// Film to carry on rendering, as returned by a Render that was cancelled or
+	// passed to Checkpoint. nil starts a new one.
+	Film *Film
+
+	// Progress is called with the samples taken so far and the total after
+	// every tile, and with the iterations for image integrators
+	Progress func(done, total int)
+	// Pass is called with the image so far after every pass over the image.
+	// Image integrators only call it when they have an intermediate image.
+	Pass func(passes int, film *Film)
+	// Checkpoint is called every CheckpointEvery while all the workers are idle,
+	// with a film that can be saved to carry on from later
+	Checkpoint      func(film *Film)
+	CheckpointEvery time.Duration
+}
+
+// withDefaults fills in any setting left at its zero value
+func (o Options) withDefaults() Options {
+	if o.Integrator == nil {
+		o.Integrator = integrator.Path{MaxDepth: defaultMaxDepth}
+	}
+	if o.Sampler == nil {
+		o.Sampler = sampler.NewRandom(0)
+	}
+	if o.Filter == nil {
+		o.Filter = renderer.Box{R: 0.5}
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.NumCPU()
+	}
+	o.Adaptive = o.Adaptive.withDefaults(o.SamplesPerPixel)
+	return o
+}
+
+// Render renders the scene as seen by cam. When ctx is cancelled the workers
+// stop where they are and Render returns the film so far with the context's
+// error, passing that film back in Options.Film finishes the render.
+func Render(ctx context.Context, scene *Scene, cam *camera.Camera, opts Options) (*Film, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", opts.Width, opts.Height)
+	}
+	if opts.SamplesPerPixel <= 0 {
+		return nil, fmt.Errorf("invalid samples per pixel %d", opts.SamplesPerPixel)
+	}
+	opts = opts.withDefaults()
+	if ii, ok := opts.Integrator.(integrator.ImageIntegrator); ok {
+		if opts.Film != nil {
+			return nil, errors.New("integrators working on the whole image can't carry on from a film")
+		}
+		if len(opts.AOVs) > 0 {
+			return nil, errors.New("integrators working on the whole image can't render AOVs")
+		}
+		return renderImage(ctx, scene, cam, ii, opts)
+	}
+	_, splitsLight := opts.Integrator.(integrator.AOVIntegrator)
+	if _, splats := opts.Integrator.(integrator.Splatter); splats {
+		splitsLight = false
+	}
+	for _, a := range opts.AOVs {
+		if a.splitsLight() && !splitsLight {
+			return nil, fmt.Errorf("the integrator can't render the %s AOV", a)
+		}
+	}
+
+	film := opts.Film
+	if film == nil {
+		film = NewFilm(opts.Width, opts.Height)
+		film.setAOVs(opts.AOVs)
+	} else if film.Width != opts.Width || film.Height != opts.Height {
+		return nil, fmt.Errorf("film is %dx%d, the image %dx%d", film.Width, film.Height, opts.Width, opts.Height)
+	} else if fmt.Sprint(film.AOVs()) != fmt.Sprint(opts.AOVs) {
+		return nil, fmt.Errorf("film has the AOVs %v, the image %v", film.AOVs(), opts.AOVs)
+	}
+	f := &frame{
+		opts:  opts,
+		tiles: makeTiles(opts.Width, opts.Height, opts.Tiles),
+		film:  film,
+		scene: scene,
+		cam:   cam,
+	}
+	if err := f.render(ctx); err != nil {
+		return film, err
+	}
+	if opts.Progress != nil {
+		total := opts.SamplesPerPixel * opts.Width * opts.Height
+		opts.Progress(total, total)
+	}
+	return film, nil
+}
+
+// renderImage renders with an integrator that works on the whole image at once
+func renderImage(ctx context.Context, scene *Scene, cam *camera.Camera, integ integrator.ImageIntegrator, opts Options) (*Film, error) {
+	img := integ.Render(ctx, scene, cam, opts.Width, opts.Height, func(iteration, iterations int, snapshot *renderer.Film) {
+		if opts.Progress != nil {
+			opts.Progress(iteration, iterations)
+		}
+		if snapshot != nil && iteration < iterations && opts.Pass != nil {
+			opts.Pass(iteration, filmFromImage(snapshot))
+		}
+	})
+	return filmFromImage(img), ctx.Err()
+}
+
+// frame is an image being rendered by the workers with an integrator that works
+// sample by sample. The samples are taken in passes over the tiles.
+type frame struct {
+	opts  Options
+	tiles []tile
+	film  *Film
+	scene *Scene
+	cam   *camera.Camera
+}
+
+// render takes all the samples of the frame. When ctx is cancelled the workers
+// stop where they are and render returns its error, with what's left of the
+// pass in the film.
+func (f *frame) render(ctx context.Context) error {
+	film := f.film
+	jobs := make(chan job, f.opts.Workers*2)
+	results := make(chan result, f.opts.Workers*2)
+	defer close(jobs)
+	s := workerState{
+		ctx:        ctx,
+		jobs:       jobs,
+		results:    results,
+		film:       film,
+		filter:     f.opts.Filter,
+		scene:      f.scene,
+		integrator: f.opts.Integrator,
+		sampler:    f.opts.Sampler,
+		cam:        f.cam,
+	}
+	if len(film.aovs) > 0 {
+		s.materialIDs = f.scene.World.MaterialIDs()
+	}
+	for i := 0; i < f.opts.Workers; i++ {
+		go worker(s)
+	}
+
+	total := f.opts.SamplesPerPixel * film.Width * film.Height
+	passes := 0
+	lastCheckpoint := time.Now()
+	runPass := func(pass []int) {
+		before := make([]int, len(film.pixels))
+		for i, st := range film.pixels {
+			before[i] = st.samples
+		}
+		// Tiles are handed out here rather than all queued up front so that when
+		// a checkpoint is due or the render is cancelled the workers can be left
+		// to finish and go idle.
+		// At least one tile is handed out between checkpoints so the render
+		// always moves on, however often they are due.
+		// The filter spreads samples over neighbouring tiles, so every tile is
+		// rendered to a film of its own and merged into the image in the order
+		// tiles were handed out, keeping the sums the same whichever worker
+		// finishes first.
+		next, inFlight, checkpointed := 0, 0, -1
+		done := make([]*renderer.Film, len(f.tiles))
+		merged := 0
+		for next < len(f.tiles) || inFlight > 0 {
+			cancelled := ctx.Err() != nil
+			due := f.opts.Checkpoint != nil && next > checkpointed && time.Since(lastCheckpoint) >= f.opts.CheckpointEvery
+			for next < len(f.tiles) && inFlight < cap(jobs) && !due && !cancelled {
+				jobs <- job{index: next, tile: f.tiles[next], pass: pass}
+				next++
+				inFlight++
+			}
+			if inFlight == 0 {
+				if cancelled {
+					break
+				}
+				film.pending = film.left(pass, before)
+				f.opts.Checkpoint(film)
+				film.pending = nil
+				lastCheckpoint = time.Now()
+				checkpointed = next
+				continue
+			}
+			r := <-results
+			film.samples += r.taken
+			done[r.index] = r.film
+			for merged < next && done[merged] != nil {
+				film.image.Merge(done[merged])
+				done[merged] = nil
+				merged++
+			}
+			inFlight--
+			if f.opts.Progress != nil {
+				f.opts.Progress(film.samples, total)
+			}
+		}
+		if ctx.Err() != nil {
+			film.pending = film.left(pass, before)
+			return
+		}
+		passes++
+		if f.opts.Pass != nil {
+			f.opts.Pass(passes, film)
+		}
+	}
+
+	// Every pixel gets the base samples, adaptive sampling then spends what's
+	// left of the budget on the pixels that are still noisy. Progressive renders
+	// take the base samples one at a time. Pixels of a film carried on from may
+	// already have some of them.
+	adaptive := f.opts.Adaptive
+	base := adaptive.baseSamples(f.opts.SamplesPerPixel)
+	if film.pending != nil {
+		pass := film.pending
+		film.pending = nil
+		runPass(pass)
+	}
+	if f.opts.Progressive {
+		for k := 1; k <= base && ctx.Err() == nil; k++ {
+			runPass(film.topUp(k))
+		}
+	} else if ctx.Err() == nil {
+		runPass(film.topUp(base))
+	}
+	if adaptive.Enabled {
+		for pass := adaptive.nextPass(film.pixels, total-film.samples); pass != nil && ctx.Err() == nil; pass = adaptive.nextPass(film.pixels, total-film.samples) {
+			runPass(pass)
+		}
+	}
+	return ctx.Err()
+}
+
+type workerState struct {
+	ctx        context.Context // ctx stops the worker between pixels when cancelled
+	jobs       <-chan job
+	results    chan<- result
+	film       *Film
+	filter     renderer.Filter
+	scene      *Scene
+	integrator integrator.Integrator
+	sampler    sampler.PixelSampler // sampler is cloned by every worker
+	cam        *camera.Camera
+	// materialIDs numbers the materials of the scene for the material ID AOV
+	materialIDs map[objects.Material]int
+}
+
+// job is a tile to render, pass holds how many samples each pixel of the image gets
+type job struct {
+	index int // index of the tile in the pass
+	tile  tile
+	pass  []int
+}
+
+// result is a rendered tile
+type result struct {
+	index int
+	taken int // taken number of samples taken
+	film  *renderer.Film
+}
+
+func worker(state workerState) {
+	hr := new(objects.HitRecord)
+	smp := state.sampler.Clone()
+	splatter, splats := state.integrator.(integrator.Splatter)
+	aovIntegrator, splitsLight := state.integrator.(integrator.AOVIntegrator)
+	withAOVs := len(state.film.aovs) > 0
+	var aov integrator.AOVSample
+	width, height := state.film.Width, state.film.Height
+	for job := range state.jobs {
+		taken := 0
+		film := renderer.NewTileFilm(width, height, state.filter, job.tile.x0, job.tile.y0, job.tile.x1, job.tile.y1)
+	tile:
+		for y := job.tile.y0; y < job.tile.y1; y++ {
+			// Images go down while the camera's t goes up
+			j := height - 1 - y
+			for i := job.tile.x0; i < job.tile.x1; i++ {
+				if state.ctx.Err() != nil {
+					break tile
+				}
+				// Only one job per pass touches a pixel so its stats are ours for now
+				idx := y*width + i
+				st := &state.film.pixels[idx]
+				for k := 0; k < job.pass[idx]; k++ {
+					smp.StartPixelSample(i, j, st.samples)
+					du, dv := smp.Get2D()
+					u := (float64(i) + du) / float64(width-1)
+					v := (float64(j) + dv) / float64(height-1)
+					ray := state.cam.GetRay(u, v, smp)
+					var c vec3.Color
+					if withAOVs {
+						aov = integrator.AOVSample{}
+						if splats || !splitsLight {
+							integrator.FirstHit(ray, state.scene, hr, &aov)
+						}
+					}
+					switch {
+					case splats:
+						c = splatter.LiSplat(ray, state.scene, state.cam, state.film.splats, smp, hr)
+					case withAOVs && splitsLight:
+						c = aovIntegrator.LiAOV(ray, state.scene, smp, hr, &aov)
+					default:
+						c = state.integrator.Li(ray, state.scene, smp, hr)
+					}
+					if withAOVs {
+						state.film.addAOVs(idx, st.samples == 0, &aov, state.materialIDs)
+					}
+					st.add(c)
+					// The film's y goes down like the image's
+					film.AddSample(float64(i)+du, float64(y+1)-dv, c)
+				}
+				taken += job.pass[idx]
+			}
+		}
+		state.results <- result{index: job.index, taken: taken, film: film}
+	}
+}
@@ -0,0 +1,382 @@
+package tracer
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vfrazao-ns1/raytracing1weekend/camera"
+	"github.com/vfrazao-ns1/raytracing1weekend/integrator"
+	"github.com/vfrazao-ns1/raytracing1weekend/internal/scenetest"
+	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/renderer"
+	"github.com/vfrazao-ns1/raytracing1weekend/sampler"
+	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
+)
+
+func TestMakeTilesCoverImage(t *testing.T) {
+	width, height := 100, 70
+	for _, order := range []string{"spiral", "hilbert", "scanline"} {
+		covered := make([]int, width*height)
+		for _, tl := range makeTiles(width, height, Tiles{Size: 16, Order: order}) {
+			for y := tl.y0; y < tl.y1; y++ {
+				for x := tl.x0; x < tl.x1; x++ {
+					covered[y*width+x]++
+				}
+			}
+		}
+		for idx, n := range covered {
+			if n != 1 {
+				t.Fatalf("%s order covers pixel (%d, %d) %d times", order, idx%width, idx/width, n)
+			}
+		}
+	}
+}
+
+func TestHilbertIndexNeighbours(t *testing.T) {
+	n := 8
+	pos := make([][2]int, n*n)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			pos[hilbertIndex(n, x, y)] = [2]int{x, y}
+		}
+	}
+	for d := 1; d < n*n; d++ {
+		dx := pos[d][0] - pos[d-1][0]
+		dy := pos[d][1] - pos[d-1][1]
+		if dx*dx+dy*dy != 1 {
+			t.Fatalf("cells %d and %d of the Hilbert curve aren't neighbours: %v %v", d-1, d, pos[d-1], pos[d])
+		}
+	}
+}
+
+// testScene is the small scene the integrators are tested with
+func testScene() (*integrator.Scene, *camera.Camera) {
+	return &integrator.Scene{World: scenetest.World(), Lights: scenetest.Lights()}, scenetest.Camera(2)
+}
+
+// testOptions renders the test scene small and fast
+func testOptions() Options {
+	return Options{
+		Width:           64,
+		Height:          32,
+		SamplesPerPixel: 8,
+		Integrator:      integrator.Path{MaxDepth: 4},
+		Sampler:         sampler.NewRandom(1),
+		Tiles:           Tiles{Size: 8},
+	}
+}
+
+// greyStats returns the stats of a pixel whose samples are greys of the given
+// brightness
+func greyStats(lums ...float64) pixelStats {
+	st := pixelStats{}
+	for _, l := range lums {
+		st.add(vec3.Color{X: l, Y: l, Z: l})
+	}
+	return st
+}
+
+func TestRelativeError(t *testing.T) {
+	cases := []struct {
+		name     string
+		st       pixelStats
+		expected float64
+	}{
+		{"no samples", greyStats(), math.Inf(1)},
+		{"one sample", greyStats(0.5), math.Inf(1)},
+		{"converged", greyStats(0.5, 0.5, 0.5), 0},
+		// Standard error 0.1 of a mean of 0.5
+		{"noisy", greyStats(0.4, 0.6), 0.2},
+		// Standard error 0.01, measured against darkLuminance
+		{"dark", greyStats(0.01, 0.03), 0.2},
+	}
+	for _, c := range cases {
+		if err := c.st.relativeError(); err != c.expected && !(math.Abs(err-c.expected) <= 1e-9) {
+			t.Errorf("%s: relative error %g, expected %g", c.name, err, c.expected)
+		}
+	}
+}
+
+func TestNextPass(t *testing.T) {
+	a := Adaptive{Enabled: true, MinSamples: 4, MaxSamples: 10, Threshold: 0.1}
+	stats := []pixelStats{
+		greyStats(0.5, 0.5),                     // converged
+		greyStats(0.4, 0.6),                     // noisy
+		greyStats(0, 1, 0, 1, 0, 1, 0, 1),       // noisiest, 2 samples away from MaxSamples
+		greyStats(0, 1, 0, 1, 0, 1, 0, 1, 0, 1), // noisy but out of samples
+	}
+	cases := []struct {
+		budget   int
+		expected []int
+	}{
+		{100, []int{0, 4, 2, 0}},
+		// Noisiest first
+		{5, []int{0, 3, 2, 0}},
+		{1, []int{0, 0, 1, 0}},
+		{0, nil},
+	}
+	for _, c := range cases {
+		if pass := a.nextPass(stats, c.budget); !reflect.DeepEqual(pass, c.expected) {
+			t.Errorf("budget %d: pass %v, expected %v", c.budget, pass, c.expected)
+		}
+	}
+	if pass := a.nextPass(stats[:1], 100); pass != nil {
+		t.Errorf("converged pixels get another pass %v", pass)
+	}
+}
+
+func TestRenderSameForAnyWorkers(t *testing.T) {
+	scene, cam := testScene()
+	// BDPT splats onto the pixels of other tiles too
+	for _, integ := range []integrator.Integrator{integrator.Path{MaxDepth: 4}, integrator.BDPT{MaxDepth: 4}} {
+		opts := testOptions()
+		opts.Integrator = integ
+		opts.Adaptive = Adaptive{Enabled: true}
+		opts.Filter = renderer.Mitchell{R: 2, B: 1.0 / 3, C: 1.0 / 3}
+		opts.Workers = 1
+		want, err := Render(context.Background(), scene, cam, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Workers = 7
+		got, err := Render(context.Background(), scene, cam, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRGB, gotWeight := got.Image().Sums()
+		wantRGB, wantWeight := want.Image().Sums()
+		if !reflect.DeepEqual(gotRGB, wantRGB) || !reflect.DeepEqual(gotWeight, wantWeight) {
+			t.Fatalf("%T gave a different image with 7 workers than with 1", integ)
+		}
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	scene, cam := testScene()
+	opts := testOptions()
+	opts.Adaptive = Adaptive{Enabled: true}
+	want, err := Render(context.Background(), scene, cam, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checkpoint partway through the adaptive passes, then carry on from it
+	var saved []byte
+	checkpoints := 0
+	interrupted := opts
+	interrupted.CheckpointEvery = time.Nanosecond
+	interrupted.Checkpoint = func(film *Film) {
+		checkpoints++
+		if saved == nil && film.pending != nil && film.Samples() > 8*64*32/2 && checkpoints%7 == 0 {
+			if saved, err = film.MarshalBinary(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := Render(context.Background(), scene, cam, interrupted); err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil {
+		t.Fatal("no checkpoint was made during the adaptive passes")
+	}
+
+	resumed := opts
+	resumed.Film = new(Film)
+	if err := resumed.Film.UnmarshalBinary(saved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Render(context.Background(), scene, cam, resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResumed(t, got, want)
+}
+
+func TestCancelResume(t *testing.T) {
+	scene, cam := testScene()
+	opts := testOptions()
+	opts.Filter = renderer.Gaussian{R: 1.5, Sigma: 0.5}
+	want, err := Render(context.Background(), scene, cam, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling stops the workers partway through their tiles, the film has to
+	// hold exactly the samples they didn't take
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := opts
+	interrupted.Progress = func(done, total int) {
+		if done > total/3 {
+			cancel()
+		}
+	}
+	film, err := Render(ctx, scene, cam, interrupted)
+	if err != context.Canceled {
+		t.Fatalf("render wasn't cancelled: %v", err)
+	}
+
+	resumed := opts
+	resumed.Film = film
+	got, err := Render(context.Background(), scene, cam, resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResumed(t, got, want)
+}
+
+func TestAOVs(t *testing.T) {
+	scene, cam := testScene()
+	opts := testOptions()
+	opts.AOVs = allAOVs
+	opts.Workers = 1
+	film, err := Render(context.Background(), scene, cam, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Workers = 7
+	other, err := Render(context.Background(), scene, cam, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(other.aovs, film.aovs) {
+		t.Fatal("AOVs differ with 7 workers from with 1")
+	}
+
+	// The camera looks straight at the sphere, 1.5 away, which covers a few
+	// pixels around the middle of the image
+	x, y := opts.Width/2-1, opts.Height/2
+	for _, tc := range []struct {
+		aov  AOV
+		want vec3.Vec3
+	}{
+		{Depth, vec3.Vec3{X: 1.5, Y: 1.5, Z: 1.5}},
+		{Normal, vec3.Vec3{X: 0, Y: 0, Z: 1}},
+		{Position, vec3.Vec3{X: 0, Y: 0, Z: -0.5}},
+		{Albedo, vec3.Vec3{X: 0.1, Y: 0.2, Z: 0.5}},
+		{ObjectID, vec3.Vec3{X: 2, Y: 2, Z: 2}},
+		{MaterialID, vec3.Vec3{X: 2, Y: 2, Z: 2}},
+		{SampleCount, vec3.Vec3{X: 8, Y: 8, Z: 8}},
+	} {
+		if got := film.AOV(tc.aov).At(x, y); got.Sub(tc.want).Length() > 0.05 {
+			t.Errorf("%s of the center pixel is %v, want %v", tc.aov, got, tc.want)
+		}
+	}
+
+	// With a box filter the image is the mean of the samples, which the light
+	// is split from
+	img, direct, indirect := film.Image(), film.AOV(Direct), film.AOV(Indirect)
+	for y := 0; y < opts.Height; y++ {
+		for x := 0; x < opts.Width; x++ {
+			if d := direct.At(x, y).Add(indirect.At(x, y)).Sub(img.At(x, y)); d.Length() > 1e-4 {
+				t.Fatalf("direct and indirect light of pixel (%d, %d) add up to %v, want %v", x, y, direct.At(x, y).Add(indirect.At(x, y)), img.At(x, y))
+			}
+		}
+	}
+
+	data, err := film.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := new(Film)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.aovs, film.aovs) {
+		t.Fatal("AOVs changed going through a checkpoint")
+	}
+}
+
+// checkResumed fails the test if a film that was carried on from didn't take
+// the same samples as want. The image may only be rounded differently.
+func checkResumed(t *testing.T, got, want *Film) {
+	t.Helper()
+	if got.Samples() != want.Samples() || !reflect.DeepEqual(got.pixels, want.pixels) {
+		t.Fatalf("resumed film differs from one rendered in one go: %d samples, want %d", got.Samples(), want.Samples())
+	}
+	gotImg, wantImg := got.Image(), want.Image()
+	for y := 0; y < want.Height; y++ {
+		for x := 0; x < want.Width; x++ {
+			if d := gotImg.At(x, y).Sub(wantImg.At(x, y)); d.Length() > 1e-5 {
+				t.Fatalf("resumed film's pixel (%d, %d) is %v, want %v", x, y, gotImg.At(x, y), wantImg.At(x, y))
+			}
+		}
+	}
+}
+
+// benchmarkTiles renders a small, cheap scene so the cost of handing out the
+// work shows
+func benchmarkTiles(b *testing.B, size int, order string) {
+	scene, cam := testScene()
+	opts := Options{
+		Width:           256,
+		Height:          128,
+		SamplesPerPixel: 1,
+		Integrator:      integrator.Path{MaxDepth: 2},
+		Sampler:         sampler.NewRandom(1),
+		Tiles:           Tiles{Size: size, Order: order},
+	}
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		Render(context.Background(), scene, cam, opts)
+	}
+	b.ReportMetric(float64(b.N*opts.Width*opts.Height)/time.Since(start).Seconds(), "samples/s")
+}
+
+// BenchmarkPixelJobs renders the scene of benchmarkTiles the way it was before
+// tiles, sending every pixel to the workers as a job of its own and every
+// pixel's color back as a result
+func BenchmarkPixelJobs(b *testing.B) {
+	scene, cam := testScene()
+	width, height := 256, 128
+	integ := integrator.Path{MaxDepth: 2}
+	smp := sampler.NewRandom(1)
+	numWorkers := runtime.NumCPU()
+	type job struct{ i, j int }
+	type pixel struct {
+		job
+		color vec3.Color
+	}
+	b.ResetTimer()
+	start := time.Now()
+	for n := 0; n < b.N; n++ {
+		jobs := make(chan job, numWorkers*10)
+		results := make(chan pixel, numWorkers*10)
+		go func() {
+			for j := height - 1; j >= 0; j-- {
+				for i := 0; i < width; i++ {
+					jobs <- job{i: i, j: j}
+				}
+			}
+			close(jobs)
+		}()
+		for w := 0; w < numWorkers; w++ {
+			go func() {
+				hr := new(objects.HitRecord)
+				smp := smp.Clone()
+				for job := range jobs {
+					smp.StartPixelSample(job.i, job.j, 0)
+					du, dv := smp.Get2D()
+					u := (float64(job.i) + du) / float64(width-1)
+					v := (float64(job.j) + dv) / float64(height-1)
+					results <- pixel{job, integ.Li(cam.GetRay(u, v, smp), scene, smp, hr)}
+				}
+			}()
+		}
+		pixels := make([]vec3.Color, width*height)
+		for range pixels {
+			p := <-results
+			pixels[(height-1-p.j)*width+p.i] = p.color
+		}
+	}
+	b.ReportMetric(float64(b.N*width*height)/time.Since(start).Seconds(), "samples/s")
+}
+
+func BenchmarkTiles1Scanline(b *testing.B) { benchmarkTiles(b, 1, "scanline") }
+func BenchmarkTiles16Spiral(b *testing.B)  { benchmarkTiles(b, 16, "spiral") }
+func BenchmarkTiles32Spiral(b *testing.B)  { benchmarkTiles(b, 32, "spiral") }
+func BenchmarkTiles32Hilbert(b *testing.B) { benchmarkTiles(b, 32, "hilbert") }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/binary"
 	"math"
 
 	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
@@ -85,3 +86,41 @@ func RandomInUnitDisk() vec3.Vec3 {
 func MakeEven(num int) int {
 	return num & ^1
 }
+
+// RNG is a random number generator with a known seed, unlike the functions above
+// the numbers it gives are the same every run
+type RNG struct {
+	r *rand.RNG
+}
+
+// NewRNG creates a generator from seed
+func NewRNG(seed uint64) *RNG {
+	return &RNG{r: rand.NewCustom(SeedBytes(seed), 1024, 12)}
+}
+
+// SeedBytes expands seed into the 32 bytes frand wants as a seed
+func SeedBytes(seed uint64) []byte {
+	b := make([]byte, 32)
+	binary.LittleEndian.PutUint64(b, seed)
+	return b
+}
+
+// Double returns a number in [0, 1)
+func (g *RNG) Double() float64 {
+	return g.r.Float64()
+}
+
+// DoubleBetween returns a number in [min, max)
+func (g *RNG) DoubleBetween(min, max float64) float64 {
+	return min + (max-min)*g.Double()
+}
+
+// Vec3 returns a vector with every component in [0, 1)
+func (g *RNG) Vec3() vec3.Vec3 {
+	return vec3.Vec3{X: g.Double(), Y: g.Double(), Z: g.Double()}
+}
+
+// Vec3Between returns a vector with every component in [min, max)
+func (g *RNG) Vec3Between(min, max float64) vec3.Vec3 {
+	return vec3.Vec3{X: g.DoubleBetween(min, max), Y: g.DoubleBetween(min, max), Z: g.DoubleBetween(min, max)}
+}
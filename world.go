@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/vfrazao-ns1/raytracing1weekend/objects"
+	"github.com/vfrazao-ns1/raytracing1weekend/tracer"
 	"github.com/vfrazao-ns1/raytracing1weekend/utils"
 	"github.com/vfrazao-ns1/raytracing1weekend/vec3"
 )
@@ -10,6 +11,18 @@ func worldFromConfig(conf worldConfig) objects.HittableList {
 	return objects.HittableList{Data: conf.Static}
 }
 
+// sceneFromConfig builds the scene the world config describes, random worlds
+// are made from seed
+func sceneFromConfig(conf worldConfig, seed uint64) *tracer.Scene {
+	var world objects.HittableList
+	if conf.Random == true {
+		world = RandomWorld(seed)
+	} else {
+		world = worldFromConfig(conf)
+	}
+	return &tracer.Scene{World: world, Lights: conf.Lights}
+}
+
 func staticScene() objects.HittableList {
 	world := new(objects.HittableList)
 	world.Add(
@@ -65,7 +78,10 @@ func staticScene() objects.HittableList {
 	return *world
 }
 
-func RandomWorld() objects.HittableList {
+// RandomWorld is the final scene of the book with the small spheres placed
+// randomly, the same seed always gives the same world
+func RandomWorld(seed uint64) objects.HittableList {
+	rng := utils.NewRNG(seed)
 	world := new(objects.HittableList)
 
 	ground := objects.Sphere{
@@ -78,12 +94,12 @@ func RandomWorld() objects.HittableList {
 
 	for a := -11; a < 11; a++ {
 		for b := -11; b < 11; b++ {
-			chooseMat := utils.RandomDouble()
+			chooseMat := rng.Double()
 
 			center := vec3.Point{
-				X: float64(a) + 0.9*utils.RandomDouble(),
+				X: float64(a) + 0.9*rng.Double(),
 				Y: 0.2,
-				Z: float64(b) + 0.9*utils.RandomDouble(),
+				Z: float64(b) + 0.9*rng.Double(),
 			}
 
 			if center.Sub(vec3.Vec3{X: 4, Y: 0.2, Z: 0}).Length() > 0.9 {
@@ -92,11 +108,11 @@ func RandomWorld() objects.HittableList {
 				switch {
 				case chooseMat < 0.8:
 					// diffuse
-					albedo := utils.RandomVec3().Mul(utils.RandomVec3())
+					albedo := rng.Vec3().Mul(rng.Vec3())
 					sphereMaterial = objects.Lambertian{Albedo: albedo}
 				case chooseMat < 0.95:
-					albedo := utils.RandomVec3Between(0.5, 1)
-					fuzz := utils.RandomDoubleBetween(0, 0.5)
+					albedo := rng.Vec3Between(0.5, 1)
+					fuzz := rng.DoubleBetween(0, 0.5)
 					sphereMaterial = objects.Metal{Albedo: albedo, Fuzz: fuzz}
 				default:
 					sphereMaterial = objects.DiElectric{RefIndex: 1.5}